@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The hash index remembers the content of every file a plugin has profiled,
+// keyed by SHA-256, so identical content is not profiled twice and the same
+// file arriving from different sources is reported as a duplicate.
+
+var hashIndexPath = "./catalog/hashes.json"
+
+type HashRecord struct {
+	SHA256    string `json:"sha256"`
+	MD5       string `json:"md5"`
+	Source    string `json:"source"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	IndexedAt string `json:"indexed_at"`
+}
+
+type HashIndex map[string][]HashRecord
+
+func loadHashIndex() (HashIndex, error) {
+	index := HashIndex{}
+	data, err := ioutil.ReadFile(hashIndexPath)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, err
+}
+
+func (index HashIndex) save() error {
+	err := os.MkdirAll(filepath.Dir(hashIndexPath), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(hashIndexPath, data, 0644)
+}
+
+// hashFile streams a file once through SHA-256 and MD5.
+func hashFile(path string) (HashRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return HashRecord{}, err
+	}
+	defer file.Close()
+
+	sha := sha256.New()
+	sum := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha, sum), file)
+	if err != nil {
+		return HashRecord{}, err
+	}
+	return HashRecord{
+		SHA256: "sha256:" + hex.EncodeToString(sha.Sum(nil)),
+		MD5:    hex.EncodeToString(sum.Sum(nil)),
+		Path:   path,
+		Size:   size,
+	}, nil
+}
+
+// hashFiles hashes the named files in dir on behalf of source.
+func hashFiles(dir string, files []string, source string) ([]HashRecord, error) {
+	records := make([]HashRecord, 0, len(files))
+	now := time.Now().Format(time.RFC3339)
+	for _, name := range files {
+		record, err := hashFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		record.Source = source
+		record.IndexedAt = now
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// compare splits records into those whose content was already indexed
+// (and so already profiled) and groups of paths sharing the same content,
+// whether within this batch or with files seen before from any source.
+func (index HashIndex) compare(records []HashRecord) (map[string]bool, map[string][]string) {
+	unchanged := map[string]bool{}
+	byHash := map[string][]string{}
+	for _, record := range records {
+		if len(index[record.SHA256]) > 0 {
+			unchanged[record.Path] = true
+		}
+		byHash[record.SHA256] = append(byHash[record.SHA256], record.Source+":"+record.Path)
+	}
+
+	duplicates := map[string][]string{}
+	for sha, paths := range byHash {
+		seen := map[string]bool{}
+		for _, path := range paths {
+			seen[path] = true
+		}
+		for _, previous := range index[sha] {
+			seen[previous.Source+":"+previous.Path] = true
+		}
+		if len(seen) > 1 {
+			for path := range seen {
+				duplicates[sha] = append(duplicates[sha], path)
+			}
+			sort.Strings(duplicates[sha])
+		}
+	}
+	return unchanged, duplicates
+}
+
+// add records the batch, replacing an earlier record of the same file.
+func (index HashIndex) add(records []HashRecord) {
+	for _, record := range records {
+		kept := index[record.SHA256][:0]
+		for _, previous := range index[record.SHA256] {
+			if previous.Path != record.Path || previous.Source != record.Source {
+				kept = append(kept, previous)
+			}
+		}
+		index[record.SHA256] = append(kept, record)
+	}
+}
+
+// The catalog also keeps, for each content hash, the resource and key
+// candidates a plugin wrote for it. An unchanged file is then handed to the
+// plugin as a cached profile rather than profiled again, and the package of
+// every ingestion still covers all of its files.
+
+var catalogResourcesDir = "./catalog/resources"
+
+// CachedResource is the catalogued profile of File, a path relative to the
+// source directory, as the plugins take it.
+type CachedResource struct {
+	File     string
+	Resource json.RawMessage
+	Keys     json.RawMessage
+}
+
+type catalogEntry struct {
+	Resource json.RawMessage `json:"resource"`
+	Keys     json.RawMessage `json:"keys,omitempty"`
+}
+
+func catalogEntryPath(sha string) string {
+	return filepath.Join(catalogResourcesDir, strings.TrimPrefix(sha, "sha256:")+".json")
+}
+
+func loadCatalogEntry(sha string) (catalogEntry, bool) {
+	var entry catalogEntry
+	data, err := ioutil.ReadFile(catalogEntryPath(sha))
+	if err != nil || json.Unmarshal(data, &entry) != nil || len(entry.Resource) == 0 {
+		return entry, false
+	}
+	return entry, true
+}
+
+// planProfiling splits the files with one of the extensions, hashed under
+// dir, into those the plugin must profile and the catalogued profiles of
+// the unchanged ones.
+func planProfiling(records []HashRecord, unchanged map[string]bool, dir string, exts ...string) ([]string, []CachedResource) {
+	var files []string
+	var cached []CachedResource
+	for _, record := range withExtension(records, exts...) {
+		file, err := filepath.Rel(dir, record.Path)
+		if err != nil {
+			continue
+		}
+		if unchanged[record.Path] {
+			if entry, ok := loadCatalogEntry(record.SHA256); ok {
+				cached = append(cached, CachedResource{File: file, Resource: entry.Resource, Keys: entry.Keys})
+				continue
+			}
+		}
+		files = append(files, file)
+	}
+	return files, cached
+}
+
+// catalogPackage stores the resources and key candidates of the package
+// written to output for the files a plugin profiled from sourceDir, which
+// were hashed under dir.
+func catalogPackage(output, sourceDir, dir string, records []HashRecord, files []string) error {
+	var descriptor, keys struct {
+		Resources []json.RawMessage `json:"resources"`
+	}
+	data, err := ioutil.ReadFile(filepath.Join(output, "datapackage.json"))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &descriptor); err != nil {
+		return err
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(output, "keys.json")); err == nil {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return err
+		}
+	}
+	keysByName := map[string]json.RawMessage{}
+	for _, raw := range keys.Resources {
+		var candidates struct {
+			Resource string `json:"resource"`
+		}
+		if json.Unmarshal(raw, &candidates) == nil {
+			keysByName[candidates.Resource] = raw
+		}
+	}
+
+	profiled := map[string]bool{}
+	for _, file := range files {
+		profiled[file] = true
+	}
+	shaByFile := map[string]string{}
+	for _, record := range records {
+		if file, err := filepath.Rel(dir, record.Path); err == nil && profiled[file] {
+			shaByFile[file] = record.SHA256
+		}
+	}
+
+	if err := os.MkdirAll(catalogResourcesDir, 0755); err != nil {
+		return err
+	}
+	for _, raw := range descriptor.Resources {
+		var resource struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			return err
+		}
+		file, err := filepath.Rel(sourceDir, resource.Path)
+		if err != nil || shaByFile[file] == "" {
+			continue
+		}
+		data, err := json.Marshal(catalogEntry{Resource: raw, Keys: keysByName[resource.Name]})
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(catalogEntryPath(shaByFile[file]), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withExtension returns the records of files with one of the extensions,
+// those handed to the plugin that reads them.
+func withExtension(records []HashRecord, exts ...string) []HashRecord {
+	var matched []HashRecord
+	for _, record := range records {
+		for _, ext := range exts {
+			if filepath.Ext(record.Path) == ext {
+				matched = append(matched, record)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func unchangedList(unchanged map[string]bool) []string {
+	var paths []string
+	for path := range unchanged {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
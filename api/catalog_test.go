@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "abc"})
+	record, err := hashFile(filepath.Join(dir, "a.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := HashRecord{
+		SHA256: "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		MD5:    "900150983cd24fb0d6963f7d28e17f72",
+		Path:   filepath.Join(dir, "a.csv"),
+		Size:   3,
+	}
+	if record != want {
+		t.Errorf("hashFile() = %+v, want %+v", record, want)
+	}
+}
+
+func TestHashIndexCompare(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "1", "b.csv": "2", "c.csv": "2", "d.csv": "3"})
+	before, err := hashFiles(dir, []string{"a.csv"}, "s3://old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := HashIndex{}
+	index.add(before)
+
+	records, err := hashFiles(dir, []string{"a.csv", "b.csv", "c.csv", "d.csv"}, "s3://new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged, duplicates := index.compare(records)
+	if want := map[string]bool{filepath.Join(dir, "a.csv"): true}; !reflect.DeepEqual(unchanged, want) {
+		t.Errorf("unchanged = %v, want %v", unchanged, want)
+	}
+	want := map[string][]string{
+		records[0].SHA256: {"s3://new:" + filepath.Join(dir, "a.csv"), "s3://old:" + filepath.Join(dir, "a.csv")},
+		records[1].SHA256: {"s3://new:" + filepath.Join(dir, "b.csv"), "s3://new:" + filepath.Join(dir, "c.csv")},
+	}
+	if !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("duplicates = %v, want %v", duplicates, want)
+	}
+
+	// Indexing the same file again replaces its record.
+	index.add(records[:1])
+	index.add(records[:1])
+	if got := len(index[records[0].SHA256]); got != 2 {
+		t.Errorf("%d records of a.csv, want one per source", got)
+	}
+}
+
+// TestIncrementalProfiling catalogues the package a plugin wrote and
+// checks that on the next ingestion only the changed file is profiled,
+// the unchanged one coming from the catalog.
+func TestIncrementalProfiling(t *testing.T) {
+	defer func(dir string) { catalogResourcesDir = dir }(catalogResourcesDir)
+	catalogResourcesDir = filepath.Join(t.TempDir(), "resources")
+
+	dir, output := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.csv": "id\n1\n", "b.csv": "id\n2\n", "c.json": "[]"})
+	records, err := hashFiles(dir, []string{"a.csv", "b.csv", "c.json"}, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := HashIndex{}
+	unchanged, _ := index.compare(records)
+	files, cached := planProfiling(records, unchanged, dir, ".csv")
+	if !reflect.DeepEqual(files, []string{"a.csv", "b.csv"}) || len(cached) != 0 {
+		t.Fatalf("first ingestion profiles %v with %d cached, want every CSV file", files, len(cached))
+	}
+
+	// What the plugin writes, reading the files from its own directory.
+	sourceDir := "/plugin/downloads"
+	writeFiles(t, output, map[string]string{
+		"datapackage.json": `{"resources": [
+			{"name": "a", "path": "/plugin/downloads/a.csv", "rowsCount": 1},
+			{"name": "b", "path": "/plugin/downloads/b.csv", "rowsCount": 1}]}`,
+		"keys.json": `{"resources": [{"resource": "a", "columns": [{"field": "id"}]}]}`,
+	})
+	if err := catalogPackage(output, sourceDir, dir, records, files); err != nil {
+		t.Fatal(err)
+	}
+	index.add(withExtension(records, ".csv"))
+
+	writeFiles(t, dir, map[string]string{"b.csv": "id\n3\n"})
+	records, err = hashFiles(dir, []string{"a.csv", "b.csv"}, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged, _ = index.compare(records)
+	files, cached = planProfiling(records, unchanged, dir, ".csv")
+	if !reflect.DeepEqual(files, []string{"b.csv"}) {
+		t.Errorf("second ingestion profiles %v, want [b.csv]", files)
+	}
+	if len(cached) != 1 || cached[0].File != "a.csv" {
+		t.Fatalf("cached = %+v, want a.csv", cached)
+	}
+	var resource struct {
+		Name      string `json:"name"`
+		RowsCount int    `json:"rowsCount"`
+	}
+	if err := json.Unmarshal(cached[0].Resource, &resource); err != nil || resource.Name != "a" || resource.RowsCount != 1 {
+		t.Errorf("cached resource = %s (%v)", cached[0].Resource, err)
+	}
+	if len(cached[0].Keys) == 0 {
+		t.Error("key candidates of a.csv not catalogued")
+	}
+
+	// Content indexed without a catalogue entry, as after a legacy
+	// ingestion, is profiled again.
+	index.add(records)
+	os.RemoveAll(catalogResourcesDir)
+	files, cached = planProfiling(records, map[string]bool{records[0].Path: true, records[1].Path: true}, dir, ".csv")
+	if len(files) != 2 || len(cached) != 0 {
+		t.Errorf("without a catalogue profiles %v with %d cached, want both files", files, len(cached))
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/md5"
+
 	"database/sql"
 
+	"encoding/hex"
+
 	"fmt"
 
 	"io"
@@ -16,6 +20,8 @@ import (
 	"os"
 
 	"path/filepath"
+
+	"strings"
 	
 	"net/rpc"
 
@@ -50,6 +56,64 @@ type DatabaseCredentials struct {
 	DBName          string `json:"dbname"`
 	PluginType      string `json:"pluginType"`
 	SourceDirectory string `json:"sourceDirectory"`
+
+	PackageName        string        `json:"packageName"`
+	PackageTitle       string        `json:"packageTitle"`
+	PackageDescription string        `json:"packageDescription"`
+	Licenses           []License     `json:"licenses"`
+	Sources            []Source      `json:"sources"`
+	Contributors       []Contributor `json:"contributors"`
+	LegacyOutput       bool          `json:"legacyOutput"`
+	ComputeMD5         bool          `json:"computeMD5"`
+	Percentiles        []float64     `json:"percentiles"`
+	HistogramBins      int           `json:"histogramBins"`
+	HistogramType      string        `json:"histogramType"`
+	TopK               int           `json:"topK"`
+	EnumThreshold      int           `json:"enumThreshold"`
+	DistinctMode       string        `json:"distinctMode"`
+	SensitivePolicy    string        `json:"sensitivePolicy"`
+	IncludeSchemas     []string      `json:"includeSchemas"`
+	ExcludeSchemas     []string      `json:"excludeSchemas"`
+	ProfileMode        string        `json:"profileMode"`
+	SamplePercent      float64       `json:"samplePercent"`
+	Concurrency        int           `json:"concurrency"`
+	ColumnConcurrency  int           `json:"columnConcurrency"`
+	StatementTimeout   int           `json:"statementTimeout"`
+	OutputPath         string        `json:"outputPath"`
+	// Failed is set in the postgres plugin's reply to the tables that could
+	// not be profiled.
+	Failed             []FailedTable `json:"failed,omitempty"`
+
+	// Files and Cached ask a file plugin to profile only the changed files
+	// and to take the others from the catalog.
+	Files  []string         `json:"files"`
+	Cached []CachedResource `json:"cached"`
+}
+
+type FailedTable struct {
+	Table string `json:"table"`
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+}
+
+type License struct {
+	Name  string `json:"name,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type Source struct {
+	Title string `json:"title"`
+	Path  string `json:"path,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type Contributor struct {
+	Title        string `json:"title"`
+	Path         string `json:"path,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Role         string `json:"role,omitempty"`
+	Organization string `json:"organization,omitempty"`
 }
 
 
@@ -115,6 +179,119 @@ type Credentials struct {
 	AccessKey string `json:"accesskey"`
 
 	Endpoint string `json:"endpoint"`
+
+	PackageName string `json:"package_name"`
+
+	PackageTitle string `json:"package_title"`
+
+	PackageDescription string `json:"package_description"`
+
+	Licenses []License `json:"licenses"`
+
+	Sources []Source `json:"sources"`
+
+	Contributors []Contributor `json:"contributors"`
+
+	LegacyOutput bool `json:"legacy_output"`
+
+	ComputeMD5 bool `json:"compute_md5"`
+
+	Percentiles []float64 `json:"percentiles"`
+
+	HistogramBins int `json:"histogram_bins"`
+
+	HistogramType string `json:"histogram_type"`
+
+	TopK int `json:"top_k"`
+
+	EnumThreshold int `json:"enum_threshold"`
+
+	DistinctMode string `json:"distinct_mode"`
+
+	SensitivePolicy string `json:"sensitive_policy"`
+
+	IncludeSchemas []string `json:"include_schemas"`
+
+	ExcludeSchemas []string `json:"exclude_schemas"`
+
+	ProfileMode string `json:"profile_mode"`
+
+	SamplePercent float64 `json:"sample_percent"`
+
+	Concurrency int `json:"concurrency"`
+
+	ColumnConcurrency int `json:"column_concurrency"`
+
+	StatementTimeout int `json:"statement_timeout"`
+}
+
+// withRequestOptions copies the data package properties and output options
+// supplied on the request into the data sent to a plugin.
+func withRequestOptions(data DatabaseCredentials, creds Credentials) DatabaseCredentials {
+	data.PackageName = creds.PackageName
+	data.PackageTitle = creds.PackageTitle
+	data.PackageDescription = creds.PackageDescription
+	data.Licenses = creds.Licenses
+	data.Sources = creds.Sources
+	data.Contributors = creds.Contributors
+	data.LegacyOutput = creds.LegacyOutput
+	data.ComputeMD5 = creds.ComputeMD5
+	data.Percentiles = creds.Percentiles
+	data.HistogramBins = creds.HistogramBins
+	data.HistogramType = creds.HistogramType
+	data.TopK = creds.TopK
+	data.EnumThreshold = creds.EnumThreshold
+	data.DistinctMode = creds.DistinctMode
+	data.SensitivePolicy = creds.SensitivePolicy
+	data.IncludeSchemas = creds.IncludeSchemas
+	data.ExcludeSchemas = creds.ExcludeSchemas
+	data.ProfileMode = creds.ProfileMode
+	data.SamplePercent = creds.SamplePercent
+	data.Concurrency = creds.Concurrency
+	data.ColumnConcurrency = creds.ColumnConcurrency
+	data.StatementTimeout = creds.StatementTimeout
+	return data
+}
+
+// pluginSourceDirectory is where the file plugins read the files hashed
+// under the API's own directories.
+const pluginSourceDirectory = "/home/swati/api/downloads"
+
+// profileFiles hands the file plugin at address the changed files with one
+// of the extensions, hashed under dir, and the catalogued profiles of the
+// unchanged ones. It catalogues what the plugin profiled and returns the
+// directory of the package, "" when none was written.
+func profileFiles(address string, creds Credentials, hashIndex HashIndex, records []HashRecord, unchanged map[string]bool, dir string, exts ...string) string {
+	files, cached := planProfiling(records, unchanged, dir, exts...)
+	if len(files) == 0 && len(cached) == 0 {
+		return ""
+	}
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		log.Fatal("Dial error:", err)
+	}
+
+	// Prepare the data to be sent
+	data := withRequestOptions(DatabaseCredentials{
+		SourceDirectory: pluginSourceDirectory,
+		Files:           files,
+		Cached:          cached,
+	}, creds)
+
+	var reply DatabaseCredentials
+	err = client.Call("MyRPCServer.GetData", data, &reply)
+	if err != nil {
+		log.Fatal("RPC error:", err)
+	}
+	// A legacy descriptor is not in the form the plugins take back.
+	if reply.OutputPath != "" && !creds.LegacyOutput {
+		err = catalogPackage(reply.OutputPath, pluginSourceDirectory, dir, records, files)
+		if err != nil {
+			log.Println("Failed to catalog the package:", err)
+		}
+	}
+	hashIndex.add(withExtension(records, exts...))
+	return reply.OutputPath
 }
 
 type Response struct {
@@ -132,6 +309,9 @@ type Response struct {
 	DownloadedCount int      `json:"downloaded_count,omitempty"`
 	CSVFiles        int      `json:"csv_files"`
 	JSONFiles       int      `json:"json_files"`
+
+	UnchangedFiles []string            `json:"unchanged_files,omitempty"`
+	DuplicateFiles map[string][]string `json:"duplicate_files,omitempty"`
 }
 
 func createTable(db *sql.DB) error {
@@ -334,13 +514,26 @@ func handleCredentials(c *gin.Context) {
 			for _, file := range downloadedFiles {
 				ext := filepath.Ext(file)
 				switch ext {
-				case ".csv":
+				case ".csv", ".tsv", ".psv", ".txt":
 					csvFiles++
 				case ".json":
 					jsonFiles++
 				}
 			}
 
+			// Hash the downloads so content profiled before is skipped
+			hashIndex, err := loadHashIndex()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			hashRecords, err := hashFiles("./downloads", downloadedFiles, "s3://"+creds.BucketName)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			unchanged, duplicates := hashIndex.compare(hashRecords)
+
 			c.JSON(http.StatusOK, Response{
 				Message:         "Connection to S3 Successfull",
 				S3Connection:    true,
@@ -349,47 +542,30 @@ func handleCredentials(c *gin.Context) {
 				DownloadedCount: downloadedCount,
 				CSVFiles:        csvFiles,
 				JSONFiles:       jsonFiles,
+				UnchangedFiles:  unchangedList(unchanged),
+				DuplicateFiles:  duplicates,
 			})
+			var outputs []string
 			if csvFiles > 0 {
-			
-				client, err := rpc.Dial("tcp", "localhost:3400")
-				if err != nil {
-					log.Fatal("Dial error:", err)
-				}
-
-				// Prepare the data to be sent
-				data := DatabaseCredentials{
-					SourceDirectory: "/home/swati/api/downloads",
-				}
-
-				var reply DatabaseCredentials
-				err = client.Call("MyRPCServer.GetData", data, &reply)
-				if err != nil {
-					log.Fatal("RPC error:", err)
-				}
-			fmt.Println("Calling csv:")
+				if output := profileFiles("localhost:3400", creds, hashIndex, hashRecords, unchanged, "./downloads", ".csv", ".tsv", ".psv", ".txt"); output != "" {
+					outputs = append(outputs, output)
 				}
+				fmt.Println("Calling csv:")
+			}
 
 
 			if jsonFiles > 0 {
-			
-				client, err := rpc.Dial("tcp", "localhost:3401")
-				if err != nil {
-					log.Fatal("Dial error:", err)
-				}
-
-				// Prepare the data to be sent
-				data := DatabaseCredentials{
-					SourceDirectory: "/home/swati/api/downloads",
-				}
-
-				var reply DatabaseCredentials
-				err = client.Call("MyRPCServer.GetData", data, &reply)
-				if err != nil {
-					log.Fatal("RPC error:", err)
-				}
-			fmt.Println("Calling json:")
+				if output := profileFiles("localhost:3401", creds, hashIndex, hashRecords, unchanged, "./downloads", ".json"); output != "" {
+					outputs = append(outputs, output)
 				}
+				fmt.Println("Calling json:")
+			}
+			// Only content a plugin has profiled is remembered
+			err = hashIndex.save()
+			if err != nil {
+				log.Println("Failed to save hash index:", err)
+			}
+			linkPackageKeys(outputs)
 			return
 		}
 		
@@ -420,65 +596,61 @@ func handleCredentials(c *gin.Context) {
     		for _, file := range copiedFiles {
 		ext := filepath.Ext(file)
 			switch ext {
-			case ".csv":
+			case ".csv", ".tsv", ".psv", ".txt":
 			    csvFiles++
 			case ".json":
 			    jsonFiles++
 				}
 			    }
 
+		// Hash the copies so content profiled before is skipped
+		hashIndex, err := loadHashIndex()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		hashRecords, err := hashFiles(destDir, copiedFiles, creds.URL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		unchanged, duplicates := hashIndex.compare(hashRecords)
+
 		    response := Response{
 			Message:      "Data copied Successfully",
 			CopiedFiles:  copiedFiles,
 			CopiedFolder: destDir,
 			CSVFiles:     csvFiles,
 			JSONFiles:    jsonFiles,
+			UnchangedFiles: unchangedList(unchanged),
+			DuplicateFiles: duplicates,
 		}
 
 
 		// Return the response
 		c.JSON(http.StatusOK, response)
 		
-					if csvFiles > 0 {
-			
-				client, err := rpc.Dial("tcp", "localhost:3400")
-				if err != nil {
-					log.Fatal("Dial error:", err)
-				}
-
-				// Prepare the data to be sent
-				data := DatabaseCredentials{
-					SourceDirectory: "/home/swati/api/downloads",
-				}
-
-				var reply DatabaseCredentials
-				err = client.Call("MyRPCServer.GetData", data, &reply)
-				if err != nil {
-					log.Fatal("RPC error:", err)
-				}
-			fmt.Println("Calling csv:")
+		var outputs []string
+			if csvFiles > 0 {
+				if output := profileFiles("localhost:3400", creds, hashIndex, hashRecords, unchanged, destDir, ".csv", ".tsv", ".psv", ".txt"); output != "" {
+					outputs = append(outputs, output)
 				}
+				fmt.Println("Calling csv:")
+			}
 
 
 			if jsonFiles > 0 {
-			
-				client, err := rpc.Dial("tcp", "localhost:3401")
-				if err != nil {
-					log.Fatal("Dial error:", err)
-				}
-
-				// Prepare the data to be sent
-				data := DatabaseCredentials{
-					SourceDirectory: "/home/swati/api/downloads",
-				}
-
-				var reply DatabaseCredentials
-				err = client.Call("MyRPCServer.GetData", data, &reply)
-				if err != nil {
-					log.Fatal("RPC error:", err)
-				}
-			fmt.Println("Calling json:")
+				if output := profileFiles("localhost:3401", creds, hashIndex, hashRecords, unchanged, destDir, ".json"); output != "" {
+					outputs = append(outputs, output)
 				}
+				fmt.Println("Calling json:")
+			}
+			// Only content a plugin has profiled is remembered
+			err = hashIndex.save()
+			if err != nil {
+				log.Println("Failed to save hash index:", err)
+			}
+			linkPackageKeys(outputs)
 		
 		
 		return
@@ -515,12 +687,17 @@ func handleCredentials(c *gin.Context) {
 		PluginType:      "postgres",
 		//SourceDirectory: "/home/swati/Documents/shared_folder/cred.json",
 	}
+	data = withRequestOptions(data, creds)
 
 	var reply DatabaseCredentials
 	err = client.Call("MyRPCServer.GetData", data, &reply)
 	if err != nil {
 		log.Fatal("RPC error:", err)
 	}
+	for _, failed := range reply.Failed {
+		log.Printf("Failed to profile %s %s: %s\n", failed.Kind, failed.Table, failed.Error)
+	}
+	linkPackageKeys([]string{reply.OutputPath})
 		return
 
 	}
@@ -578,10 +755,16 @@ func downloadFilesFromS3(s3Client *s3.S3, bucketName string) (int, []string, err
 			return count, nil, err
 		}
 
-		_, err = io.Copy(file, result.Body)
+		// Check the content against the ETag when it is the MD5 of the object
+		sum := md5.New()
+		_, err = io.Copy(io.MultiWriter(file, sum), result.Body)
 		if err != nil {
 			return count, nil, err
 		}
+		etag := strings.Trim(aws.StringValue(object.ETag), "\"")
+		if etagIsMD5(etag, result) && etag != hex.EncodeToString(sum.Sum(nil)) {
+			return count, nil, fmt.Errorf("downloaded %s does not match its ETag %s", *object.Key, etag)
+		}
 
 		downloadedFiles = append(downloadedFiles, *object.Key)
 		count++
@@ -590,6 +773,22 @@ func downloadFilesFromS3(s3Client *s3.S3, bucketName string) (int, []string, err
 	return count, downloadedFiles, nil
 }
 
+// etagIsMD5 reports whether an object's ETag is the MD5 of its content,
+// which it is not for multipart uploads or objects encrypted with SSE-KMS
+// or SSE-C.
+func etagIsMD5(etag string, result *s3.GetObjectOutput) bool {
+	if len(etag) != md5.Size*2 {
+		return false
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return false
+	}
+	if strings.HasPrefix(aws.StringValue(result.ServerSideEncryption), s3.ServerSideEncryptionAwsKms) || result.SSECustomerAlgorithm != nil {
+		return false
+	}
+	return true
+}
+
 func copyFilesFromLocal(sourceDir, destinationDir string) (string, error) {
 	files, err := ioutil.ReadDir(sourceDir)
 	if err != nil {
@@ -670,12 +869,79 @@ func getFilesList(directory string) ([]string, error) {
 
 }
 
+// ValidationRequest and ValidationReport mirror the types of the csv and
+// json plugins' Validate method.
+type ValidationRequest struct {
+	DataPath     string `json:"data_path"`
+	Schema       string `json:"schema"`
+	SchemaPath   string `json:"schema_path"`
+	ResourceName string `json:"resource_name"`
+	MaxErrors    int    `json:"max_errors"`
+}
+
+type ValidationError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Type    string `json:"type"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+type ValidationReport struct {
+	Path        string            `json:"path"`
+	Valid       bool              `json:"valid"`
+	RowsChecked int               `json:"rows_checked"`
+	ErrorCount  int               `json:"error_count"`
+	ErrorCounts map[string]int    `json:"error_counts"`
+	FieldErrors map[string]int    `json:"field_errors"`
+	Errors      []ValidationError `json:"errors"`
+}
+
+// handleValidate checks a data file against an expected Table Schema using
+// the plugin that handles the file's format.
+func handleValidate(c *gin.Context) {
+	var req ValidationRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var address string
+	switch filepath.Ext(req.DataPath) {
+	case ".csv", ".tsv", ".psv", ".txt":
+		address = "localhost:3400"
+	case ".json":
+		address = "localhost:3401"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only delimited text (.csv, .tsv, .psv, .txt) and .json files can be validated"})
+		return
+	}
+
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer client.Close()
+
+	var report ValidationReport
+	err = client.Call("MyRPCServer.Validate", req, &report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
 func main() {
 
 	r := gin.Default()
 
 	r.POST("/credentials", handleCredentials)
 
+	r.POST("/validate", handleValidate)
+
 	fmt.Println("Server listening on port 8080...")
 
 	log.Fatal(r.Run(":8080"))
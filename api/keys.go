@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Key discovery. Once the plugins are done, the key candidates they wrote
+// to keys.json next to each data package are compared across resources.
+// A resource's primary key is a unique, non-null column, or failing that a
+// pair of columns whose values never repeat together. A column is a
+// foreign key to another resource's single-column primary key when its
+// values are contained in the key's, as estimated from the KMV sketches of
+// both. Among several such keys, one whose name the column points at wins,
+// then the highest containment, then the key with the fewest values. The
+// keys are written into the Table Schema primaryKey and foreignKeys
+// properties of each package.
+
+// foreignKeyMinContainment is the share of a column's sampled values that
+// must be found in the referenced key, leaving room for a few orphan rows.
+var foreignKeyMinContainment = 0.98
+
+// keySketchSize is the number of hashes the plugins keep per column; a
+// sketch with fewer holds every distinct value.
+var keySketchSize = 256
+
+type KeyColumn struct {
+	Field    string   `json:"field"`
+	Type     string   `json:"type"`
+	Distinct int      `json:"distinct"`
+	Unique   bool     `json:"unique"`
+	Required bool     `json:"required"`
+	Exact    bool     `json:"exact"`
+	Hashes   []uint64 `json:"hashes"`
+}
+
+type KeyCandidates struct {
+	Resource    string      `json:"resource"`
+	Columns     []KeyColumn `json:"columns"`
+	UniquePairs [][2]string `json:"uniquePairs,omitempty"`
+	// PrimaryKey is the primary key declared in the database, if any.
+	PrimaryKey []string `json:"primaryKey,omitempty"`
+}
+
+type KeyIndex struct {
+	Package   string          `json:"package"`
+	Resources []KeyCandidates `json:"resources"`
+}
+
+type ForeignKeyReference struct {
+	Package  string `json:"package,omitempty"`
+	Resource string `json:"resource"`
+	Fields   string `json:"fields"`
+}
+
+type ForeignKey struct {
+	Fields    string              `json:"fields"`
+	Reference ForeignKeyReference `json:"reference"`
+}
+
+// keyResource is one resource of one of the data packages being linked.
+type keyResource struct {
+	dir         string
+	pkg         string
+	keys        KeyCandidates
+	primaryKey  []string
+	foreignKeys []ForeignKey
+}
+
+var idNamePattern = regexp.MustCompile(`(?i)(^id$|_id$)|[a-z](Id|ID)$`)
+
+// linkKeys discovers the keys of the resources in the data packages written
+// to the given directories, and adds them to the packages.
+func linkKeys(dirs []string) error {
+	var resources []*keyResource
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		data, err := ioutil.ReadFile(filepath.Join(dir, "keys.json"))
+		if err != nil {
+			return err
+		}
+		var index KeyIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return err
+		}
+		for _, keys := range index.Resources {
+			resources = append(resources, &keyResource{dir: dir, pkg: index.Package, keys: keys})
+		}
+	}
+
+	for _, r := range resources {
+		r.primaryKey = primaryKey(r.keys)
+	}
+	for _, r := range resources {
+		r.foreignKeys = foreignKeys(r, resources)
+	}
+
+	for dir := range seen {
+		if err := writeKeys(dir, resources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkPackageKeys runs linkKeys once the plugins are done, logging rather
+// than failing the request, whose response has already been sent.
+func linkPackageKeys(dirs []string) {
+	err := linkKeys(dirs)
+	if err != nil {
+		log.Println("Failed to link keys:", err)
+	}
+}
+
+// primaryKey is the declared primary key, else the best single-column key,
+// else the first unique pair. Exact counts beat estimated ones, id-like
+// names beat others and integers beat other types.
+func primaryKey(keys KeyCandidates) []string {
+	if len(keys.PrimaryKey) > 0 {
+		return keys.PrimaryKey
+	}
+	var candidates []KeyColumn
+	for _, column := range keys.Columns {
+		if column.Unique && column.Required {
+			candidates = append(candidates, column)
+		}
+	}
+	if len(candidates) > 0 {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return primaryKeyRank(candidates[i]) < primaryKeyRank(candidates[j])
+		})
+		return []string{candidates[0].Field}
+	}
+	if len(keys.UniquePairs) > 0 {
+		return keys.UniquePairs[0][:]
+	}
+	return nil
+}
+
+func primaryKeyRank(column KeyColumn) int {
+	rank := 0
+	if !column.Exact {
+		rank += 4
+	}
+	if !idNamePattern.MatchString(column.Field) {
+		rank += 2
+	}
+	if column.Type != "integer" {
+		rank++
+	}
+	return rank
+}
+
+// foreignKeys finds, for each column of r, the single-column primary key of
+// another resource it references, if any.
+func foreignKeys(r *keyResource, resources []*keyResource) []ForeignKey {
+	var keys []ForeignKey
+	for _, column := range r.keys.Columns {
+		// A plain id column is the resource's own key; tables keyed by id
+		// alike do not reference each other.
+		if strings.EqualFold(column.Field, "id") {
+			continue
+		}
+		var best *keyResource
+		var bestKey KeyColumn
+		var bestMatch foreignKeyMatch
+		for _, target := range resources {
+			if len(target.primaryKey) != 1 {
+				continue
+			}
+			key, ok := keyColumnNamed(target.keys, target.primaryKey[0])
+			if !ok || (target == r && key.Field == column.Field) {
+				continue
+			}
+			if !compatibleKeyTypes(column.Type, key.Type) {
+				continue
+			}
+			containment, ok := kmvContainment(column.Hashes, key.Hashes)
+			if !ok || containment < foreignKeyMinContainment {
+				continue
+			}
+			match := foreignKeyMatch{
+				named:       strings.EqualFold(column.Field, key.Field) || referencesName(column.Field, target.keys.Resource, key.Field),
+				containment: containment,
+				distinct:    key.Distinct,
+			}
+			if best == nil || match.better(bestMatch) {
+				best, bestKey, bestMatch = target, key, match
+			}
+		}
+		if best == nil {
+			continue
+		}
+		reference := ForeignKeyReference{Resource: best.keys.Resource, Fields: bestKey.Field}
+		if best == r {
+			reference.Resource = ""
+		}
+		if best.dir != r.dir {
+			reference.Package = packageReference(r.dir, best)
+		}
+		keys = append(keys, ForeignKey{Fields: column.Field, Reference: reference})
+	}
+	return keys
+}
+
+// foreignKeyMatch ranks the keys whose values contain a column's.
+type foreignKeyMatch struct {
+	named       bool
+	containment float64
+	distinct    int
+}
+
+func (m foreignKeyMatch) better(other foreignKeyMatch) bool {
+	if m.named != other.named {
+		return m.named
+	}
+	if m.containment != other.containment {
+		return m.containment > other.containment
+	}
+	return m.distinct < other.distinct
+}
+
+// packageReference points from the package in dir at the package of
+// target: the relative path of its descriptor, or failing that its name.
+func packageReference(dir string, target *keyResource) string {
+	path, err := filepath.Rel(dir, filepath.Join(target.dir, "datapackage.json"))
+	if err != nil {
+		return target.pkg
+	}
+	return filepath.ToSlash(path)
+}
+
+func keyColumnNamed(keys KeyCandidates, name string) (KeyColumn, bool) {
+	for _, column := range keys.Columns {
+		if column.Field == name {
+			return column, true
+		}
+	}
+	return KeyColumn{}, false
+}
+
+func compatibleKeyTypes(a, b string) bool {
+	numeric := map[string]bool{"integer": true, "number": true}
+	return a == b || numeric[a] && numeric[b]
+}
+
+// referencesName tells whether a column name is made of a resource name,
+// plural or singular, and the name of its key, as customer_id or
+// customersId are for the id of customers.
+func referencesName(column, resource, key string) bool {
+	normalize := func(s string) string {
+		return strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(s))
+	}
+	column, resource, key = normalize(column), normalize(resource), normalize(key)
+	if resource == "" || !strings.HasSuffix(column, key) {
+		return false
+	}
+	prefix := strings.TrimSuffix(column, key)
+	if prefix == "" {
+		return false
+	}
+	for _, name := range []string{resource, strings.TrimSuffix(resource, "s"), strings.TrimSuffix(resource, "es"), strings.TrimSuffix(resource, "ies") + "y"} {
+		if prefix == name {
+			return true
+		}
+	}
+	return false
+}
+
+// kmvContainment estimates the share of the distinct values of a that are
+// also values of b. A full sketch holds every hash of its column up to its
+// largest, so the hashes of a up to the lower of those bounds are looked
+// up in b; ok is false when there are none.
+func kmvContainment(a, b []uint64) (float64, bool) {
+	bound := ^uint64(0)
+	for _, sketch := range [][]uint64{a, b} {
+		if len(sketch) >= keySketchSize && sketch[len(sketch)-1] < bound {
+			bound = sketch[len(sketch)-1]
+		}
+	}
+	inB := make(map[uint64]bool, len(b))
+	for _, h := range b {
+		inB[h] = true
+	}
+	compared, found := 0, 0
+	for _, h := range a {
+		if h > bound {
+			break
+		}
+		compared++
+		if inB[h] {
+			found++
+		}
+	}
+	if compared == 0 {
+		return 0, false
+	}
+	return float64(found) / float64(compared), true
+}
+
+// writeKeys adds the keys found to the resources of the data package in
+// dir. The package is decoded as ordered objects of raw values, so the
+// properties written by the plugin are kept as they are and where they
+// are; keys the plugin read from a database catalog are kept, and only
+// columns they leave out get a foreign key.
+func writeKeys(dir string, resources []*keyResource) error {
+	path := filepath.Join(dir, "datapackage.json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var pkg jsonObject
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return err
+	}
+	var list []jsonObject
+	if raw, ok := pkg.get("resources"); ok {
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return err
+		}
+	}
+	for i, resource := range list {
+		var name string
+		if raw, ok := resource.get("name"); ok {
+			json.Unmarshal(raw, &name)
+		}
+		raw, ok := resource.get("schema")
+		if !ok {
+			continue
+		}
+		var schema jsonObject
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			continue
+		}
+		for _, r := range resources {
+			if r.dir != dir || r.keys.Resource != name {
+				continue
+			}
+			if _, declared := schema.get("primaryKey"); !declared && len(r.primaryKey) > 0 {
+				var key interface{} = r.primaryKey
+				if len(r.primaryKey) == 1 {
+					key = r.primaryKey[0]
+				}
+				if err := schema.set("primaryKey", key); err != nil {
+					return err
+				}
+			}
+			var foreignKeys []json.RawMessage
+			if raw, ok := schema.get("foreignKeys"); ok {
+				json.Unmarshal(raw, &foreignKeys)
+			}
+			covered := map[string]bool{}
+			for _, raw := range foreignKeys {
+				var fk struct {
+					Fields interface{} `json:"fields"`
+				}
+				if json.Unmarshal(raw, &fk) == nil {
+					if field, ok := fk.Fields.(string); ok {
+						covered[field] = true
+					}
+				}
+			}
+			added := 0
+			for _, fk := range r.foreignKeys {
+				if covered[fk.Fields] {
+					continue
+				}
+				raw, err := encodeJSON(fk)
+				if err != nil {
+					return err
+				}
+				foreignKeys = append(foreignKeys, raw)
+				added++
+			}
+			if added > 0 {
+				if err := schema.set("foreignKeys", foreignKeys); err != nil {
+					return err
+				}
+			}
+			log.Printf("Keys of %s: primary %v, %d foreign\n", r.keys.Resource, r.primaryKey, len(r.foreignKeys))
+		}
+		if err := resource.set("schema", schema); err != nil {
+			return err
+		}
+		list[i] = resource
+	}
+	if list != nil {
+		if err := pkg.set("resources", list); err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indentOf(data))
+	if err := encoder.Encode(pkg); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes.TrimSuffix(out.Bytes(), []byte("\n")), 0644)
+}
+
+// jsonObject is a JSON object that keeps its members in order and their
+// values as they were written.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+func (o *jsonObject) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return fmt.Errorf("expected a JSON object")
+	}
+	*o = nil
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		*o = append(*o, jsonMember{key: token.(string), value: value})
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		key, err := encodeJSON(member.key)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(member.value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+func (o jsonObject) get(key string) (json.RawMessage, bool) {
+	for _, member := range o {
+		if member.key == key {
+			return member.value, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces the value of key, or adds key at the end.
+func (o *jsonObject) set(key string, value interface{}) error {
+	raw, err := encodeJSON(value)
+	if err != nil {
+		return err
+	}
+	for i := range *o {
+		if (*o)[i].key == key {
+			(*o)[i].value = raw
+			return nil
+		}
+	}
+	*o = append(*o, jsonMember{key: key, value: raw})
+	return nil
+}
+
+// encodeJSON marshals v without escaping <, > and &, as the plugins write.
+func encodeJSON(v interface{}) (json.RawMessage, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+// indentOf returns the indentation of the first indented line of data.
+func indentOf(data []byte) string {
+	for _, line := range bytes.Split(data, []byte("\n"))[1:] {
+		if indent := len(line) - len(bytes.TrimLeft(line, " \t")); indent > 0 {
+			return string(line[:indent])
+		}
+	}
+	return "\t"
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// hashes is a sketch holding every value from lo to hi.
+func hashes(lo, hi uint64) []uint64 {
+	var h []uint64
+	for v := lo; v <= hi; v++ {
+		h = append(h, v)
+	}
+	return h
+}
+
+func keyed(name, key string, distinct int, sketch []uint64, columns ...KeyColumn) *keyResource {
+	pk := KeyColumn{Field: key, Type: "integer", Distinct: distinct, Unique: true, Required: true, Exact: true, Hashes: sketch}
+	r := &keyResource{dir: "out", keys: KeyCandidates{Resource: name, Columns: append([]KeyColumn{pk}, columns...)}}
+	r.primaryKey = primaryKey(r.keys)
+	return r
+}
+
+func TestForeignKeys(t *testing.T) {
+	customers := keyed("customers", "id", 100, hashes(1, 100))
+	products := keyed("products", "code", 50, hashes(1, 50))
+	orders := keyed("orders", "id", 200, hashes(1, 200),
+		// Named after customers, and only customers hold every value.
+		KeyColumn{Field: "customer_id", Type: "integer", Hashes: hashes(1, 80)},
+		// Not named after any resource: matched on values alone, to the
+		// key with the fewest values among those containing them all.
+		KeyColumn{Field: "buyer", Type: "integer", Hashes: hashes(1, 40)},
+		// Named after products, whose codes contain the values as well as
+		// customers' ids do.
+		KeyColumn{Field: "product_code", Type: "integer", Hashes: hashes(1, 30)},
+		// Values no key contains.
+		KeyColumn{Field: "total", Type: "integer", Hashes: hashes(500, 600)},
+		KeyColumn{Field: "note", Type: "string", Hashes: hashes(1, 10)},
+	)
+	resources := []*keyResource{customers, products, orders}
+
+	got := foreignKeys(orders, resources)
+	want := []ForeignKey{
+		{Fields: "customer_id", Reference: ForeignKeyReference{Resource: "customers", Fields: "id"}},
+		{Fields: "buyer", Reference: ForeignKeyReference{Resource: "products", Fields: "code"}},
+		{Fields: "product_code", Reference: ForeignKeyReference{Resource: "products", Fields: "code"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("foreignKeys() = %+v, want %+v", got, want)
+	}
+}
+
+func TestForeignKeyNamePreferred(t *testing.T) {
+	// The values of customer_id are in both keys; the name picks customers
+	// over the key with fewer values.
+	customers := keyed("customers", "id", 100, hashes(1, 100))
+	stores := keyed("stores", "id", 20, hashes(1, 20))
+	orders := keyed("orders", "order_no", 10, hashes(1000, 1010),
+		KeyColumn{Field: "customer_id", Type: "integer", Hashes: hashes(1, 20)})
+	got := foreignKeys(orders, []*keyResource{stores, customers, orders})
+	if len(got) != 1 || got[0].Reference.Resource != "customers" {
+		t.Errorf("foreignKeys() = %+v, want customer_id to customers", got)
+	}
+}
+
+func TestReferencesName(t *testing.T) {
+	tests := []struct {
+		column, resource, key string
+		want                  bool
+	}{
+		{"customer_id", "customers", "id", true},
+		{"customersId", "customers", "id", true},
+		{"category_id", "categories", "id", true},
+		{"address_id", "addresses", "id", true},
+		{"customer-code", "customer", "code", true},
+		{"id", "customers", "id", false},
+		{"vendor_id", "customers", "id", false},
+		{"customer_name", "customers", "id", false},
+	}
+	for _, test := range tests {
+		if got := referencesName(test.column, test.resource, test.key); got != test.want {
+			t.Errorf("referencesName(%q, %q, %q) = %v, want %v", test.column, test.resource, test.key, got, test.want)
+		}
+	}
+}
+
+func TestKMVContainment(t *testing.T) {
+	defer func(size int) { keySketchSize = size }(keySketchSize)
+	keySketchSize = 4
+
+	tests := []struct {
+		name string
+		a, b []uint64
+		want float64
+		ok   bool
+	}{
+		{"contained", []uint64{1, 2}, []uint64{1, 2, 3}, 1, true},
+		{"half", []uint64{1, 5}, []uint64{1, 2, 3}, 0.5, true},
+		// b is full, so a's hashes past its largest are not compared.
+		{"full sketch", []uint64{2, 4, 9, 11}, []uint64{1, 2, 3, 4}, 1, true},
+		{"nothing to compare", []uint64{9}, []uint64{1, 2, 3, 4}, 0, false},
+		{"empty", nil, []uint64{1}, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := kmvContainment(test.a, test.b)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: kmvContainment() = %v, %v, want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	tests := []struct {
+		name string
+		keys KeyCandidates
+		want []string
+	}{
+		{"declared", KeyCandidates{PrimaryKey: []string{"a", "b"}, Columns: []KeyColumn{{Field: "id", Unique: true, Required: true}}}, []string{"a", "b"}},
+		{"id-like integer", KeyCandidates{Columns: []KeyColumn{
+			{Field: "email", Type: "string", Unique: true, Required: true, Exact: true},
+			{Field: "user_id", Type: "integer", Unique: true, Required: true, Exact: true},
+		}}, []string{"user_id"}},
+		{"exact first", KeyCandidates{Columns: []KeyColumn{
+			{Field: "id", Type: "integer", Unique: true, Required: true},
+			{Field: "code", Type: "string", Unique: true, Required: true, Exact: true},
+		}}, []string{"code"}},
+		{"pair", KeyCandidates{Columns: []KeyColumn{{Field: "a", Required: true}}, UniquePairs: [][2]string{{"a", "b"}}}, []string{"a", "b"}},
+		{"none", KeyCandidates{Columns: []KeyColumn{{Field: "a", Unique: true}}}, nil},
+	}
+	for _, test := range tests {
+		if got := primaryKey(test.keys); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: primaryKey() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
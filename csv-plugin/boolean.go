@@ -0,0 +1,92 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Boolean detection. A column is boolean when every value belongs to one
+// encoding, in any of the letter cases listed for it; the literals actually
+// seen become the field's trueValues and falseValues.
+
+type booleanEncoding struct {
+	trueValues  []string
+	falseValues []string
+}
+
+var booleanEncodings = []booleanEncoding{
+	{[]string{"true", "True", "TRUE"}, []string{"false", "False", "FALSE"}},
+	{[]string{"t", "T"}, []string{"f", "F"}},
+	{[]string{"yes", "Yes", "YES"}, []string{"no", "No", "NO"}},
+	{[]string{"y", "Y"}, []string{"n", "N"}},
+}
+
+// 1/0 is only read as boolean for columns named like a flag, since plenty
+// of counts and codes only take those two values.
+var numericBooleanEncoding = booleanEncoding{[]string{"1"}, []string{"0"}}
+
+var flagNameHint = regexp.MustCompile(`(?i)(^is_|^has_|^can_|_flag$|^flag_|^is[A-Z]|^has[A-Z]|able$|^active$|^enabled$|^deleted$)`)
+
+type booleanDetector struct {
+	encodings []booleanEncoding
+	counts    map[string]int
+}
+
+func newBooleanDetector(name string) *booleanDetector {
+	b := &booleanDetector{encodings: append([]booleanEncoding(nil), booleanEncodings...), counts: map[string]int{}}
+	if flagNameHint.MatchString(name) {
+		b.encodings = append(b.encodings, numericBooleanEncoding)
+	}
+	return b
+}
+
+// add drops the encodings value does not belong to.
+func (b *booleanDetector) add(value string) {
+	if len(b.encodings) == 0 {
+		return
+	}
+	kept := b.encodings[:0]
+	for _, e := range b.encodings {
+		if containsString(e.trueValues, value) || containsString(e.falseValues, value) {
+			kept = append(kept, e)
+		}
+	}
+	b.encodings = kept
+	if len(kept) == 0 {
+		b.counts = nil
+		return
+	}
+	b.counts[value]++
+}
+
+// result returns the true and false literals seen and the stats for a
+// boolean column; ok is false otherwise. When only one side was seen the
+// other gets the encoding's first literal, so the field stays two-valued.
+func (b *booleanDetector) result() (trueValues, falseValues []string, stats *BooleanStats, ok bool) {
+	if len(b.encodings) == 0 || len(b.counts) == 0 {
+		return nil, nil, nil, false
+	}
+	e := b.encodings[0]
+	stats = &BooleanStats{}
+	for value, count := range b.counts {
+		if containsString(e.trueValues, value) {
+			trueValues = append(trueValues, value)
+			stats.TrueCount += count
+		} else {
+			falseValues = append(falseValues, value)
+			stats.FalseCount += count
+		}
+	}
+	if trueValues == nil {
+		trueValues = e.trueValues[:1]
+	}
+	if falseValues == nil {
+		falseValues = e.falseValues[:1]
+	}
+	sort.Strings(trueValues)
+	sort.Strings(falseValues)
+	total := stats.TrueCount + stats.FalseCount
+	stats.TrueProportion = proportion(stats.TrueCount, total)
+	stats.FalseProportion = proportion(stats.FalseCount, total)
+	return trueValues, falseValues, stats, true
+}
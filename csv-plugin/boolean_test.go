@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBooleanDetector(t *testing.T) {
+	tests := []struct {
+		name        string
+		column      string
+		values      []string
+		trueValues  []string
+		falseValues []string
+		stats       *BooleanStats
+	}{
+		{
+			name:        "mixed case",
+			column:      "ok",
+			values:      []string{"true", "False", "TRUE", "true"},
+			trueValues:  []string{"TRUE", "true"},
+			falseValues: []string{"False"},
+			stats:       &BooleanStats{TrueCount: 3, FalseCount: 1, TrueProportion: 0.75, FalseProportion: 0.25},
+		},
+		{
+			name:        "yes and no",
+			column:      "answer",
+			values:      []string{"yes", "no", "No"},
+			trueValues:  []string{"yes"},
+			falseValues: []string{"No", "no"},
+			stats:       &BooleanStats{TrueCount: 1, FalseCount: 2, TrueProportion: 1.0 / 3, FalseProportion: 2.0 / 3},
+		},
+		{
+			name:        "one side seen",
+			column:      "answer",
+			values:      []string{"Y", "y"},
+			trueValues:  []string{"Y", "y"},
+			falseValues: []string{"n"},
+			stats:       &BooleanStats{TrueCount: 2, TrueProportion: 1},
+		},
+		{
+			name:        "flag named ones and zeros",
+			column:      "is_active",
+			values:      []string{"1", "0", "0"},
+			trueValues:  []string{"1"},
+			falseValues: []string{"0"},
+			stats:       &BooleanStats{TrueCount: 1, FalseCount: 2, TrueProportion: 1.0 / 3, FalseProportion: 2.0 / 3},
+		},
+		{name: "ones and zeros", column: "count", values: []string{"1", "0", "0"}},
+		{name: "mixed encodings", column: "ok", values: []string{"true", "no"}},
+		{name: "other values", column: "ok", values: []string{"true", "maybe"}},
+		{name: "no values", column: "ok"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBooleanDetector(test.column)
+			for _, v := range test.values {
+				b.add(v)
+			}
+			trueValues, falseValues, stats, ok := b.result()
+			if ok != (test.stats != nil) {
+				t.Fatalf("result() ok = %v, want %v", ok, test.stats != nil)
+			}
+			if !reflect.DeepEqual(trueValues, test.trueValues) || !reflect.DeepEqual(falseValues, test.falseValues) {
+				t.Errorf("result() values = %q, %q, want %q, %q", trueValues, falseValues, test.trueValues, test.falseValues)
+			}
+			if !reflect.DeepEqual(stats, test.stats) {
+				t.Errorf("result() stats = %+v, want %+v", stats, test.stats)
+			}
+		})
+	}
+}
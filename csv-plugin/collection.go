@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"profiling"
+)
+
+// Array and object detection. Cells holding JSON arrays or objects, or the
+// Python list and dict literals that pandas and friends write out, make the
+// field an array or object; element stats then describe the list items, or
+// the keys of objects.
+
+type collectionDetector struct {
+	kind     string
+	failed   bool
+	count    int
+	total    int
+	min, max int
+	distinct *profiling.DistinctCounter
+	elements *profiling.FrequencySketch
+}
+
+func newCollectionDetector(mode string) *collectionDetector {
+	return &collectionDetector{distinct: profiling.NewDistinctCounter(mode), elements: profiling.NewFrequencySketch()}
+}
+
+func (c *collectionDetector) add(value string) {
+	if c.failed {
+		return
+	}
+	parsed, ok := profiling.ParseCollection(value)
+	kind := ""
+	var elements []string
+	switch v := parsed.(type) {
+	case []interface{}:
+		kind = "array"
+		for _, e := range v {
+			elements = append(elements, elementString(e))
+		}
+	case map[string]interface{}:
+		kind = "object"
+		for key := range v {
+			elements = append(elements, key)
+		}
+	}
+	if !ok || kind == "" || (c.kind != "" && c.kind != kind) {
+		c.failed = true
+		c.distinct, c.elements = nil, nil
+		return
+	}
+	c.kind = kind
+
+	n := len(elements)
+	if c.count == 0 || n < c.min {
+		c.min = n
+	}
+	if c.count == 0 || n > c.max {
+		c.max = n
+	}
+	c.count++
+	c.total += n
+	for _, e := range elements {
+		c.distinct.Add(e)
+		c.elements.Add(e)
+	}
+}
+
+// result returns "array" or "object" with the element stats when every value
+// was one; ok is false otherwise.
+func (c *collectionDetector) result(topK int) (kind string, stats *ElementStats, ok bool) {
+	if c.failed || c.count == 0 {
+		return "", nil, false
+	}
+	return c.kind, &ElementStats{
+		DistinctElements: c.distinct.Count(),
+		AverageLength:    float64(c.total) / float64(c.count),
+		MinLength:        c.min,
+		MaxLength:        c.max,
+		TopElements:      c.elements.Top(topK),
+	}, true
+}
+
+func elementString(e interface{}) string {
+	switch e := e.(type) {
+	case string:
+		return e
+	case float64:
+		return strconv.FormatFloat(e, 'f', -1, 64)
+	case nil:
+		return "null"
+	}
+	encoded, _ := json.Marshal(e)
+	return string(encoded)
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CSV dialect sniffing. A sample from the start of a file is split with
+// every candidate delimiter and quote character; the delimiter giving the
+// most consistent number of fields per record wins, and the records are
+// then examined for the line terminator, escaping style, a header row and
+// preamble lines before the table starts.
+
+var sniffSampleSize = 64 * 1024
+
+var sniffMaxRecords = 200
+
+var candidateDelimiters = []rune{',', '\t', ';', '|'}
+
+var candidateQuotes = []rune{'"', '\''}
+
+// sniffReader sniffs the start of r without consuming it.
+func sniffReader(r *bufio.Reader) (Dialect, error) {
+	sample, err := r.Peek(sniffSampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Dialect{}, err
+	}
+	return sniffDialect(string(sample), len(sample) < sniffSampleSize)
+}
+
+// sniffDialect detects the dialect of sample. complete tells whether the
+// sample is the whole file; otherwise its last record may be cut short and
+// is ignored.
+func sniffDialect(sample string, complete bool) (Dialect, error) {
+	dialect := Dialect{
+		Delimiter:      ",",
+		LineTerminator: detectLineTerminator(sample),
+		QuoteChar:      `"`,
+		DoubleQuote:    true,
+		Header:         true,
+	}
+	if strings.TrimSpace(sample) == "" {
+		return dialect, fmt.Errorf("no data to sniff")
+	}
+
+	bestScore := -1.0
+	var best [][]sniffedField
+	for _, quote := range candidateQuotes {
+		for _, delimiter := range candidateDelimiters {
+			records := splitSample(sample, delimiter, quote, complete)
+			score := delimiterScore(records, sample, delimiter, quote)
+			if score > bestScore {
+				bestScore = score
+				best = records
+				dialect.Delimiter = string(delimiter)
+				dialect.QuoteChar = string(quote)
+			}
+		}
+	}
+	if bestScore <= 0 {
+		// A single column file: keep the comma, there is nothing to split.
+		dialect.Delimiter = ","
+		best = splitSample(sample, ',', '"', complete)
+	}
+
+	width := modalWidth(best)
+	dialect.SkipLines = preambleLines(best, width)
+	table := best
+	if dialect.SkipLines < len(best) {
+		table = best[dialect.SkipLines:]
+	}
+	dialect.Header = detectHeader(table)
+	dialect.DoubleQuote, dialect.EscapeChar = detectEscaping(sample, []rune(dialect.QuoteChar)[0])
+	dialect.SkipInitialSpace = detectInitialSpace(table)
+	return dialect, nil
+}
+
+// sniffedField is a field as read from the sample, remembering whether it
+// was quoted so quoted numbers are not mistaken for numeric data.
+type sniffedField struct {
+	value  string
+	quoted bool
+}
+
+// splitSample splits sample into records, honouring quoted fields that
+// contain delimiters or line breaks. Both doubled quotes and backslash
+// escapes are accepted inside quoted fields.
+func splitSample(sample string, delimiter, quote rune, complete bool) [][]sniffedField {
+	var records [][]sniffedField
+	var record []sniffedField
+	var field strings.Builder
+	inQuotes, quoted := false, false
+	runes := []rune(sample)
+
+	endField := func() {
+		record = append(record, sniffedField{value: field.String(), quoted: quoted})
+		field.Reset()
+		quoted = false
+	}
+	for i := 0; i < len(runes) && len(records) < sniffMaxRecords; i++ {
+		r := runes[i]
+		switch {
+		case inQuotes && r == '\\' && i+1 < len(runes) && runes[i+1] == quote:
+			field.WriteRune(quote)
+			i++
+		case inQuotes && r == quote && i+1 < len(runes) && runes[i+1] == quote:
+			field.WriteRune(quote)
+			i++
+		case r == quote && (inQuotes || field.Len() == 0 || strings.TrimSpace(field.String()) == ""):
+			if !inQuotes {
+				field.Reset()
+				quoted = true
+			}
+			inQuotes = !inQuotes
+		case inQuotes:
+			field.WriteRune(r)
+		case r == delimiter:
+			endField()
+		case r == '\r' || r == '\n':
+			if r == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+				i++
+			}
+			// Blank lines are skipped, as encoding/csv does when parsing.
+			if len(record) == 0 && field.Len() == 0 && !quoted {
+				continue
+			}
+			endField()
+			records = append(records, record)
+			record = nil
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if complete && len(records) < sniffMaxRecords && (field.Len() > 0 || len(record) > 0) {
+		endField()
+		records = append(records, record)
+	}
+	return records
+}
+
+// delimiterScore rates how well the records split: the share of records
+// with the most common field count, zero when that count is one.
+func delimiterScore(records [][]sniffedField, sample string, delimiter, quote rune) float64 {
+	if len(records) == 0 || !strings.ContainsRune(sample, delimiter) {
+		return 0
+	}
+	width := modalWidth(records)
+	if width < 2 {
+		return 0
+	}
+	consistent := 0
+	for _, record := range records {
+		if len(record) == width {
+			consistent++
+		}
+	}
+	score := float64(consistent) / float64(len(records))
+	// Prefer the double quote on ties; it is the CSV default.
+	if quote != '"' {
+		score -= 0.001
+	}
+	return score
+}
+
+func modalWidth(records [][]sniffedField) int {
+	counts := map[int]int{}
+	width, best := 0, 0
+	for _, record := range records {
+		counts[len(record)]++
+		if counts[len(record)] > best || (counts[len(record)] == best && len(record) > width) {
+			width, best = len(record), counts[len(record)]
+		}
+	}
+	return width
+}
+
+// preambleLines counts the records before the first run of records with
+// the table's width, such as titles or notes above the header.
+func preambleLines(records [][]sniffedField, width int) int {
+	for i := range records {
+		if len(records[i]) != width {
+			continue
+		}
+		run := 1
+		for j := i + 1; j < len(records) && j < i+3; j++ {
+			if len(records[j]) == width {
+				run++
+			}
+		}
+		if run >= 2 || i == len(records)-1 {
+			return i
+		}
+	}
+	return 0
+}
+
+// detectHeader votes column by column: a first row cell that does not look
+// like the rest of its column (text above numbers, or a different length
+// in a fixed-length column) is a vote for a header, one that does is a vote
+// against. With no votes either way the file is assumed to have a header.
+func detectHeader(records [][]sniffedField) bool {
+	if len(records) < 2 {
+		return true
+	}
+	first := records[0]
+	votes := 0
+	for col := range first {
+		kind, length := "", -1
+		for _, record := range records[1:] {
+			if col >= len(record) || record[col].value == "" {
+				continue
+			}
+			k := sniffKind(record[col])
+			switch {
+			case kind == "":
+				kind = k
+			case kind != k:
+				kind = "mixed"
+			}
+			l := len([]rune(record[col].value))
+			switch {
+			case length == -1:
+				length = l
+			case length != l:
+				length = -2
+			}
+		}
+		cell := first[col]
+		if cell.value == "" || kind == "" || kind == "mixed" {
+			continue
+		}
+		switch {
+		case kind != "string":
+			if sniffKind(cell) == kind {
+				votes--
+			} else {
+				votes++
+			}
+		case length >= 0:
+			if len([]rune(cell.value)) == length {
+				votes--
+			} else {
+				votes++
+			}
+		}
+	}
+	return votes >= 0
+}
+
+func sniffKind(field sniffedField) string {
+	if field.quoted {
+		return "string"
+	}
+	value := strings.TrimSpace(field.value)
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "number"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "number"
+	}
+	return "string"
+}
+
+// detectLineTerminator returns the first line break in the sample.
+func detectLineTerminator(sample string) string {
+	i := strings.IndexAny(sample, "\r\n")
+	switch {
+	case i < 0:
+		return "\r\n"
+	case sample[i] == '\n':
+		return "\n"
+	case i+1 < len(sample) && sample[i+1] == '\n':
+		return "\r\n"
+	}
+	return "\r"
+}
+
+// detectEscaping reports whether quotes inside quoted fields are doubled
+// and, when they are escaped with a backslash instead, the escape char.
+func detectEscaping(sample string, quote rune) (bool, string) {
+	q := string(quote)
+	doubled := strings.Count(sample, q+q) - strings.Count(sample, q+q+q)
+	backslashed := strings.Count(sample, `\`+q)
+	if backslashed > 0 && backslashed > doubled {
+		return false, `\`
+	}
+	return true, ""
+}
+
+// detectInitialSpace reports whether fields after a delimiter consistently
+// start with a space.
+func detectInitialSpace(records [][]sniffedField) bool {
+	spaced, total := 0, 0
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		for _, field := range record[1:] {
+			if field.quoted || field.value == "" {
+				continue
+			}
+			total++
+			if field.value[0] == ' ' {
+				spaced++
+			}
+		}
+	}
+	return total > 0 && spaced == total
+}
+
+// delimitedExtensions are the file extensions profiled as delimited text.
+var delimitedExtensions = map[string]bool{".csv": true, ".tsv": true, ".psv": true, ".txt": true}
+
+// recordReader reads the records of a delimited file.
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// newDialectReader returns a reader for dialect with the preamble lines
+// already consumed. encoding/csv reads the double quote escaped by doubling
+// it; any other quote or escape character is read by a quotedReader.
+func newDialectReader(r io.Reader, dialect *Dialect) (recordReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	if dialect == nil {
+		return reader, nil
+	}
+	if dialect.Delimiter != "" {
+		reader.Comma = []rune(dialect.Delimiter)[0]
+	}
+	reader.TrimLeadingSpace = dialect.SkipInitialSpace
+	var records recordReader = reader
+	if (dialect.QuoteChar != "" && dialect.QuoteChar != `"`) || dialect.EscapeChar != "" {
+		records = newQuotedReader(r, reader.Comma, dialect)
+	}
+	for i := 0; i < dialect.SkipLines; i++ {
+		_, err := records.Read()
+		if err != nil && err != io.EOF {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+		}
+	}
+	return records, nil
+}
+
+// quotedReader reads delimited text quoted with any quote character, with
+// quotes inside quoted fields doubled or preceded by an escape character
+// which also escapes any other character. Like encoding/csv it skips blank
+// lines and reads a quote inside an unquoted field as text.
+type quotedReader struct {
+	r                *bufio.Reader
+	delimiter, quote rune
+	escape           rune
+	doubleQuote      bool
+	trimLeadingSpace bool
+	line             int
+}
+
+func newQuotedReader(r io.Reader, delimiter rune, dialect *Dialect) *quotedReader {
+	q := &quotedReader{
+		r:                bufio.NewReader(r),
+		delimiter:        delimiter,
+		quote:            '"',
+		doubleQuote:      dialect.DoubleQuote || dialect.EscapeChar == "",
+		trimLeadingSpace: dialect.SkipInitialSpace,
+	}
+	if dialect.QuoteChar != "" {
+		q.quote = []rune(dialect.QuoteChar)[0]
+	}
+	if dialect.EscapeChar != "" {
+		q.escape = []rune(dialect.EscapeChar)[0]
+	}
+	return q
+}
+
+func (q *quotedReader) Read() ([]string, error) {
+	var record []string
+	var field strings.Builder
+	inQuotes, quoted, blank := false, false, true
+	start := q.line + 1
+	for {
+		r, _, err := q.r.ReadRune()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, &csv.ParseError{StartLine: start, Line: q.line + 1, Err: csv.ErrQuote}
+			}
+			if blank {
+				return nil, io.EOF
+			}
+			return append(record, field.String()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r == '\n' || (r == '\r' && !inQuotes) {
+			q.line++
+		}
+		switch {
+		case inQuotes && q.escape != 0 && r == q.escape:
+			next, _, err := q.r.ReadRune()
+			if err != nil {
+				field.WriteRune(r)
+				continue
+			}
+			if next == '\n' {
+				q.line++
+			}
+			field.WriteRune(next)
+		case inQuotes && r == q.quote:
+			if q.doubleQuote {
+				if next, _, err := q.r.ReadRune(); err == nil {
+					if next == q.quote {
+						field.WriteRune(q.quote)
+						continue
+					}
+					q.r.UnreadRune()
+				}
+			}
+			inQuotes = false
+		case inQuotes:
+			field.WriteRune(r)
+		case r == '\r' || r == '\n':
+			if r == '\r' {
+				if next, _, err := q.r.ReadRune(); err == nil && next != '\n' {
+					q.r.UnreadRune()
+				}
+			}
+			if blank {
+				start = q.line + 1
+				continue
+			}
+			return append(record, field.String()), nil
+		case r == q.quote && !quoted && strings.TrimSpace(field.String()) == "":
+			field.Reset()
+			inQuotes, quoted = true, true
+		case r == q.delimiter:
+			record = append(record, field.String())
+			field.Reset()
+			quoted = false
+		case q.trimLeadingSpace && field.Len() == 0 && !quoted && unicode.IsSpace(r):
+		default:
+			field.WriteRune(r)
+		}
+		blank = false
+	}
+}
+
+// delimitedFormat gives the resource format and media type for a file with
+// the extension and detected delimiter.
+func delimitedFormat(ext string, delimiter string) (string, string) {
+	format := strings.TrimPrefix(strings.ToLower(ext), ".")
+	if format == "txt" {
+		switch delimiter {
+		case "\t":
+			format = "tsv"
+		case "|":
+			format = "psv"
+		default:
+			format = "csv"
+		}
+	}
+	if delimiter == "\t" {
+		return format, "text/tab-separated-values"
+	}
+	return format, "text/csv"
+}
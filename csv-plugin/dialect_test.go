@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSniffDialect(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		want   Dialect
+	}{
+		{
+			name:   "comma",
+			sample: "id,name\n1,a\n2,b\n",
+			want:   Dialect{Delimiter: ",", LineTerminator: "\n", QuoteChar: `"`, DoubleQuote: true, Header: true},
+		},
+		{
+			name:   "semicolon crlf",
+			sample: "id;name\r\n1;a,b\r\n2;c,d\r\n",
+			want:   Dialect{Delimiter: ";", LineTerminator: "\r\n", QuoteChar: `"`, DoubleQuote: true, Header: true},
+		},
+		{
+			name:   "tab without header",
+			sample: "1\t2\n3\t4\n5\t6\n",
+			want:   Dialect{Delimiter: "\t", LineTerminator: "\n", QuoteChar: `"`, DoubleQuote: true, Header: false},
+		},
+		{
+			name:   "single quotes",
+			sample: "id|name\n1|'a|b'\n2|'it''s'\n",
+			want:   Dialect{Delimiter: "|", LineTerminator: "\n", QuoteChar: "'", DoubleQuote: true, Header: true},
+		},
+		{
+			name:   "backslash escape",
+			sample: "id,quote\n1,\"say \\\"hi\\\", then go\"\n2,\"plain\"\n",
+			want:   Dialect{Delimiter: ",", LineTerminator: "\n", QuoteChar: `"`, DoubleQuote: false, EscapeChar: `\`, Header: true},
+		},
+		{
+			name:   "preamble",
+			sample: "Exported on 2020-01-01\nid,name,size\n1,a,10\n2,b,20\n3,c,30\n",
+			want:   Dialect{Delimiter: ",", LineTerminator: "\n", QuoteChar: `"`, DoubleQuote: true, Header: true, SkipLines: 1},
+		},
+		{
+			name:   "initial space",
+			sample: "id, name\n1, a\n2, b\n",
+			want:   Dialect{Delimiter: ",", LineTerminator: "\n", QuoteChar: `"`, DoubleQuote: true, Header: true, SkipInitialSpace: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := sniffDialect(test.sample, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("sniffDialect() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSniffDialectEmpty(t *testing.T) {
+	if _, err := sniffDialect(" \n", true); err == nil {
+		t.Error("sniffDialect() of a blank sample succeeded")
+	}
+}
+
+// TestDialectReader reads back files in the dialects the sniffer detects.
+func TestDialectReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		want   [][]string
+	}{
+		{
+			name:   "double quotes",
+			sample: "id,name\n1,\"a,\"\"b\"\"\"\n",
+			want:   [][]string{{"id", "name"}, {"1", `a,"b"`}},
+		},
+		{
+			name:   "single quotes",
+			sample: "id|name\n1|'a|b'\n2|'it''s'\n\n3|\"x\"\n",
+			want:   [][]string{{"id", "name"}, {"1", "a|b"}, {"2", "it's"}, {"3", `"x"`}},
+		},
+		{
+			name:   "backslash escape",
+			sample: "id,quote\r\n1,\"say \\\"hi\\\", then\ngo\"\r\n2,\"plain\"\r\n",
+			want:   [][]string{{"id", "quote"}, {"1", "say \"hi\", then\ngo"}, {"2", "plain"}},
+		},
+		{
+			name:   "preamble and initial space",
+			sample: "Exported on 2020-01-01\nid, name, size\n1, 'a', 10\n2, 'b, c', 20\n3, c, 30\n",
+			want:   [][]string{{"id", "name", "size"}, {"1", "a", "10"}, {"2", "b, c", "20"}, {"3", "c", "30"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dialect, err := sniffDialect(test.sample, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader, err := newDialectReader(strings.NewReader(test.sample), &dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]string
+			for {
+				record, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() with %+v: %v", dialect, err)
+				}
+				got = append(got, record)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("records with %+v = %q, want %q", dialect, got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuotedReaderUnterminated(t *testing.T) {
+	reader, err := newDialectReader(strings.NewReader("a,'b\n"), &Dialect{Delimiter: ",", QuoteChar: "'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(); err == nil {
+		t.Error("Read() of an unterminated quote succeeded")
+	}
+}
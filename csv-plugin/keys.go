@@ -0,0 +1,76 @@
+package main
+
+import (
+	"profiling"
+	"profiling/datapackage"
+)
+
+// compositeHashCells bounds the cell hashes kept for composite keys, four
+// bytes each.
+var compositeHashCells = 1 << 23
+
+// cellHashes keeps a hash of every cell, by column, as the file is read,
+// so that once the composite key candidates are known their pairs are
+// tested without reading the file again. It gives up on files past
+// CompositeKeyRowLimit rows or compositeHashCells cells.
+type cellHashes struct {
+	columns [][]uint32
+	rows    int
+}
+
+func newCellHashes(width int) *cellHashes {
+	return &cellHashes{columns: make([][]uint32, width)}
+}
+
+func (h *cellHashes) add(record []string) {
+	if h.columns == nil {
+		return
+	}
+	h.rows++
+	if h.rows > datapackage.CompositeKeyRowLimit || h.rows*len(h.columns) > compositeHashCells {
+		h.columns = nil
+		return
+	}
+	for i := range h.columns {
+		h.columns[i] = append(h.columns[i], uint32(profiling.HashValue(cell(record, i))))
+	}
+}
+
+// uniquePairs returns the pairs of candidate columns whose combined values
+// never repeat. A hash collision can only hide a pair, never report one.
+func (h *cellHashes) uniquePairs(names []string, candidates []KeyColumn) [][2]string {
+	if h.columns == nil || len(candidates) < 2 {
+		return nil
+	}
+	positions := map[string]int{}
+	for i, name := range names {
+		positions[name] = i
+	}
+	var unique [][2]string
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			a, b := h.columns[positions[candidates[i].Field]], h.columns[positions[candidates[j].Field]]
+			seen := make(map[uint64]bool, h.rows)
+			repeated := false
+			for row := range a {
+				pair := uint64(a[row])<<32 | uint64(b[row])
+				if seen[pair] {
+					repeated = true
+					break
+				}
+				seen[pair] = true
+			}
+			if !repeated {
+				unique = append(unique, [2]string{candidates[i].Field, candidates[j].Field})
+			}
+		}
+	}
+	return unique
+}
+
+func cell(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompositeKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.csv")
+	content := "order,line,qty\n1,1,5\n1,2,5\n2,1,5\n2,2,6\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile := func() [][2]string {
+		resource := Resource{Dialect: &Dialect{}}
+		keys, ok := generate_schema(path, &resource, ioutil.Discard, newProfileOptions(DatabaseCredentials{}))
+		if !ok {
+			t.Fatal("generate_schema() could not read the file")
+		}
+		return keys.UniquePairs
+	}
+
+	// qty repeats with either column, so only order and line make a key.
+	if got, want := profile(), [][2]string{{"order", "line"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unique pairs = %v, want %v", got, want)
+	}
+
+	defer func(cells int) { compositeHashCells = cells }(compositeHashCells)
+	compositeHashCells = 6
+	if got := profile(); got != nil {
+		t.Errorf("unique pairs = %v past the cell limit, want none", got)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"profiling"
+	"profiling/datapackage"
+)
+
+// Streaming column profiles. Rows are read once and every cell is folded
+// into its column's accumulators, so memory depends on the number of
+// columns and distinct values rather than on the size of the file.
+
+// missingValues are read as nulls in every column, and declared as the
+// schema's missingValues so that validation reads them the same way.
+var missingValues = []string{"", "NA", "NaN", "<nil>"}
+
+var isMissing = datapackage.MissingValueSet(missingValues)
+
+var sampleValueCount = 2
+
+// nonCategoricalTypes never get an enum constraint, however few values
+// they take.
+var nonCategoricalTypes = map[string]bool{"boolean": true, "number": true, "array": true, "object": true}
+
+type columnProfile struct {
+	name        string
+	nulls       int
+	present     int
+	hasInts     bool
+	hasFloats   bool
+	hasBools    bool
+	hasStrings  bool
+	numeric     *profiling.NumericProfile
+	distinct    *profiling.DistinctCounter
+	samples     []string
+	frequencies *profiling.FrequencySketch
+	temporal    *profiling.TemporalDetector
+	boolean     *booleanDetector
+	collection  *collectionDetector
+	semantic    *profiling.SemanticClassifier
+	sensitive   *profiling.SensitiveDetector
+	shape       *profiling.ShapeDetector
+	keys        *profiling.KMVSketch
+	lengths     profiling.LengthRange
+	integers    profiling.IntegerRange
+}
+
+func newColumnProfile(name string, options profileOptions) *columnProfile {
+	return &columnProfile{
+		name:        name,
+		numeric:     profiling.NewNumericProfile(),
+		distinct:    profiling.NewDistinctCounter(options.DistinctMode),
+		frequencies: profiling.NewFrequencySketch(),
+		temporal:    profiling.NewTemporalDetector(name),
+		boolean:     newBooleanDetector(name),
+		collection:  newCollectionDetector(options.DistinctMode),
+		semantic:    profiling.NewSemanticClassifier(name),
+		sensitive:   profiling.NewSensitiveDetector(),
+		shape:       profiling.NewShapeDetector(),
+		keys:        profiling.NewKMVSketch(profiling.KeySketchSize),
+	}
+}
+
+// add folds one cell into the profile. Types are inferred as the values
+// arrive: integers, then floats, then the literals true/false, and text.
+func (c *columnProfile) add(value string) {
+	if isMissing[value] {
+		c.nulls++
+		return
+	}
+	c.present++
+	c.lengths.Add(utf8.RuneCountInString(value))
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		c.hasInts = true
+		c.integers.Add(n)
+	} else if _, err := strconv.ParseFloat(value, 64); err == nil {
+		c.hasFloats = true
+	} else if value == "true" || value == "false" {
+		c.hasBools = true
+	} else {
+		c.hasStrings = true
+	}
+	if c.numeric != nil {
+		if c.hasBools || c.hasStrings {
+			c.numeric = nil
+		} else {
+			n, _ := strconv.ParseFloat(value, 64)
+			c.numeric.Add(n)
+		}
+	}
+
+	c.distinct.Add(value)
+	if len(c.samples) < sampleValueCount && !containsString(c.samples, value) {
+		c.samples = append(c.samples, value)
+	}
+	c.frequencies.Add(value)
+	c.temporal.Add(value)
+	c.boolean.add(value)
+	c.collection.add(value)
+	c.semantic.Add(value)
+	c.sensitive.Add(value)
+	c.shape.Add(value)
+	c.keys.Add(profiling.KeyHash(value))
+}
+
+// fieldType maps the values seen to a Table Schema type; a column with
+// any text is a string unless all of it is arrays or objects, temporal or
+// one boolean encoding, as is one with no values at all.
+func (c *columnProfile) fieldType() string {
+	if kind, _, ok := c.collection.result(0); ok {
+		return kind
+	}
+	if kind, _, _, _, ok := c.temporal.Result(); ok {
+		return kind
+	}
+	if _, _, _, ok := c.boolean.result(); ok {
+		return "boolean"
+	}
+	switch {
+	case c.hasStrings, c.hasBools, c.present == 0:
+		return "string"
+	case c.hasFloats:
+		return "number"
+	}
+	return "integer"
+}
+
+// field builds the schema field and its stats once all rows are read.
+func (c *columnProfile) field(options profileOptions) Fields {
+	fieldType := c.fieldType()
+	rows := c.nulls + c.present
+	// An estimate can overshoot; there are never more distinct values than
+	// present ones.
+	unique := c.distinct.Count()
+	if unique > c.present {
+		unique = c.present
+	}
+	method, uniqueError := c.distinct.Method()
+	stats := Stats{
+		NullValueCounts:    c.nulls,
+		PresentValueCounts: c.present,
+		UniqueValueCounts:  unique,
+		UniqueCountMethod:  method,
+		UniqueCountError:   uniqueError,
+		NullProportion:     proportion(c.nulls, rows),
+		UniqueProportion:   proportion(unique, c.present),
+		Sample_value:       c.samples,
+		TopValues:          c.frequencies.Top(options.TopK),
+	}
+	if c.numeric != nil && (fieldType == "integer" || fieldType == "number") {
+		stats.Min, stats.Max, stats.Mean, stats.Std = c.numeric.Summary()
+		stats.Distribution = c.numeric.Distribution(options.Percentiles, options.HistogramBins, options.HistogramType)
+	}
+
+	field := Fields{
+		Name:        c.name,
+		Type:        fieldType,
+		Format:      "default",
+		Description: c.name,
+		Stats:       stats,
+	}
+	if _, format, min, max, ok := c.temporal.Result(); ok {
+		field.Format = format
+		field.Stats.MinDate = min
+		field.Stats.MaxDate = max
+	}
+	if fieldType == "boolean" {
+		field.TrueValues, field.FalseValues, field.Stats.Boolean, _ = c.boolean.result()
+	}
+	if fieldType == "array" || fieldType == "object" {
+		_, field.Stats.Elements, _ = c.collection.result(options.TopK)
+	}
+	if name, confidence, ok := c.semantic.Result(); ok {
+		field.SemanticType = name
+		field.SemanticConfidence = confidence
+		if format, ok := profiling.SemanticFormats[name]; ok && fieldType == "string" && confidence == 1 && c.semantic.Checked() == c.present {
+			field.Format = format
+		}
+	}
+	field.Constraints = datapackage.InferConstraints(field, &c.integers, &c.lengths, c.shape)
+	if categories := c.frequencies.Categories(options.EnumThreshold); categories != nil && !nonCategoricalTypes[fieldType] {
+		field.Stats.Categorical = true
+		field.Constraints.Enum = profiling.EnumValues(fieldType, categories)
+	}
+	field.Sensitivity = datapackage.ClassifySensitivity(c.name, field.SemanticType, c.sensitive, options.SensitivePolicy)
+	datapackage.RedactField(&field, options.SensitivePolicy)
+	return field
+}
+
+// columnNames names the columns from the header, filling in blank names
+// and making repeated ones unique, as field names must be.
+func columnNames(header []string, width int) []string {
+	names := make([]string, width)
+	seen := map[string]bool{}
+	for i := range names {
+		name := ""
+		if i < len(header) {
+			name = header[i]
+		}
+		if name == "" {
+			name = fmt.Sprintf("field%d", i+1)
+		}
+		base := name
+		for n := 2; seen[name]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
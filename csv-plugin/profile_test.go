@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"profiling/datapackage"
+)
+
+// TestProfiledConstraintsHold profiles a column and checks every value
+// against the constraints inferred from it.
+func TestProfiledConstraintsHold(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		min, max interface{}
+	}{
+		{"large ids", []string{"9007199254740993", "9007199254740992", "9007199254740995"}, int64(9007199254740992), int64(9007199254740995)},
+		{"negative ids", []string{"-9007199254740993", "7", "-1"}, int64(-9007199254740993), int64(7)},
+		{"numbers", []string{"1.5", "-2", "10"}, -2.0, 10.0},
+	}
+	options := newProfileOptions(DatabaseCredentials{})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			column := newColumnProfile("id", options)
+			for _, v := range test.values {
+				column.add(v)
+			}
+			field := column.field(options)
+			if field.Constraints.Minimum != test.min || field.Constraints.Maximum != test.max {
+				t.Errorf("range = %#v to %#v, want %#v to %#v", field.Constraints.Minimum, field.Constraints.Maximum, test.min, test.max)
+			}
+			checker := datapackage.NewFieldChecker(field, datapackage.MissingValueSet(nil))
+			for i, v := range test.values {
+				if errs := checker.Check(i+2, v); len(errs) > 0 {
+					t.Errorf("%s breaks its own constraints: %+v", v, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestColumnStats(t *testing.T) {
+	options := newProfileOptions(DatabaseCredentials{})
+	column := newColumnProfile("price", options)
+	for _, v := range []string{"72.5", "73.34", "", "NA", "72.5"} {
+		column.add(v)
+	}
+	stats := column.field(options).Stats
+	if stats.Min != 72.5 || stats.Max != 73.34 || math.Abs(stats.Mean-72.78) > 1e-9 {
+		t.Errorf("min, max, mean = %v, %v, %v, want 72.5, 73.34, 72.78", stats.Min, stats.Max, stats.Mean)
+	}
+	// Proportions are 0-1 fractions: nulls over rows, distinct values over
+	// present ones.
+	if stats.NullValueCounts != 2 || stats.NullProportion != 0.4 {
+		t.Errorf("nulls = %d (%v), want 2 (0.4)", stats.NullValueCounts, stats.NullProportion)
+	}
+	if stats.UniqueValueCounts != 2 || math.Abs(stats.UniqueProportion-2.0/3) > 1e-9 {
+		t.Errorf("unique = %d (%v), want 2 (2/3)", stats.UniqueValueCounts, stats.UniqueProportion)
+	}
+
+	empty := newColumnProfile("empty", options)
+	empty.add("")
+	if stats := empty.field(options).Stats; stats.NullProportion != 1 || stats.UniqueProportion != 0 {
+		t.Errorf("empty column proportions = %v, %v, want 1, 0", stats.NullProportion, stats.UniqueProportion)
+	}
+}
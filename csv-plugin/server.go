@@ -7,86 +7,69 @@ import (
 	"net/rpc"
 	"encoding/json"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
-	"github.com/go-gota/gota/dataframe"
 	"bufio"
 	"io"
+
+	"profiling"
+	"profiling/datapackage"
 )
 
 type DatabaseCredentials struct {
-	SourceDirectory string `json:"sourceDirectory"`
+	SourceDirectory    string        `json:"sourceDirectory"`
+	PackageName        string        `json:"packageName"`
+	PackageTitle       string        `json:"packageTitle"`
+	PackageDescription string        `json:"packageDescription"`
+	Licenses           []License     `json:"licenses"`
+	Sources            []Source      `json:"sources"`
+	Contributors       []Contributor `json:"contributors"`
+	LegacyOutput       bool          `json:"legacyOutput"`
+	ComputeMD5         bool          `json:"computeMD5"`
+	Percentiles        []float64     `json:"percentiles"`
+	HistogramBins      int           `json:"histogramBins"`
+	HistogramType      string        `json:"histogramType"`
+	TopK               int           `json:"topK"`
+	EnumThreshold      int           `json:"enumThreshold"`
+	DistinctMode       string        `json:"distinctMode"`
+	SensitivePolicy    string        `json:"sensitivePolicy"`
+	OutputPath         string        `json:"outputPath"`
+
+	// Files, when Files or Cached is set, are the only files profiled;
+	// Cached are the catalogued profiles of the unchanged ones.
+	Files  []string         `json:"files"`
+	Cached []CachedResource `json:"cached"`
 }
 
-var json_path = "./output"
-
-type Stats struct {
-	Min                int      `json:"min"`
-	Max                int      `json:"max"`
-	Mean               int      `json:"mean"`
-	Std                int      `json:"std"`
-	NullValueCounts    int      `json:"nullValueCounts"`
-	PresentValueCounts int      `json:"present_value_counts"`
-	UniqueValueCounts  int      `json:"uniqueValueCounts"`
-	Sample_value       []string `json:"sample_value"`
-	NullProportion     int      `json:"nullProportion"`
-	UniqueProportion   int      `json:"uniqueProportion"`
-}
-
-type Constraints struct {
-	Required string `json:"required"`
-	Unique   string `json:"unique"`
-}
-type Fields struct {
-	Name        string      `json:"name"`
-	Types       string      `json:"types"`
-	Format      string      `json:"format"`
-	Description string      `json:"description"`
-	Constraints Constraints `json:"constraints"`
-	Stats       Stats       `json:"stats"`
-}
-
-type Schema struct {
-	Fields []Fields `json:"fields"`
-}
-
-type Resources []struct {
-	Profile     string `json:"profile"`
-	Name        string `json:"name"`
-	Path        string `json:"path"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Format      string `json:"format"`
-	Mediatype   string `json:"mediatype"`
-	Encoding    string `json:"encoding"`
-	Bytes       string `json:"bytes"`
-	Hash        string `json:"hash"`
-	Schema      Schema `json:"schema"`
-	Dialect     struct {
-		CaseSensitiveHeader string `json:"caseSensitiveHeader"`
-		Delimiter           string `json:"delimiter"`
-		DoubleQuote         string `json:"doubleQuote"`
-		Header              string `json:"header"`
-		LineTerminator      string `json:"lineTerminator"`
-		QuoteChar           string `json:"quoteChar"`
-		SkipInitialSpace    string `json:"skipInitialSpace"`
-		RowsCount           int    `json:"rowsCount"`
-		ColumnsCount        int    `json:"columnsCount"`
-	} `json:"dialect"`
-	Version string `json:"version"`
-}
+// The descriptor model is shared with the JSON plugin.
+type (
+	License             = datapackage.License
+	Source              = datapackage.Source
+	Contributor         = datapackage.Contributor
+	Stats               = datapackage.Stats
+	Constraints         = datapackage.Constraints
+	Fields              = datapackage.Fields
+	Schema              = datapackage.Schema
+	Dialect             = datapackage.Dialect
+	Resource            = datapackage.Resource
+	Resources           = datapackage.Resources
+	frictionless_struct = datapackage.Package
+	BooleanStats        = datapackage.BooleanStats
+	ElementStats        = datapackage.ElementStats
+	Sensitivity         = datapackage.Sensitivity
+	SensitiveField      = datapackage.SensitiveField
+	SensitivityReport   = datapackage.SensitivityReport
+	ForeignKey          = datapackage.ForeignKey
+	ForeignKeyReference = datapackage.ForeignKeyReference
+	KeyColumn           = datapackage.KeyColumn
+	KeyCandidates       = datapackage.KeyCandidates
+	KeyIndex            = datapackage.KeyIndex
+	CachedResource      = datapackage.CachedResource
+)
 
-type frictionless_struct struct {
-	Profile     string    `json:"profile"`
-	Name        string    `json:"name"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Resources   Resources `json:"resources"`
-}
+var json_path = "./output"
 
 type FileInfo struct {
 	Path       string
@@ -99,56 +82,33 @@ type FileInfo struct {
 
 var frictionless_schema = `{
     "profile": "tabular-data-package",
-    "name": "Experiment Name",
+    "name": "experiment-name",
     "title": "Title of Experiment",
     "description": "Description of Experiment",
+    "version": "1.0.0",
     "resources": [
         {
-            "profile": "data-resource",
+            "profile": "tabular-data-resource",
             "name": "",
             "path": "path of dataset",
             "title": "CSV File Data Resource",
-            "description": "An example of a CSV file",
             "format": "csv",
             "mediatype": "text/csv",
-            "encoding": "UTF-8",
-            "bytes": "2082",
-            "hash": "",
+            "encoding": "utf-8",
             "schema": {
-                "fields": [
-                    {
-                        "name": "column",
-                        "types": "integer",
-                        "format": "default",
-                        "description": "column description",
-                        "constraints": {
-                            "required": "True",
-                            "unique": "True"
-                        },
-                        "stats": {
-                            "min": 0,
-                            "max": 10,
-                            "mean": 5,
-                            "std": 6,
-                            "nullValueCounts": 4,
-                            "present_value_counts": 6,
-                            "uniqueValueCounts": 3
-                        }
-                    }
-                ]
+                "fields": []
             },
             "dialect": {
-                "caseSensitiveHeader": "false",
                 "delimiter": ",",
-                "doubleQuote": "true",
-                "header": "true",
                 "lineTerminator": "\r\n",
-                "quoteChar": "",
-                "skipInitialSpace": "true",
-                "rowsCount": 0,
-                "columnsCount": 0
+                "quoteChar": "\"",
+                "doubleQuote": true,
+                "skipInitialSpace": false,
+                "header": true,
+                "caseSensitiveHeader": false
             },
-            "version": "1.0.0"
+            "rowsCount": 0,
+            "columnsCount": 0
         }
     ]
 }`
@@ -159,7 +119,10 @@ type Config struct {
 	
 }
 
-func csv_plugin(config DatabaseCredentials) {
+// csv_plugin profiles the delimited files under config.SourceDirectory and
+// returns the directory the data package was written to, or "" when none
+// was.
+func csv_plugin(config DatabaseCredentials) string {
 	
 	
 
@@ -167,7 +130,7 @@ func csv_plugin(config DatabaseCredentials) {
 	totalCount, tsvCount, tsvFiles, emptyFiles, err := countCSVFiles(config.SourceDirectory, true)
 	if err != nil {
 		fmt.Println("Error counting CSV files:", err)
-		return
+		return ""
 	}
 
 	fmt.Println("Total CSV files found (including subdirectories):", totalCount)
@@ -198,152 +161,286 @@ func csv_plugin(config DatabaseCredentials) {
 	}
 	// log.Printf("frictionless_data: %+v", frictionless_data.Resources)
 
+	// The template carries a single example resource; every profiled file
+	// gets its own copy of it in the package resources.
+	resource_template := frictionless_data.Resources[0]
+	frictionless_data.Resources = Resources{}
+	setPackageMetadata(&frictionless_data, config)
+	options := newProfileOptions(config)
+	resourceKeys := []KeyCandidates{}
+
 	// ***************************************************
+	selected := datapackage.FileSelector(config.SourceDirectory, config.Files, config.Cached)
 	for _, v := range data_file_path {
+		if !selected(v) {
+			continue
+		}
 		fi, err := os.Stat(v)
 		if err != nil {
 			fmt.Println(err)
-			return
+			return ""
 		}
 		Extension := filepath.Ext(v)
 		if fi.Mode().IsDir() {
 			continue
 		} else {
-			if Extension == ".csv" {
-
-				generate_schema(v, frictionless_data)
-				frictionless_data.Resources[0].Path = v
-				frictionless_data.Resources[0].Name = filepath.Base(v)
-				frictionless_data.Resources[0].Bytes = strconv.Itoa(int(fi.Size()))
-				// fmt.Printf("***************%+v\n", frictionless_data)
-				file, _ := json.MarshalIndent(frictionless_data, "", "\t")
-				json_file_path := json_path + "/" + strings.TrimSuffix(filepath.Base(v), ".csv") + ".json"
-				// fmt.Println(json_file_path)
-				e := ioutil.WriteFile(json_file_path, file, 0644)
-				if e != nil {
-					print(e)
+			if delimitedExtensions[strings.ToLower(Extension)] {
+
+				resource := resource_template
+				dialect := *resource_template.Dialect
+				resource.Dialect = &dialect
+				hasher := profiling.NewContentHash(config.ComputeMD5)
+				keys, ok := generate_schema(v, &resource, hasher, options)
+				if !ok {
+					continue
 				}
-
+				resource.Hash = hasher.SHA256()
+				resource.MD5 = hasher.MD5()
+				resource.Path = v
+				resource.Name = datapackage.ResourceName(v)
+				resource.Title = filepath.Base(v)
+				resource.Bytes = fi.Size()
+				frictionless_data.Resources = append(frictionless_data.Resources, resource)
+				keys.Resource = resource.Name
+				resourceKeys = append(resourceKeys, *keys)
 			}
 		}
 
 	}
 
-}
+	resourceKeys, err = datapackage.AddCached(&frictionless_data, resourceKeys, config.SourceDirectory, config.Cached)
+	if err != nil {
+		fmt.Println("Invalid cached resources:", err)
+		return ""
+	}
 
-func generate_schema(file_name string, frictionless_data frictionless_struct) {
-	csvfile, err := os.Open(file_name)
+	if len(frictionless_data.Resources) == 0 {
+		fmt.Println("No CSV files profiled in:", config.SourceDirectory)
+		return ""
+	}
+
+	frictionless_data.Sensitivity = datapackage.NewSensitivityReport(&frictionless_data, options.SensitivePolicy)
+
+	// fmt.Printf("***************%+v\n", frictionless_data)
+	err = datapackage.ValidatePackage(&frictionless_data)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println("Invalid data package, not written:", err)
+		return ""
+	}
+	var file []byte
+	if config.LegacyOutput {
+		file, _ = json.MarshalIndent(datapackage.LegacyPackage(&frictionless_data), "", "\t")
+	} else {
+		file, _ = json.MarshalIndent(frictionless_data, "", "\t")
+	}
+	json_file_path := json_path + "/datapackage.json"
+	e := ioutil.WriteFile(json_file_path, file, 0644)
+	if e != nil {
+		print(e)
+		return ""
+	}
+	e = datapackage.WriteKeyIndex(json_path, KeyIndex{Package: frictionless_data.Name, Resources: resourceKeys})
+	if e != nil {
+		fmt.Println("Could not write key candidates:", e)
+	}
+	output, _ := filepath.Abs(json_path)
+	return output
+}
 
+// setPackageMetadata fills the package level properties from the request,
+// deriving a name from the source directory when none is supplied.
+func setPackageMetadata(frictionless_data *frictionless_struct, config DatabaseCredentials) {
+	frictionless_data.Name = config.PackageName
+	if frictionless_data.Name == "" {
+		frictionless_data.Name = packageNameFromPath(config.SourceDirectory)
 	}
-	df := dataframe.ReadCSV(csvfile)
-	df_col := []string(df.Names())
-	n_rows, n_cols := df.Dims()
-	// fmt.Println(n_cols, n_rows)
-	field := []Fields{}
-	// fmt.Println(df.Types())
-	// count := 0
-
-	for _, col := range df_col {
-		dat_type := is_numeric_type(col, df)
-		// fmt.Println("dat_type of column", dat_type)
-		var newStats Stats
-		uniq_count, uniq_list := uniqueValueCount(col, df)
-		// fmt.Println("count", col, uniq_count)
-		if dat_type {
-
-			newStats = Stats{
-				Min:  int(df.Col(col).Min()),
-				Max:  int(df.Col(col).Max()),
-				Mean: int(math.Round(df.Col(col).Mean())),
-				Std:  int(math.Round(df.Col(col).StdDev())),
-			}
-		}
-		newStats.NullValueCounts = len(df.Col(col).IsNaN())
-		newStats.PresentValueCounts = len(df.Col(col).Records())
-		newStats.UniqueValueCounts = uniq_count
-		newStats.NullProportion = (len(df.Col(col).IsNaN()) / len(df.Col(col).Records()))
-		newStats.UniqueProportion = (uniq_count / len(df.Col(col).Records()))
-		newStats.Sample_value = getsamplevalues(uniq_list)
-		dat_map := get_type_mapping(col, df)
-		// fmt.Println(dat_map)
-		newFields := Fields{
-			Name:        col,
-			Types:       dat_map,
-			Format:      "default",
-			Description: col,
-			Constraints: Constraints{},
-			Stats:       newStats,
-		}
+	frictionless_data.Title = config.PackageTitle
+	if frictionless_data.Title == "" {
+		frictionless_data.Title = frictionless_data.Name
+	}
+	frictionless_data.Description = config.PackageDescription
+	if frictionless_data.Description == "" {
+		frictionless_data.Description = "Data package for " + config.SourceDirectory
+	}
+	frictionless_data.Licenses = config.Licenses
+	frictionless_data.Sources = config.Sources
+	frictionless_data.Contributors = config.Contributors
+	frictionless_data.StatsVersion = datapackage.StatsVersion
+}
 
-		field = append(field, newFields)
+// profileOptions are the per-request profiling settings, with defaults.
+type profileOptions struct {
+	Percentiles     []float64
+	HistogramBins   int
+	HistogramType   string
+	TopK            int
+	EnumThreshold   int
+	DistinctMode    string
+	SensitivePolicy string
+}
 
+func newProfileOptions(config DatabaseCredentials) profileOptions {
+	options := profileOptions{
+		Percentiles:     config.Percentiles,
+		HistogramBins:   config.HistogramBins,
+		HistogramType:   config.HistogramType,
+		TopK:            config.TopK,
+		EnumThreshold:   config.EnumThreshold,
+		DistinctMode:    config.DistinctMode,
+		SensitivePolicy: config.SensitivePolicy,
 	}
-	frictionless_data.Resources[0].Schema.Fields = field
-	frictionless_data.Resources[0].Dialect.RowsCount = n_rows
-	frictionless_data.Resources[0].Dialect.ColumnsCount = n_cols
+	if len(options.Percentiles) == 0 {
+		options.Percentiles = profiling.DefaultPercentiles
+	}
+	if options.HistogramBins <= 0 {
+		options.HistogramBins = profiling.DefaultHistogramBins
+	}
+	if options.TopK <= 0 {
+		options.TopK = profiling.DefaultTopK
+	}
+	if options.EnumThreshold <= 0 {
+		options.EnumThreshold = profiling.DefaultEnumThreshold
+	}
+	switch options.DistinctMode {
+	case "exact", "approximate", "auto":
+	default:
+		options.DistinctMode = profiling.DefaultDistinctMode
+	}
+	switch options.SensitivePolicy {
+	case "mask", "omit", "none":
+	default:
+		options.SensitivePolicy = datapackage.DefaultSensitivePolicy
+	}
+	return options
 }
 
-func is_numeric_type(col string, df dataframe.DataFrame) bool {
+// packageNameFromPath turns a directory into a package name.
+func packageNameFromPath(dir string) string {
+	name := datapackage.Name(filepath.Base(filepath.Clean(dir)))
+	if name == "" {
+		return "data-package"
+	}
+	return name
+}
+
+// generate_schema profiles one delimited file into resource and returns
+// the key candidates of its columns, reporting whether it holds a table;
+// the file content is also written to hasher as it is read.
+func generate_schema(file_name string, resource *Resource, hasher io.Writer, options profileOptions) (*KeyCandidates, bool) {
+	csvfile, err := os.Open(file_name)
+	if err != nil {
+		log.Fatal(err)
 
-	dat_type := df.Col(col).Type()
-	data_types := []string{"int", "float", "int64", "int8", "float64"}
-	for _, i := range data_types {
-		if i == string(dat_type) {
-			return true
+	}
+	defer csvfile.Close()
+	content, encoding := profiling.NewUTF8Reader(io.TeeReader(csvfile, hasher))
+	buffered := bufio.NewReaderSize(content, sniffSampleSize)
+	dialect, err := sniffReader(buffered)
+	if err != nil {
+		fmt.Println("Could not sniff dialect of", file_name+":", err)
+	}
+	*resource.Dialect = dialect
+	resource.Format, resource.Mediatype = delimitedFormat(filepath.Ext(file_name), dialect.Delimiter)
+	reader, err := newDialectReader(buffered, &dialect)
+	if err != nil {
+		fmt.Println("Could not read", file_name+":", err)
+		return nil, false
+	}
+	resource.Encoding = encoding.Encoding
+
+	var header []string
+	if dialect.Header {
+		header, err = reader.Read()
+		if err == io.EOF {
+			fmt.Println("No delimited table found in:", file_name)
+			return nil, false
+		}
+		if err != nil {
+			fmt.Println("Could not parse", file_name+":", err)
+			return nil, false
 		}
+		header = append([]string(nil), header...)
 	}
-	return false
-}
 
-func uniqueValueCount(col string, df dataframe.DataFrame) (int, []string) {
-	found := false
-	var uniquelist []string
-	records := (df.Col(col).Records())
-	// fmt.Println("\nrecords", len(records))
-	for _, i := range records {
-		found = false
-		for _, k := range uniquelist {
-			if i == k {
-				// fmt.Println(i, k)
-				found = true
+	var columns []*columnProfile
+	var hashes *cellHashes
+	n_rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Println("Could not parse", file_name+":", err)
+			return nil, false
+		}
+		if columns == nil {
+			width := len(header)
+			if width == 0 {
+				width = len(record)
+			}
+			for _, name := range columnNames(header, width) {
+				columns = append(columns, newColumnProfile(name, options))
 			}
+			hashes = newCellHashes(width)
 		}
-		if !found {
-			uniquelist = append(uniquelist, i)
+		n_rows++
+		hashes.add(record)
+		// Short rows leave the missing cells null; extra cells are ignored.
+		for i, column := range columns {
+			value := ""
+			if i < len(record) {
+				value = record[i]
+			}
+			column.add(value)
 		}
 	}
-	// fmt.Println("\ncount****", col, len(uniquelist))
-	return len(uniquelist), uniquelist
-}
-
-// func (s *SeriesGeneric) NilCount(opts ...NilCountOptions) (int, error)
-func getsamplevalues(uniq_list []string) []string {
-	var sample_value []string
-	if len(uniq_list) > 0 {
-		if len(uniq_list) > 2 {
-			sample_value = append(sample_value, uniq_list[0])
-			sample_value = append(sample_value, uniq_list[1])
-		} else {
-			sample_value = append(sample_value, uniq_list[0])
+	if columns == nil {
+		for _, name := range columnNames(header, len(header)) {
+			columns = append(columns, newColumnProfile(name, options))
 		}
 	}
-	return sample_value
-}
 
-func get_type_mapping(col string, df dataframe.DataFrame) string {
-	var value_dat string
-	type_mappings := map[string]string{"int64": "integer", "int32": "integer", "float64": "integer", "float32": "integer",
-		"float": "integer", "string": "string", "object": "string", "datetime64": "date", "category": "string", "uint32": "integer", "uint64": "integer"}
-	dat_type := df.Col(col).Type()
-	for key, value := range type_mappings {
-		if key == string(dat_type) {
-			value_dat = value
+	// Invalid bytes are only all counted once the whole file is read.
+	resource.InvalidByteCount = encoding.InvalidCount
+	resource.InvalidSequences = encoding.InvalidSequences
+	if encoding.InvalidCount > 0 {
+		fmt.Printf("%s: %d invalid %s byte sequence(s), first at offset %d\n",
+			file_name, encoding.InvalidCount, encoding.Encoding, encoding.InvalidSequences[0].Offset)
+	}
+	n_cols := len(columns)
+	if n_cols == 0 || (strings.ToLower(filepath.Ext(file_name)) == ".txt" && n_cols < 2) {
+		fmt.Println("No delimited table found in:", file_name)
+		return nil, false
+	}
+
+	field := []Fields{}
+	keys := &KeyCandidates{Columns: []KeyColumn{}}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		f := column.field(options)
+		field = append(field, f)
+		names[i] = column.name
+		if key, ok := datapackage.NewKeyColumn(f, column.keys, datapackage.KeyTypes); ok {
+			keys.Columns = append(keys.Columns, key)
 		}
 	}
-	return value_dat
+	if hashes != nil {
+		keys.UniquePairs = hashes.uniquePairs(names, datapackage.CompositeCandidates(keys.Columns))
+	}
+	resource.Schema.Fields = field
+	resource.Schema.MissingValues = missingValues
+	resource.RowsCount = n_rows
+	resource.ColumnsCount = n_cols
+	return keys, true
+}
 
+// proportion is part/whole as a 0-1 fraction, zero for an empty whole.
+func proportion(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
 }
 
 
@@ -412,6 +509,8 @@ func readJSONConfig(filePath string) (Config, error) {
 }
 
 
+// countCSVFiles counts the delimited files by extension, without reading
+// them: their dialect is sniffed when they are profiled.
 func countCSVFiles(dirPath string, includeSubdirs bool) (int, int, []string, []FileInfo, error) {
 	csvFileCount := 0
 	tsvFileCount := 0
@@ -423,11 +522,9 @@ func countCSVFiles(dirPath string, includeSubdirs bool) (int, int, []string, []F
 			return err
 		}
 
-		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), ".csv") {
-			// Get the delimiter and append the path to the TSV files array if the delimiter is a tab
-			delimiter, err := getCSVFileDelimiter(path)
-			if err != nil {
-				// Handle empty delimiter files
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		if info.Mode().IsRegular() && delimitedExtensions[ext] {
+			if info.Size() == 0 {
 				fmt.Printf("Empty file: %s\n", path)
 				fmt.Println("-----------------------------")
 				filesInfo = append(filesInfo, FileInfo{
@@ -441,7 +538,7 @@ func countCSVFiles(dirPath string, includeSubdirs bool) (int, int, []string, []F
 				return nil
 			}
 
-			if delimiter == "\t" {
+			if ext == ".tsv" {
 				tsvFiles = append(tsvFiles, path)
 				tsvFileCount++
 			}
@@ -453,21 +550,13 @@ func countCSVFiles(dirPath string, includeSubdirs bool) (int, int, []string, []F
 				Size:       info.Size(),
 				ModTime:    info.ModTime(),
 				IsCSV:      true,
-				IsTSV:      delimiter == "\t",
+				IsTSV:      ext == ".tsv",
 				IsDelimiterEmpty: false,
 			})
 
 			fmt.Printf("File: %s\n", path)
 			fmt.Printf("Size: %d bytes\n", info.Size())
 			fmt.Printf("Last Modified: %s\n", info.ModTime().Format(time.RFC3339))
-			if delimiter == "\t"{
-				fmt.Printf("Delimeter: TAB\n")	
-			}else if (delimiter == "," || delimiter == "") {
-				fmt.Println("Delimeter: COMMA\n")
-			}else {
-				fmt.Println("Invalid delimeter file")
-			}
-			// fmt.Printf("Delimeter: %s\n",delimiter)
 			fmt.Println("-----------------------------")
 		}
 
@@ -485,39 +574,6 @@ func countCSVFiles(dirPath string, includeSubdirs bool) (int, int, []string, []F
 	return csvFileCount, tsvFileCount, tsvFiles, filesInfo, nil
 }
 
-func getCSVFileDelimiter(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	reader := bufio.NewReader(file)
-	firstLine, err := reader.ReadString('\n')
-	if err != nil && err != io.EOF {
-		return "", err
-	}
-
-	delimiter := detectDelimiter(firstLine)
-	if delimiter == "" {
-		return "", fmt.Errorf("unable to detect delimiter in file: %s", filePath)
-	}
-
-	return delimiter, nil
-}
-
-func detectDelimiter(line string) string {
-	delimiters := [3]string{",", "\t"}
-
-	for _, delimiter := range delimiters {
-		if strings.Contains(line, delimiter) {
-			return delimiter
-		}
-	}
-
-	return ""
-}
-
 
 
 type MyRPCServer struct{}
@@ -530,7 +586,20 @@ func (s *MyRPCServer) GetData(args DatabaseCredentials, reply *DatabaseCredentia
 	
 
 	*reply = args // Set the reply value
-	csv_plugin(args)
+	reply.OutputPath = csv_plugin(args)
+	return nil
+}
+
+// Validate checks a CSV file against an expected Table Schema and replies
+// with a row and column level error report.
+func (s *MyRPCServer) Validate(args ValidationRequest, reply *ValidationReport) error {
+	fmt.Println("Received validation request:", args)
+
+	report, err := validateCSV(args)
+	if err != nil {
+		return err
+	}
+	*reply = *report
 	return nil
 }
 
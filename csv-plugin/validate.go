@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"profiling"
+	"profiling/datapackage"
+)
+
+// The validation request and report are shared with the other plugins.
+type (
+	ValidationRequest = datapackage.ValidationRequest
+	ValidationError   = datapackage.ValidationError
+	ValidationReport  = datapackage.ValidationReport
+)
+
+// validateCSV checks every row of the file against the schema: header
+// names, cell counts, types and field constraints.
+func validateCSV(req ValidationRequest) (*ValidationReport, error) {
+	schema, dialect, err := datapackage.LoadSchema(req, json_path)
+	if err != nil {
+		return nil, err
+	}
+	maxErrors := req.MaxErrors
+	if maxErrors <= 0 {
+		maxErrors = datapackage.DefaultMaxErrors
+	}
+
+	file, err := os.Open(req.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, _ := profiling.NewUTF8Reader(file)
+	buffered := bufio.NewReaderSize(content, sniffSampleSize)
+	if dialect == nil {
+		// An inline schema, or one from a descriptor without a dialect,
+		// says nothing about the file layout, so it is sniffed as when
+		// the file was profiled.
+		sniffed, err := sniffReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		dialect = &sniffed
+	}
+	reader, err := newDialectReader(buffered, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	report := datapackage.NewValidationReport(req.DataPath)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a header row the fields are matched by position and the first
+	// record is data.
+	positions := make([]int, len(schema.Fields))
+	var first []string
+	if dialect != nil && !dialect.Header {
+		first, header = header, make([]string, len(header))
+		for i := range header {
+			header[i] = fmt.Sprintf("%d", i)
+		}
+		for i, field := range schema.Fields {
+			if i < len(header) {
+				header[i] = field.Name
+			}
+		}
+	} else {
+		// Blank and repeated names are filled in as the profiler does.
+		header = columnNames(header, len(header))
+	}
+
+	// Match header cells to schema fields by name.
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	for i, field := range schema.Fields {
+		pos, ok := columns[field.Name]
+		if !ok {
+			pos = -1
+			report.Add(ValidationError{Row: 1, Field: field.Name, Type: "missing-field",
+				Message: fmt.Sprintf("field %q is missing from the header", field.Name)}, maxErrors)
+		}
+		positions[i] = pos
+		delete(columns, field.Name)
+	}
+	for name := range columns {
+		report.Add(ValidationError{Row: 1, Field: name, Type: "extra-field",
+			Message: fmt.Sprintf("column %q is not in the schema", name)}, maxErrors)
+	}
+
+	missing := datapackage.MissingValueSet(schema.MissingValues)
+	checkers := make([]*datapackage.FieldChecker, len(schema.Fields))
+	for i, field := range schema.Fields {
+		checkers[i] = datapackage.NewFieldChecker(field, missing)
+	}
+
+	row := 1
+	if first != nil {
+		row = 0
+	}
+	for {
+		record := first
+		first = nil
+		if record == nil {
+			record, err = reader.Read()
+			if err == io.EOF {
+				break
+			}
+		}
+		row++
+		if err != nil {
+			report.Add(ValidationError{Row: row, Type: "source-error", Message: err.Error()}, maxErrors)
+			continue
+		}
+		report.RowsChecked++
+		if len(record) > len(header) {
+			report.Add(ValidationError{Row: row, Type: "extra-cell",
+				Message: fmt.Sprintf("row has %d cells, header has %d", len(record), len(header))}, maxErrors)
+		}
+		for i, checker := range checkers {
+			pos := positions[i]
+			if pos < 0 {
+				continue
+			}
+			if pos >= len(record) {
+				report.Add(ValidationError{Row: row, Field: schema.Fields[i].Name, Type: "missing-cell",
+					Message: "row has no cell for this field"}, maxErrors)
+				continue
+			}
+			for _, e := range checker.Check(row, record[pos]) {
+				report.Add(e, maxErrors)
+			}
+		}
+	}
+	return report, nil
+}
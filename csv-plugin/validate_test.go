@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const validateSchema = `{"fields": [
+	{"name": "id", "type": "integer", "constraints": {"required": true, "unique": true}},
+	{"name": "name", "type": "string"}
+]}`
+
+func TestValidateCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		schema  string
+		want    []string
+	}{
+		{
+			name:    "valid",
+			file:    "valid.csv",
+			content: "id,name\n1,a\n2,b\n",
+			want:    []string{},
+		},
+		{
+			name:    "cell errors",
+			file:    "cells.csv",
+			content: "id,name\n1,a\nx,b\n,c\n1,d\n",
+			want:    []string{"required", "type", "unique"},
+		},
+		{
+			name:    "header errors",
+			file:    "header.csv",
+			content: "id,size\n1,10\n",
+			want:    []string{"extra-field", "missing-field"},
+		},
+		{
+			name:    "row length",
+			file:    "rows.csv",
+			content: "id,name\n1,a,extra\n2\n",
+			want:    []string{"extra-cell", "missing-cell"},
+		},
+		{
+			name:    "source error",
+			file:    "quotes.csv",
+			content: "id,name\n1,\"a\"b\n2,c\n",
+			want:    []string{"source-error"},
+		},
+		{
+			// Without a dialect in the schema the delimiter is sniffed.
+			name:    "tab separated",
+			file:    "tabs.tsv",
+			content: "id\tname\n1\ta, b\n2\tc\n",
+			want:    []string{},
+		},
+		{
+			name:    "pipe separated",
+			file:    "pipes.psv",
+			content: "id|name\n1|a\n1|b\n",
+			want:    []string{"unique"},
+		},
+		{
+			name:    "descriptor dialect",
+			file:    "semicolons.csv",
+			content: "id;name\n1;a\n2;b\n",
+			schema:  `{"dialect": {"delimiter": ";", "header": true}, "schema": ` + validateSchema + `}`,
+			want:    []string{},
+		},
+		{
+			name:    "large ids",
+			file:    "large.csv",
+			content: "id,name\n9007199254740992,a\n9007199254740993,b\n",
+			want:    []string{},
+		},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.file)
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			schema := test.schema
+			if schema == "" {
+				schema = validateSchema
+			}
+			report, err := validateCSV(ValidationRequest{DataPath: path, Schema: schema})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range report.Errors {
+				got = append(got, e.Type)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("errors = %q, want %q (%+v)", got, test.want, report.Errors)
+			}
+			if report.Valid != (len(test.want) == 0) {
+				t.Errorf("valid = %v with errors %q", report.Valid, got)
+			}
+		})
+	}
+}
+
+func TestValidateCSVMaxErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.csv")
+	if err := os.WriteFile(path, []byte("id,name\nx,a\ny,b\nz,c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := validateCSV(ValidationRequest{DataPath: path, Schema: validateSchema, MaxErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ErrorCount != 3 || len(report.Errors) != 2 || report.ErrorCounts["type"] != 3 || report.FieldErrors["id"] != 3 {
+		t.Errorf("report = %+v, want 3 type errors on id with 2 examples", report)
+	}
+	if report.RowsChecked != 3 {
+		t.Errorf("rowsChecked = %d, want 3", report.RowsChecked)
+	}
+}
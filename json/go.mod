@@ -0,0 +1,7 @@
+module jsonplugin
+
+go 1.18
+
+require profiling v0.0.0
+
+replace profiling => ../profiling
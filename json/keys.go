@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+
+	"profiling"
+	"profiling/datapackage"
+)
+
+// Key candidates. Next to datapackage.json the plugin writes keys.json,
+// describing for every resource the columns that could be primary or
+// foreign keys. Each column carries a KMV sketch, the smallest distinct
+// value hashes, from which the API estimates how far the values of one
+// column are contained in another's, across files and plugins.
+
+// jsonKeyTypes are the field types whose values can identify a row. JSON
+// has no integers, so ids are typed as numbers.
+var jsonKeyTypes = map[string]bool{"integer": true, "number": true, "string": true, "date": true, "datetime": true}
+
+// uniquePairs returns the pairs of candidate columns whose combined values
+// never repeat.
+func uniquePairs(data []map[string]interface{}, candidates []KeyColumn) [][2]string {
+	if len(candidates) < 2 || len(data) > datapackage.CompositeKeyRowLimit {
+		return nil
+	}
+	var unique [][2]string
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			a, b := candidates[i].Field, candidates[j].Field
+			seen := map[uint64]bool{}
+			dup := false
+			for _, obj := range data {
+				va, _ := keyValue(obj[a])
+				vb, _ := keyValue(obj[b])
+				h := profiling.HashValue(va + "\x00" + vb)
+				if seen[h] {
+					dup = true
+					break
+				}
+				seen[h] = true
+			}
+			if !dup {
+				unique = append(unique, [2]string{a, b})
+			}
+		}
+	}
+	return unique
+}
+
+// keyValue is the text of a scalar value, as it would be written in a CSV
+// file, so that keys compare across plugins; ok is false for null, lists
+// and objects.
+func keyValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -1,146 +1,97 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/rpc"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 	//"github.com/go-gota/gota/dataframe"
+
+	"profiling"
+	"profiling/datapackage"
 )
 
 type DatabaseCredentials struct {
-	SourceDirectory string `json:"sourceDirectory"`
-}
-
-var json_path = "/home/swati/json/output/"
-
-type Stats struct {
-	Min                int      `json:"min"`
-	Max                int      `json:"max"`
-	Mean               int      `json:"mean"`
-	Std                int      `json:"std"`
-	NullValueCounts    int      `json:"nullValueCounts"`
-	PresentValueCounts int      `json:"present_value_counts"`
-	UniqueValueCounts  int      `json:"uniqueValueCounts"`
-	Sample_value       []string `json:"sample_value"`
-	NullProportion     int      `json:"nullProportion"`
-	UniqueProportion   int      `json:"uniqueProportion"`
+	SourceDirectory    string        `json:"sourceDirectory"`
+	PackageName        string        `json:"packageName"`
+	PackageTitle       string        `json:"packageTitle"`
+	PackageDescription string        `json:"packageDescription"`
+	Licenses           []License     `json:"licenses"`
+	Sources            []Source      `json:"sources"`
+	Contributors       []Contributor `json:"contributors"`
+	LegacyOutput       bool          `json:"legacyOutput"`
+	ComputeMD5         bool          `json:"computeMD5"`
+	Percentiles        []float64     `json:"percentiles"`
+	HistogramBins      int           `json:"histogramBins"`
+	HistogramType      string        `json:"histogramType"`
+	TopK               int           `json:"topK"`
+	EnumThreshold      int           `json:"enumThreshold"`
+	DistinctMode       string        `json:"distinctMode"`
+	SensitivePolicy    string        `json:"sensitivePolicy"`
+	OutputPath         string        `json:"outputPath"`
+
+	// Files, when Files or Cached is set, are the only files profiled;
+	// Cached are the catalogued profiles of the unchanged ones.
+	Files  []string         `json:"files"`
+	Cached []CachedResource `json:"cached"`
 }
 
-type Constraints struct {
-	Required string `json:"required"`
-	Unique   string `json:"unique"`
-}
-
-type Fields struct {
-	Name        string      `json:"name"`
-	Types       string      `json:"types"`
-	Format      string      `json:"format"`
-	Description string      `json:"description"`
-	Constraints Constraints `json:"constraints"`
-	Stats       Stats       `json:"stats"`
-}
-
-type Schema struct {
-	Fields []Fields `json:"fields"`
-}
-
-
-
-type Resources []struct {
-	Profile     string `json:"profile"`
-	Name        string `json:"name"`
-	Path        string `json:"path"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Format      string `json:"format"`
-	Mediatype   string `json:"mediatype"`
-	Encoding    string `json:"encoding"`
-	Bytes       string `json:"bytes"`
-	Hash        string `json:"hash"`
-	Schema      Schema `json:"schema"`
-	Dialect     struct {
-		CaseSensitiveHeader string `json:"caseSensitiveHeader"`
-		Delimiter           string `json:"delimiter"`
-		DoubleQuote         string `json:"doubleQuote"`
-		Header              string `json:"header"`
-		LineTerminator      string `json:"lineTerminator"`
-		QuoteChar           string `json:"quoteChar"`
-		SkipInitialSpace    string `json:"skipInitialSpace"`
-		RowsCount           int    `json:"rowsCount"`
-		ColumnsCount        int    `json:"columnsCount"`
-	} `json:"dialect"`
-	Version string `json:"version"`
-}
+// The descriptor model is shared with the CSV plugin.
+type (
+	License             = datapackage.License
+	Source              = datapackage.Source
+	Contributor         = datapackage.Contributor
+	Stats               = datapackage.Stats
+	Constraints         = datapackage.Constraints
+	Fields              = datapackage.Fields
+	Schema              = datapackage.Schema
+	Dialect             = datapackage.Dialect
+	Resource            = datapackage.Resource
+	Resources           = datapackage.Resources
+	frictionless_struct = datapackage.Package
+	Sensitivity         = datapackage.Sensitivity
+	SensitiveField      = datapackage.SensitiveField
+	SensitivityReport   = datapackage.SensitivityReport
+	ForeignKey          = datapackage.ForeignKey
+	ForeignKeyReference = datapackage.ForeignKeyReference
+	KeyColumn           = datapackage.KeyColumn
+	KeyCandidates       = datapackage.KeyCandidates
+	KeyIndex            = datapackage.KeyIndex
+	CachedResource      = datapackage.CachedResource
+)
 
-type frictionless_struct struct {
-	Profile     string    `json:"profile"`
-	Name        string    `json:"name"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Resources   Resources `json:"resources"`
-}
+var json_path = "/home/swati/json/output/"
 
 var frictionless_schema = `{
 	"profile": "tabular-data-package",
-	"name": "Experiment Name",
+	"name": "experiment-name",
 	"title": "Title of Experiment",
 	"description": "Description of Experiment",
+	"version": "1.0.0",
 	"resources": [
 		{
-			"profile": "data-resource",
+			"profile": "tabular-data-resource",
 			"name": "",
 			"path": "path of dataset",
 			"title": "JSON File Data Resource",
-			"description": "An example of a JSON file",
 			"format": "json",
 			"mediatype": "application/json",
-			"encoding": "UTF-8",
-			"bytes": "2082",
-			"hash": "",
+			"encoding": "utf-8",
 			"schema": {
-				"fields": [
-					{
-						"name": "column",
-						"types": "integer",
-						"format": "default",
-						"description": "column description",
-						"constraints": {
-							"required": "True",
-							"unique": "True"
-						},
-						"stats": {
-							"min": 0,
-							"max": 10,
-							"mean": 5,
-							"std": 6,
-							"nullValueCounts": 4,
-							"present_value_counts": 6,
-							"uniqueValueCounts": 3
-						}
-					}
-				]
-			},
-			"dialect": {
-				"caseSensitiveHeader": "false",
-				"delimiter": ",",
-				"doubleQuote": "true",
-				"header": "true",
-				"lineTerminator": "\r\n",
-				"quoteChar": "",
-				"skipInitialSpace": "true",
-				"rowsCount": 0,
-				"columnsCount": 0
+				"fields": []
 			},
-			"version": "1.0.0"
+			"rowsCount": 0,
+			"columnsCount": 0
 		}
 	]
 }`
@@ -158,14 +109,17 @@ type FileInfo struct {
 }
 
 
-func json_plugin(config DatabaseCredentials) {
+// json_plugin profiles the JSON files under config.SourceDirectory and
+// returns the directory the data package was written to, or "" when none
+// was.
+func json_plugin(config DatabaseCredentials) string {
 
 
 	// Get file information for the source directory and its subdirectories
 	fileInfoList, err := getFileInformation(config.SourceDirectory)
 	if err != nil {
 		fmt.Println("Error retrieving file information:", err)
-		return
+		return ""
 	}
 
 	// Print file counts and information
@@ -202,7 +156,19 @@ func json_plugin(config DatabaseCredentials) {
 		log.Fatal("error unmarshaling json: ", err)
 	}
 
+	// The template carries a single example resource; every profiled file
+	// gets its own copy of it in the package resources.
+	resource_template := frictionless_data.Resources[0]
+	frictionless_data.Resources = Resources{}
+	setPackageMetadata(&frictionless_data, config)
+	options := newProfileOptions(config)
+	resourceKeys := []KeyCandidates{}
+
+	selected := datapackage.FileSelector(config.SourceDirectory, config.Files, config.Cached)
 	for _, v := range data_file_path {
+		if !selected(v) {
+			continue
+		}
 		fi, err := os.Stat(v)
 		if err != nil {
 			fmt.Println(err)
@@ -215,91 +181,330 @@ func json_plugin(config DatabaseCredentials) {
 			continue
 		} else {
 			if Extension == ".json" {
-				generate_schema(v, frictionless_data)
-				frictionless_data.Resources[0].Path = v
-				frictionless_data.Resources[0].Name = filepath.Base(v)
-				frictionless_data.Resources[0].Bytes = strconv.Itoa(int(fi.Size()))
-
-				file, _ := json.MarshalIndent(frictionless_data, "", "\t")
-				json_file_path := json_path + "/" + strings.TrimSuffix(filepath.Base(v), ".json") + ".json"
-				e := ioutil.WriteFile(json_file_path, file, 0644)
-				if e != nil {
-					print(e)
+				resource := resource_template
+				hasher := profiling.NewContentHash(config.ComputeMD5)
+				keys, ok := generate_schema(v, &resource, hasher, options)
+				if !ok {
+					continue
 				}
+				resource.Hash = hasher.SHA256()
+				resource.MD5 = hasher.MD5()
+				resource.Path = v
+				resource.Name = datapackage.ResourceName(v)
+				resource.Title = filepath.Base(v)
+				resource.Bytes = fi.Size()
+				frictionless_data.Resources = append(frictionless_data.Resources, resource)
+				keys.Resource = resource.Name
+				resourceKeys = append(resourceKeys, *keys)
 			}
 		}
 	}
+
+	resourceKeys, err = datapackage.AddCached(&frictionless_data, resourceKeys, config.SourceDirectory, config.Cached)
+	if err != nil {
+		fmt.Println("Invalid cached resources:", err)
+		return ""
+	}
+
+	if len(frictionless_data.Resources) == 0 {
+		fmt.Println("No JSON files profiled in:", config.SourceDirectory)
+		return ""
+	}
+
+	frictionless_data.Sensitivity = datapackage.NewSensitivityReport(&frictionless_data, options.SensitivePolicy)
+
+	err = datapackage.ValidatePackage(&frictionless_data)
+	if err != nil {
+		fmt.Println("Invalid data package, not written:", err)
+		return ""
+	}
+	var file []byte
+	if config.LegacyOutput {
+		file, _ = json.MarshalIndent(datapackage.LegacyPackage(&frictionless_data), "", "\t")
+	} else {
+		file, _ = json.MarshalIndent(frictionless_data, "", "\t")
+	}
+	json_file_path := json_path + "/datapackage.json"
+	e := ioutil.WriteFile(json_file_path, file, 0644)
+	if e != nil {
+		print(e)
+		return ""
+	}
+	e = datapackage.WriteKeyIndex(json_path, KeyIndex{Package: frictionless_data.Name, Resources: resourceKeys})
+	if e != nil {
+		fmt.Println("Could not write key candidates:", e)
+	}
+	output, _ := filepath.Abs(json_path)
+	return output
 }
 
-func generate_schema(file_name string, frictionless_data frictionless_struct) {
+// setPackageMetadata fills the package level properties from the request,
+// deriving a name from the source directory when none is supplied.
+func setPackageMetadata(frictionless_data *frictionless_struct, config DatabaseCredentials) {
+	frictionless_data.Name = config.PackageName
+	if frictionless_data.Name == "" {
+		frictionless_data.Name = packageNameFromPath(config.SourceDirectory)
+	}
+	frictionless_data.Title = config.PackageTitle
+	if frictionless_data.Title == "" {
+		frictionless_data.Title = frictionless_data.Name
+	}
+	frictionless_data.Description = config.PackageDescription
+	if frictionless_data.Description == "" {
+		frictionless_data.Description = "Data package for " + config.SourceDirectory
+	}
+	frictionless_data.Licenses = config.Licenses
+	frictionless_data.Sources = config.Sources
+	frictionless_data.Contributors = config.Contributors
+	frictionless_data.StatsVersion = datapackage.StatsVersion
+}
+
+// profileOptions are the per-request profiling settings, with defaults.
+type profileOptions struct {
+	Percentiles     []float64
+	HistogramBins   int
+	HistogramType   string
+	TopK            int
+	EnumThreshold   int
+	DistinctMode    string
+	SensitivePolicy string
+}
+
+func newProfileOptions(config DatabaseCredentials) profileOptions {
+	options := profileOptions{
+		Percentiles:     config.Percentiles,
+		HistogramBins:   config.HistogramBins,
+		HistogramType:   config.HistogramType,
+		TopK:            config.TopK,
+		EnumThreshold:   config.EnumThreshold,
+		DistinctMode:    config.DistinctMode,
+		SensitivePolicy: config.SensitivePolicy,
+	}
+	if len(options.Percentiles) == 0 {
+		options.Percentiles = profiling.DefaultPercentiles
+	}
+	if options.HistogramBins <= 0 {
+		options.HistogramBins = profiling.DefaultHistogramBins
+	}
+	if options.TopK <= 0 {
+		options.TopK = profiling.DefaultTopK
+	}
+	if options.EnumThreshold <= 0 {
+		options.EnumThreshold = profiling.DefaultEnumThreshold
+	}
+	switch options.DistinctMode {
+	case "exact", "approximate", "auto":
+	default:
+		options.DistinctMode = profiling.DefaultDistinctMode
+	}
+	switch options.SensitivePolicy {
+	case "mask", "omit", "none":
+	default:
+		options.SensitivePolicy = datapackage.DefaultSensitivePolicy
+	}
+	return options
+}
+
+// packageNameFromPath turns a directory into a package name.
+func packageNameFromPath(dir string) string {
+	name := datapackage.Name(filepath.Base(filepath.Clean(dir)))
+	if name == "" {
+		return "data-package"
+	}
+	return name
+}
+
+// generate_schema profiles one JSON file into resource and returns the key
+// candidates of its fields, reporting whether the file could be read as an
+// array of records. The file content is also written to hasher as it is
+// read.
+func generate_schema(file_name string, resource *Resource, hasher io.Writer, options profileOptions) (*KeyCandidates, bool) {
 	jsonFile, err := os.Open(file_name)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer jsonFile.Close()
 
-	byteValue, err := ioutil.ReadAll(jsonFile)
+	content, encoding := profiling.NewUTF8Reader(io.TeeReader(jsonFile, hasher))
+	byteValue, err := ioutil.ReadAll(content)
 	if err != nil {
 		log.Println("Invalid JSON file:", file_name)
-		return
+		return nil, false
 	}
 
 	var data []map[string]interface{}
 	err = json.Unmarshal(byteValue, &data)
 	if err != nil {
 		log.Println("Invalid JSON file:", file_name)
-		return
+		return nil, false
+	}
+	if len(data) == 0 {
+		log.Println("Empty JSON file:", file_name)
+		return nil, false
+	}
+	resource.Encoding = encoding.Encoding
+	resource.InvalidByteCount = encoding.InvalidCount
+	resource.InvalidSequences = encoding.InvalidSequences
+	if encoding.InvalidCount > 0 {
+		fmt.Printf("%s: %d invalid %s byte sequence(s), first at offset %d\n",
+			file_name, encoding.InvalidCount, encoding.Encoding, encoding.InvalidSequences[0].Offset)
 	}
-
 
 	field := []Fields{}
+	keys := &KeyCandidates{Columns: []KeyColumn{}}
 	n_rows := len(data)
-	n_cols := 0
+	names := recordKeys(byteValue)
+	n_cols := len(names)
 
-	for _, obj := range data {
-		if len(obj) > n_cols {
-			n_cols = len(obj)
-		}
-	}
-
-	for key := range data[0] {
+	for _, key := range names {
 		dat_type := getDataType(key, data)
 
 		var newStats Stats
-		uniq_count, uniq_list := uniqueValueCount(key, data)
+		uniq_count, uniq_list, uniq_method, uniq_error := uniqueValueCount(key, data, options.DistinctMode)
 
 		if dat_type {
-			newStats = Stats{
-				Min:  getMinValue(key, data),
-				Max:  getMaxValue(key, data),
-				Mean: getMeanValue(key, data),
-				Std:  getStdValue(key, data),
+			profile := profiling.NewNumericProfile()
+			for _, value := range numericValues(key, data) {
+				profile.Add(value)
 			}
+			newStats.Min, newStats.Max, newStats.Mean, newStats.Std = profile.Summary()
+			newStats.Distribution = profile.Distribution(options.Percentiles, options.HistogramBins, options.HistogramType)
 		}
 
 		newStats.NullValueCounts = getNullValueCount(key, data)
 		newStats.PresentValueCounts = getPresentValueCount(key, data)
 		newStats.UniqueValueCounts = uniq_count
+		newStats.UniqueCountMethod = uniq_method
+		newStats.UniqueCountError = uniq_error
 		newStats.NullProportion = getNullProportion(key, data)
-		newStats.UniqueProportion = getUniqueProportion(key, data)
+		newStats.UniqueProportion = proportion(uniq_count, newStats.PresentValueCounts)
 		newStats.Sample_value = getsamplevalues(uniq_list)
 
 		dat_map := get_type_mapping(key, data)
+		frequencies := profiling.NewFrequencySketch()
+		temporal := profiling.NewTemporalDetector(key)
+		semantic := profiling.NewSemanticClassifier(key)
+		sensitive := profiling.NewSensitiveDetector()
+		lengths := &profiling.LengthRange{}
+		shape := profiling.NewShapeDetector()
+		sketch := profiling.NewKMVSketch(profiling.KeySketchSize)
+		for _, obj := range data {
+			if value, ok := keyValue(obj[key]); ok {
+				sketch.Add(profiling.KeyHash(value))
+			}
+			switch value := obj[key].(type) {
+			case nil:
+			case string:
+				frequencies.Add(value)
+				temporal.Add(value)
+				semantic.Add(value)
+				sensitive.Add(value)
+				lengths.Add(utf8.RuneCountInString(value))
+				shape.Add(value)
+			case float64:
+				frequencies.Add(strconv.FormatFloat(value, 'f', -1, 64))
+				temporal.Add(strconv.FormatFloat(value, 'f', -1, 64))
+				semantic.Add(strconv.FormatFloat(value, 'f', -1, 64))
+			case []interface{}:
+				// Lists of emails or phone numbers are classified by their
+				// elements.
+				temporal.Add(fmt.Sprintf("%v", value))
+				lengths.Add(len(value))
+				for _, element := range value {
+					if element, ok := element.(string); ok {
+						semantic.Add(element)
+						sensitive.Add(element)
+					}
+				}
+			case bool:
+				frequencies.Add(strconv.FormatBool(value))
+				temporal.Add(strconv.FormatBool(value))
+			case map[string]interface{}:
+				temporal.Add(fmt.Sprintf("%v", value))
+				lengths.Add(len(value))
+			default:
+				temporal.Add(fmt.Sprintf("%v", value))
+			}
+		}
+		newStats.TopValues = frequencies.Top(options.TopK)
 		newFields := Fields{
 			Name:        key,
-			Types:       dat_map,
+			Type:        dat_map,
 			Format:      "default",
 			Description: key,
-			Constraints: Constraints{},
 			Stats:       newStats,
 		}
+		// Dates arrive as strings and timestamps as numbers; either way
+		// the field is temporal and the numeric stats do not apply.
+		if kind, format, min, max, ok := temporal.Result(); ok {
+			dat_map = kind
+			newFields.Type = kind
+			newFields.Format = format
+			newFields.Stats.Min, newFields.Stats.Max, newFields.Stats.Mean, newFields.Stats.Std = 0, 0, 0, 0
+			newFields.Stats.Distribution = nil
+			newFields.Stats.MinDate = min
+			newFields.Stats.MaxDate = max
+		}
+		if name, confidence, ok := semantic.Result(); ok {
+			newFields.SemanticType = name
+			newFields.SemanticConfidence = confidence
+			if format, ok := profiling.SemanticFormats[name]; ok && dat_map == "string" && confidence == 1 && semantic.Checked() == newStats.PresentValueCounts {
+				newFields.Format = format
+			}
+		}
+		newFields.Constraints = datapackage.InferConstraints(newFields, nil, lengths, shape)
+		if categories := frequencies.Categories(options.EnumThreshold); categories != nil && dat_map != "boolean" && dat_map != "number" {
+			newFields.Stats.Categorical = true
+			newFields.Constraints.Enum = profiling.EnumValues(dat_map, categories)
+		}
+		newFields.Sensitivity = datapackage.ClassifySensitivity(key, newFields.SemanticType, sensitive, options.SensitivePolicy)
+		datapackage.RedactField(&newFields, options.SensitivePolicy)
 
 		field = append(field, newFields)
+		if column, ok := datapackage.NewKeyColumn(newFields, sketch, jsonKeyTypes); ok {
+			keys.Columns = append(keys.Columns, column)
+		}
 	}
+	keys.UniquePairs = uniquePairs(data, datapackage.CompositeCandidates(keys.Columns))
 
-	frictionless_data.Resources[0].Schema.Fields = field
-	frictionless_data.Resources[0].Dialect.RowsCount = n_rows
-	frictionless_data.Resources[0].Dialect.ColumnsCount = n_cols
+	resource.Schema.Fields = field
+	resource.Schema.MissingValues = []string{}
+	resource.RowsCount = n_rows
+	resource.ColumnsCount = n_cols
+	return keys, true
+}
+
+// recordKeys returns the keys of every record in an array of JSON objects,
+// each once, in the order they first appear; records may leave keys out.
+func recordKeys(byteValue []byte) []string {
+	var records []json.RawMessage
+	if json.Unmarshal(byteValue, &records) != nil {
+		return nil
+	}
+	var keys []string
+	seen := map[string]bool{}
+	for _, record := range records {
+		decoder := json.NewDecoder(bytes.NewReader(record))
+		if _, err := decoder.Token(); err != nil {
+			continue
+		}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			key, _ := token.(string)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+			var value json.RawMessage
+			if decoder.Decode(&value) != nil {
+				break
+			}
+		}
+	}
+	return keys
 }
 
 func getDataType(key string, data []map[string]interface{}) bool {
@@ -313,114 +518,54 @@ func getDataType(key string, data []map[string]interface{}) bool {
 	return false
 }
 
-func uniqueValueCount(key string, data []map[string]interface{}) (int, []string) {
-	found := false
-	var uniquelist []string
-
+// uniqueValueCount counts the distinct non-null values under key with the
+// chosen method, returning the first few as samples.
+func uniqueValueCount(key string, data []map[string]interface{}, mode string) (int, []string, string, float64) {
+	distinct := profiling.NewDistinctCounter(mode)
+	var samples []string
+	present := 0
 	for _, obj := range data {
-		value := fmt.Sprintf("%v", obj[key])
-		found = false
-		for _, k := range uniquelist {
-			if value == k {
-				found = true
-			}
-		}
-
-		if !found {
-			uniquelist = append(uniquelist, value)
+		if obj[key] == nil {
+			continue
 		}
-	}
-
-	return len(uniquelist), uniquelist
-}
-
-func getMinValue(key string, data []map[string]interface{}) int {
-	minValue := math.MaxInt64
-
-	for _, obj := range data {
-		value := obj[key]
-		switch value.(type) {
-		case int, int8, int16, int32, int64:
-			if value.(int) < minValue {
-				minValue = value.(int)
-			}
-		case float32, float64:
-			if int(value.(float64)) < minValue {
-				minValue = int(value.(float64))
-			}
+		present++
+		value := fmt.Sprintf("%v", obj[key])
+		distinct.Add(value)
+		if len(samples) < 3 && !containsString(samples, value) {
+			samples = append(samples, value)
 		}
 	}
 
-	return minValue
-}
-
-func getMaxValue(key string, data []map[string]interface{}) int {
-	maxValue := math.MinInt64
-
-	for _, obj := range data {
-		value := obj[key]
-		switch value.(type) {
-		case int, int8, int16, int32, int64:
-			if value.(int) > maxValue {
-				maxValue = value.(int)
-			}
-		case float32, float64:
-			if int(value.(float64)) > maxValue {
-				maxValue = int(value.(float64))
-			}
-		}
+	count := distinct.Count()
+	if count > present {
+		count = present
 	}
-
-	return maxValue
+	method, relativeError := distinct.Method()
+	return count, samples, method, relativeError
 }
 
-func getMeanValue(key string, data []map[string]interface{}) int {
-	sum := 0
-	count := 0
-
-	for _, obj := range data {
-		value := obj[key]
-		switch value.(type) {
-		case int, int8, int16, int32, int64:
-			sum += value.(int)
-			count++
-		case float32, float64:
-			sum += int(value.(float64))
-			count++
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
 	}
-
-	if count > 0 {
-		return sum / count
-	}
-
-	return 0
+	return false
 }
 
-func getStdValue(key string, data []map[string]interface{}) int {
-	mean := getMeanValue(key, data)
-	sumSquaredDiff := 0
-	count := 0
-
+// numericValues collects the numbers under key; encoding/json decodes
+// every number as float64.
+func numericValues(key string, data []map[string]interface{}) []float64 {
+	var values []float64
 	for _, obj := range data {
-		value := obj[key]
-		switch value.(type) {
-		case int, int8, int16, int32, int64:
-			diff := value.(int) - mean
-			sumSquaredDiff += diff * diff
-			count++
-		case float32, float64:
-			diff := int(value.(float64)) - mean
-			sumSquaredDiff += diff * diff
-			count++
+		switch value := obj[key].(type) {
+		case float64:
+			values = append(values, value)
+		case int:
+			values = append(values, float64(value))
 		}
 	}
-
-	if count > 0 {
-		return int(math.Sqrt(float64(sumSquaredDiff / count)))
-	}
-
-	return 0
+	return values
 }
 
 func getNullValueCount(key string, data []map[string]interface{}) int {
@@ -449,26 +594,17 @@ func getPresentValueCount(key string, data []map[string]interface{}) int {
 	return count
 }
 
-func getNullProportion(key string, data []map[string]interface{}) int {
-	nullCount := getNullValueCount(key, data)
-	presentCount := getPresentValueCount(key, data)
-
-	if presentCount > 0 {
-		return int((float64(nullCount) / float64(presentCount)) * 100)
-	}
-
-	return 0
+// getNullProportion is the share of objects where key is null or missing.
+func getNullProportion(key string, data []map[string]interface{}) float64 {
+	return proportion(getNullValueCount(key, data), len(data))
 }
 
-func getUniqueProportion(key string, data []map[string]interface{}) int {
-	uniqueCount, _ := uniqueValueCount(key, data)
-	presentCount := getPresentValueCount(key, data)
-
-	if presentCount > 0 {
-		return int((float64(uniqueCount) / float64(presentCount)) * 100)
+// proportion is part/whole as a 0-1 fraction, zero for an empty whole.
+func proportion(part, whole int) float64 {
+	if whole == 0 {
+		return 0
 	}
-
-	return 0
+	return float64(part) / float64(whole)
 }
 
 func get_type_mapping(key string, data []map[string]interface{}) string {
@@ -483,10 +619,14 @@ func get_type_mapping(key string, data []map[string]interface{}) string {
 			return "number"
 		case bool:
 			return "boolean"
+		case []interface{}:
+			return "array"
+		case map[string]interface{}:
+			return "object"
 		}
 	}
 
-	return ""
+	return "any"
 }
 
 func getsamplevalues(sample_list []string) []string {
@@ -547,7 +687,20 @@ func (s *MyRPCServer) GetData(args DatabaseCredentials, reply *DatabaseCredentia
 	
 
 	*reply = args // Set the reply value
-	json_plugin(args)
+	reply.OutputPath = json_plugin(args)
+	return nil
+}
+
+// Validate checks a JSON file against an expected Table Schema and replies
+// with a record and field level error report.
+func (s *MyRPCServer) Validate(args ValidationRequest, reply *ValidationReport) error {
+	fmt.Println("Received validation request:", args)
+
+	report, err := validateJSON(args)
+	if err != nil {
+		return err
+	}
+	*reply = *report
 	return nil
 }
 
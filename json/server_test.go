@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// profileJSON profiles content as one JSON file and returns its fields by
+// name.
+func profileJSON(t *testing.T, content string) map[string]Fields {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var resource Resource
+	if _, ok := generate_schema(path, &resource, ioutil.Discard, newProfileOptions(DatabaseCredentials{})); !ok {
+		t.Fatalf("generate_schema(%s) failed", content)
+	}
+	fields := map[string]Fields{}
+	for _, field := range resource.Schema.Fields {
+		fields[field.Name] = field
+	}
+	return fields
+}
+
+func TestFieldStats(t *testing.T) {
+	fields := profileJSON(t, `[
+		{"price": 72.5, "name": "a"},
+		{"price": 73.34, "name": "b"},
+		{"price": null, "name": "a"},
+		{"price": 72.5}
+	]`)
+
+	price := fields["price"].Stats
+	if price.Min != 72.5 || price.Max != 73.34 || math.Abs(price.Mean-72.78) > 1e-9 {
+		t.Errorf("price min, max, mean = %v, %v, %v, want 72.5, 73.34, 72.78", price.Min, price.Max, price.Mean)
+	}
+	// The sample standard deviation of 72.5, 73.34, 72.5.
+	if math.Abs(price.Std-0.48497) > 1e-5 {
+		t.Errorf("price std = %v, want 0.48497", price.Std)
+	}
+	// Proportions are 0-1 fractions: nulls over rows, distinct values over
+	// present ones.
+	if price.NullValueCounts != 1 || price.NullProportion != 0.25 {
+		t.Errorf("price nulls = %d (%v), want 1 (0.25)", price.NullValueCounts, price.NullProportion)
+	}
+	if price.UniqueValueCounts != 2 || math.Abs(price.UniqueProportion-2.0/3) > 1e-9 {
+		t.Errorf("price unique = %d (%v), want 2 (2/3)", price.UniqueValueCounts, price.UniqueProportion)
+	}
+
+	// A missing key counts as a null.
+	name := fields["name"].Stats
+	if name.NullProportion != 0.25 || math.Abs(name.UniqueProportion-2.0/3) > 1e-9 {
+		t.Errorf("name proportions = %v, %v, want 0.25, 2/3", name.NullProportion, name.UniqueProportion)
+	}
+	if name.Mean != 0 || name.Std != 0 {
+		t.Errorf("name has numeric stats %+v", name)
+	}
+}
+
+func TestSemanticTypes(t *testing.T) {
+	fields := profileJSON(t, `[
+		{"email": "a@example.com", "phone_numbers": ["+1 555 123 4567", "+44 20 7946 0958"], "endpoint": "https://example.com/a"},
+		{"email": "b@example.com", "phone_numbers": ["+1 555 987 6543"], "endpoint": "https://example.com/b"},
+		{"email": "c@example.com", "phone_numbers": [], "endpoint": "https://example.com/c"},
+		{"email": "d@example.com", "endpoint": "https://example.com/d"},
+		{"email": "e@example.com", "endpoint": "n/a"}
+	]`)
+	tests := []struct {
+		field, semanticType, format string
+		confidence                  float64
+	}{
+		// Every value matched, so the string format follows.
+		{"email", "email", "email", 1},
+		// Lists are classified by their elements.
+		{"phone_numbers", "phone", "default", 1},
+		// A value that does not match leaves the format alone.
+		{"endpoint", "url", "default", 0.8},
+	}
+	for _, test := range tests {
+		field := fields[test.field]
+		if field.SemanticType != test.semanticType || field.SemanticConfidence != test.confidence || field.Format != test.format {
+			t.Errorf("%s: semantic type %q (%v), format %q, want %q (%v), %q", test.field,
+				field.SemanticType, field.SemanticConfidence, field.Format, test.semanticType, test.confidence, test.format)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"profiling"
+	"profiling/datapackage"
+)
+
+// The validation request and report are shared with the other plugins.
+type (
+	ValidationRequest = datapackage.ValidationRequest
+	ValidationError   = datapackage.ValidationError
+	ValidationReport  = datapackage.ValidationReport
+)
+
+// validateJSON checks every record of a JSON array file against the
+// schema: unknown keys, types and field constraints.
+func validateJSON(req ValidationRequest) (*ValidationReport, error) {
+	schema, _, err := datapackage.LoadSchema(req, json_path)
+	if err != nil {
+		return nil, err
+	}
+	maxErrors := req.MaxErrors
+	if maxErrors <= 0 {
+		maxErrors = datapackage.DefaultMaxErrors
+	}
+
+	file, err := os.Open(req.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, _ := profiling.NewUTF8Reader(file)
+	// Numbers are kept as json.Number, so integer ids beyond float64
+	// precision are compared exactly.
+	decoder := json.NewDecoder(content)
+	decoder.UseNumber()
+	var data []map[string]interface{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON file %s: %v", req.DataPath, err)
+	}
+
+	report := datapackage.NewValidationReport(req.DataPath)
+	missing := datapackage.MissingValueSet(schema.MissingValues)
+	checkers := make([]*datapackage.FieldChecker, len(schema.Fields))
+	known := map[string]bool{}
+	for i, field := range schema.Fields {
+		checkers[i] = datapackage.NewFieldChecker(field, missing)
+		known[field.Name] = true
+	}
+
+	// Records are numbered from 1 in the order they appear in the array.
+	extra := map[string]bool{}
+	for i, obj := range data {
+		row := i + 1
+		report.RowsChecked++
+		for key := range obj {
+			if !known[key] && !extra[key] {
+				extra[key] = true
+				report.Add(ValidationError{Row: row, Field: key, Type: "extra-field",
+					Message: fmt.Sprintf("key %q is not in the schema", key)}, maxErrors)
+			}
+		}
+		for i, checker := range checkers {
+			for _, e := range checker.CheckJSON(row, obj[schema.Fields[i].Name]) {
+				report.Add(e, maxErrors)
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	schema := `{"fields": [
+		{"name": "id", "type": "integer", "constraints": {"required": true, "unique": true}},
+		{"name": "tags", "type": "array", "constraints": {"maxLength": 2}}
+	]}`
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"valid", `[{"id": 1, "tags": ["a"]}, {"id": 2}]`, []string{}},
+		{"extra key", `[{"id": 1, "size": 3}, {"id": 2, "size": 4}]`, []string{"extra-field"}},
+		{"types", `[{"id": "1"}, {"id": 1.5}, {"id": 3, "tags": "a"}]`, []string{"type", "type", "type"}},
+		{"constraints", `[{"id": 1, "tags": ["a", "b", "c"]}, {"id": 1}, {"id": null}]`, []string{"maxLength", "required", "unique"}},
+		{"large ids", `[{"id": 9007199254740992}, {"id": 9007199254740993}]`, []string{}},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "data.json")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			report, err := validateJSON(ValidationRequest{DataPath: path, Schema: schema})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range report.Errors {
+				got = append(got, e.Type)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("errors = %q, want %q (%+v)", got, test.want, report.Errors)
+			}
+		})
+	}
+}
+
+// TestGenerateSchemaValidates profiles records that do not all have the
+// same keys and checks them against the schema just inferred.
+func TestGenerateSchemaValidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mixed.json")
+	content := `[{"b": "x", "a": 1}, {"a": 2, "c": true}, {"d": [1, 2], "a": 3, "b": "y"}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var resource Resource
+	if _, ok := generate_schema(path, &resource, ioutil.Discard, newProfileOptions(DatabaseCredentials{})); !ok {
+		t.Fatal("generate_schema() could not read the file")
+	}
+	var names []string
+	for _, field := range resource.Schema.Fields {
+		names = append(names, field.Name)
+	}
+	if want := []string{"b", "a", "c", "d"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("fields = %q, want %q", names, want)
+	}
+	if resource.ColumnsCount != 4 {
+		t.Errorf("columnsCount = %d, want 4", resource.ColumnsCount)
+	}
+
+	schema, err := json.Marshal(resource.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := validateJSON(ValidationRequest{DataPath: path, Schema: string(schema)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid {
+		t.Errorf("data does not validate against its own schema: %+v", report.Errors)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"profiling"
+)
+
+// Statistics pushed down to the database. A single scan of the table counts
+// the present (and, when exact, distinct) values of every column and
+// computes the aggregates of its type: min, max, mean, standard deviation,
+// moments and percentiles of numbers, the range of dates and times, and
+// the lengths of text. Equal-width histograms take a second scan, as their
+// bins depend on the range. Tables too wide for one select list take a
+// scan per batch of columns.
+
+type columnAggregates struct {
+	present  int
+	distinct int
+	// finite counts the numbers within finiteBound, those aggregated.
+	finite    int
+	min, max  float64
+	mean, std float64
+	// moments are the raw moments E[x^2], E[x^3] and E[x^4].
+	moments   [3]float64
+	zeros     int
+	negatives int
+	quantiles map[float64]float64
+	minDate   string
+	maxDate   string
+	length    *LengthStats
+	dist      *profiling.Distribution
+	// integers is the exact range of an integer column.
+	integers *profiling.IntegerRange
+}
+
+type tableAggregates struct {
+	rows    int
+	columns map[string]*columnAggregates
+}
+
+// maxAggregateTargets caps the expressions of one aggregate query, well
+// under the 1664 a PostgreSQL select list may hold. Wider tables are
+// scanned once per batch of columns.
+var maxAggregateTargets = 1000
+
+// aggregateScanner collects the expressions of the aggregate query with
+// the destination each result is scanned into. starts are the indexes at
+// which the expressions of each column begin.
+type aggregateScanner struct {
+	expressions []string
+	targets     []interface{}
+	assign      []func()
+	starts      []int
+}
+
+// column starts the expressions of the next column, which are kept in the
+// same batch unless they alone go past maxAggregateTargets.
+func (s *aggregateScanner) column() {
+	s.starts = append(s.starts, len(s.expressions))
+}
+
+func (s *aggregateScanner) add(expression string, target interface{}, assign func()) {
+	s.expressions = append(s.expressions, expression)
+	s.targets = append(s.targets, target)
+	if assign != nil {
+		s.assign = append(s.assign, assign)
+	}
+}
+
+// scan runs the aggregate queries over table, then the assignments.
+func (s *aggregateScanner) scan(db *sql.DB, table string) error {
+	for _, batch := range s.batches() {
+		query := fmt.Sprintf("SELECT %s FROM %s;", strings.Join(s.expressions[batch[0]:batch[1]], ", "), table)
+		if err := db.QueryRow(query).Scan(s.targets[batch[0]:batch[1]]...); err != nil {
+			return err
+		}
+	}
+	for _, assign := range s.assign {
+		assign()
+	}
+	return nil
+}
+
+// batches splits the expressions into ranges of at most
+// maxAggregateTargets, cutting between columns where it can.
+func (s *aggregateScanner) batches() [][2]int {
+	var batches [][2]int
+	start, end := 0, 0
+	cuts := append(append([]int(nil), s.starts...), len(s.expressions))
+	for _, cut := range cuts {
+		if cut-start > maxAggregateTargets {
+			if end > start {
+				batches = append(batches, [2]int{start, end})
+				start = end
+			}
+			for cut-start > maxAggregateTargets {
+				batches = append(batches, [2]int{start, start + maxAggregateTargets})
+				start += maxAggregateTargets
+			}
+		}
+		end = cut
+	}
+	if end > start {
+		batches = append(batches, [2]int{start, end})
+	}
+	return batches
+}
+
+// Numbers are aggregated as float8. NaN, the infinities and values beyond
+// finiteBound, which a numeric column may hold but float8 cannot, are left
+// out. Sums that could overflow are only taken when every value is within
+// a smaller bound: the mean and standard deviation within meanBound, the
+// moments behind skewness and kurtosis within momentBound.
+const (
+	finiteBound = 1e300
+	meanBound   = 1e100
+	momentBound = 1e30
+)
+
+// bounded is the float8 value of column, null unless it is within bound.
+// A CASE, unlike a FILTER or WHERE, is sure to test the bound before the
+// cast, which would overflow.
+func bounded(column string, bound float64) string {
+	return fmt.Sprintf("(CASE WHEN %s BETWEEN %g AND %g THEN %s::float8 END)", column, -bound, bound, column)
+}
+
+// aggregateQuantiles are the quantiles the distribution always needs, on
+// top of the requested percentiles.
+var aggregateQuantiles = []float64{0.25, 0.5, 0.75}
+
+// estimatedRows is the planner's row estimate for the table with its
+// partitions or children, -1 when none of them was ever analyzed.
+func estimatedRows(db *sql.DB, table string) (int, error) {
+	var rows float64
+	err := db.QueryRow(`WITH RECURSIVE tree(oid) AS (
+		SELECT $1::regclass::oid
+		UNION ALL SELECT i.inhrelid FROM pg_inherits i JOIN tree t ON i.inhparent = t.oid)
+		SELECT COALESCE(SUM(c.reltuples) FILTER (WHERE c.reltuples > 0), 0)
+		FROM pg_class c JOIN tree t ON c.oid = t.oid;`, table).Scan(&rows)
+	if err != nil {
+		return 0, err
+	}
+	if rows <= 0 {
+		return -1, nil
+	}
+	return int(rows), nil
+}
+
+// getTableAggregates computes the aggregates of every column in one scan.
+// dataTypes are the database types of the columns and types their Table
+// Schema types.
+func getTableAggregates(db *sql.DB, table string, columns, dataTypes, types []string, options profileOptions) (*tableAggregates, error) {
+	// "auto" only pays for COUNT(DISTINCT) on tables small enough to sort,
+	// going by the planner's estimate since the count is not known yet.
+	exactDistinct := options.DistinctMode == "exact"
+	if options.DistinctMode == "auto" {
+		estimate, err := estimatedRows(db, table)
+		if err != nil {
+			return nil, err
+		}
+		exactDistinct = estimate <= profiling.AutoExactLimit
+	}
+
+	quantiles := append([]float64(nil), aggregateQuantiles...)
+	for _, percentile := range options.Percentiles {
+		if percentile >= 0 && percentile <= 100 {
+			quantiles = append(quantiles, percentile/100)
+		}
+	}
+	if options.HistogramType == "adaptive" {
+		for i := 1; i < options.HistogramBins; i++ {
+			quantiles = append(quantiles, float64(i)/float64(options.HistogramBins))
+		}
+	}
+	seen := map[float64]bool{}
+	unique := quantiles[:0]
+	for _, q := range quantiles {
+		if !seen[q] {
+			seen[q] = true
+			unique = append(unique, q)
+		}
+	}
+	quantiles = unique
+	quantileList := make([]string, len(quantiles))
+	for i, q := range quantiles {
+		quantileList[i] = strconv.FormatFloat(q, 'f', -1, 64)
+	}
+
+	result := &tableAggregates{columns: map[string]*columnAggregates{}}
+	scanner := &aggregateScanner{}
+	scanner.add("COUNT(*)", &result.rows, nil)
+	for i, column := range columns {
+		quoted := pq.QuoteIdentifier(column)
+		scanner.column()
+		agg := &columnAggregates{distinct: -1}
+		result.columns[column] = agg
+		scanner.add(fmt.Sprintf("COUNT(%s)", quoted), &agg.present, nil)
+		if exactDistinct {
+			scanner.add(fmt.Sprintf("COUNT(DISTINCT %s)", quoted), &agg.distinct, nil)
+		}
+
+		switch types[i] {
+		case "integer", "number":
+			value := bounded(quoted, finiteBound)
+			var counts [2]int
+			scanner.add(fmt.Sprintf("COUNT(%s)", value), &agg.finite, nil)
+			scanner.add(fmt.Sprintf("COUNT(%s)", bounded(quoted, meanBound)), &counts[0], nil)
+			scanner.add(fmt.Sprintf("COUNT(%s)", bounded(quoted, momentBound)), &counts[1], nil)
+			floats := make([]sql.NullFloat64, 7)
+			for j, expression := range []string{"MIN(%s)", "MAX(%s)", "AVG(%s)", "STDDEV_SAMP(%s)", "AVG(%s ^ 2)", "AVG(%s ^ 3)", "AVG(%s ^ 4)"} {
+				operand := value
+				switch {
+				case j >= 4:
+					operand = bounded(quoted, momentBound)
+				case j >= 2:
+					operand = bounded(quoted, meanBound)
+				}
+				scanner.add(fmt.Sprintf(expression, operand), &floats[j], nil)
+			}
+			if types[i] == "integer" {
+				var min, max sql.NullInt64
+				scanner.add(fmt.Sprintf("MIN(%s)", quoted), &min, nil)
+				scanner.add(fmt.Sprintf("MAX(%s)", quoted), &max, func() {
+					if min.Valid {
+						agg.integers = &profiling.IntegerRange{Min: min.Int64, Max: max.Int64, Seen: true}
+					}
+				})
+			}
+			scanner.add(fmt.Sprintf("COUNT(*) FILTER (WHERE %s = 0)", quoted), &agg.zeros, nil)
+			scanner.add(fmt.Sprintf("COUNT(*) FILTER (WHERE %s < 0)", quoted), &agg.negatives, nil)
+			var values pq.Float64Array
+			scanner.add(fmt.Sprintf("percentile_cont(ARRAY[%s]::float8[]) WITHIN GROUP (ORDER BY %s)", strings.Join(quantileList, ", "), value), &values, func() {
+				agg.min, agg.max = floats[0].Float64, floats[1].Float64
+				if counts[0] == agg.finite {
+					agg.mean, agg.std = floats[2].Float64, floats[3].Float64
+				}
+				if counts[1] == agg.finite {
+					agg.moments = [3]float64{floats[4].Float64, floats[5].Float64, floats[6].Float64}
+				}
+				if len(values) == len(quantiles) {
+					agg.quantiles = map[float64]float64{}
+					for j, q := range quantiles {
+						agg.quantiles[q] = values[j]
+					}
+				}
+			})
+		case "date", "time", "datetime":
+			// Dates and times are ISO 8601, timestamps RFC 3339 in UTC.
+			format := "%s(%s)::text"
+			switch dataTypes[i] {
+			case "date":
+				format = "to_char(%s(%s), 'YYYY-MM-DD')"
+			case "timestamp":
+				format = `to_char(%s(%s), 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+			case "timestamptz":
+				format = `to_char(%s(%s) AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+			}
+			var min, max sql.NullString
+			scanner.add(fmt.Sprintf(format, "MIN", quoted), &min, nil)
+			scanner.add(fmt.Sprintf(format, "MAX", quoted), &max, func() {
+				agg.minDate, agg.maxDate = min.String, max.String
+			})
+		case "string":
+			var minLength, maxLength sql.NullInt64
+			var avgLength sql.NullFloat64
+			length := fmt.Sprintf("char_length(%s::text)", quoted)
+			scanner.add("MIN("+length+")", &minLength, nil)
+			scanner.add("MAX("+length+")", &maxLength, nil)
+			scanner.add("AVG("+length+")::float8", &avgLength, func() {
+				if minLength.Valid {
+					agg.length = &LengthStats{MinLength: int(minLength.Int64), MaxLength: int(maxLength.Int64), AverageLength: avgLength.Float64}
+				}
+			})
+		}
+	}
+
+	if err := scanner.scan(db, table); err != nil {
+		return nil, err
+	}
+	for i, column := range columns {
+		if types[i] == "integer" || types[i] == "number" {
+			agg := result.columns[column]
+			agg.dist = agg.distribution(options.Percentiles)
+		}
+	}
+	return result, nil
+}
+
+// stats fills the summary statistics of a column.
+func (agg *columnAggregates) stats(stats *Stats) {
+	if agg.present == 0 {
+		return
+	}
+	stats.Min, stats.Max, stats.Mean, stats.Std = agg.min, agg.max, agg.mean, agg.std
+	stats.MinDate, stats.MaxDate = agg.minDate, agg.maxDate
+	stats.Length = agg.length
+}
+
+// distribution summarises a numeric column from its aggregates; the
+// histogram is left to getHistograms.
+func (agg *columnAggregates) distribution(percentiles []float64) *profiling.Distribution {
+	if agg.present == 0 || agg.quantiles == nil {
+		return nil
+	}
+	d := &profiling.Distribution{
+		Median:        agg.quantiles[0.5],
+		IQR:           agg.quantiles[0.75] - agg.quantiles[0.25],
+		ZeroCount:     agg.zeros,
+		NegativeCount: agg.negatives,
+	}
+	// Central moments from the raw ones, skipped when the spread is too
+	// small next to the mean for the subtraction to keep any precision.
+	mu := agg.mean
+	m2 := agg.moments[0] - mu*mu
+	if agg.moments[0] > 0 && m2 > 1e-9*agg.moments[0] {
+		m3 := agg.moments[1] - 3*mu*agg.moments[0] + 2*mu*mu*mu
+		m4 := agg.moments[2] - 4*mu*agg.moments[1] + 6*mu*mu*agg.moments[0] - 3*mu*mu*mu*mu
+		d.Skewness = m3 / math.Pow(m2, 1.5)
+		d.Kurtosis = m4/(m2*m2) - 3
+	}
+	for _, percentile := range percentiles {
+		value, ok := agg.quantiles[percentile/100]
+		if !ok {
+			continue
+		}
+		if d.Percentiles == nil {
+			d.Percentiles = map[string]float64{}
+		}
+		d.Percentiles["p"+strconv.FormatFloat(percentile, 'f', -1, 64)] = value
+	}
+	return d
+}
+
+// getHistograms adds a histogram to the distribution of each numeric
+// column, counting every bin of every column in one more scan. Adaptive
+// (equal frequency) bins are cut at quantiles rather than equal widths.
+func getHistograms(db *sql.DB, table string, columns []string, aggregates *tableAggregates, bins int, histogramType string) error {
+	type pending struct {
+		d      *profiling.Distribution
+		edges  []float64
+		counts []int
+	}
+	scanner := &aggregateScanner{}
+	var histograms []*pending
+	for _, column := range columns {
+		agg := aggregates.columns[column]
+		if agg == nil || agg.dist == nil || bins <= 0 || agg.finite == 0 {
+			continue
+		}
+		if agg.min == agg.max {
+			agg.dist.Histogram = &profiling.Histogram{Type: "equal-width", Bins: []profiling.HistogramBin{{Lower: agg.min, Upper: agg.max, Count: agg.finite}}}
+			continue
+		}
+		h := &pending{d: agg.dist, edges: []float64{agg.min}}
+		if histogramType == "adaptive" {
+			for i := 1; i < bins; i++ {
+				edge, ok := agg.quantiles[float64(i)/float64(bins)]
+				if ok && edge > h.edges[len(h.edges)-1] && edge < agg.max {
+					h.edges = append(h.edges, edge)
+				}
+			}
+		} else {
+			width := (agg.max - agg.min) / float64(bins)
+			for i := 1; i < bins; i++ {
+				h.edges = append(h.edges, agg.min+float64(i)*width)
+			}
+		}
+		h.edges = append(h.edges, agg.max)
+		h.counts = make([]int, len(h.edges)-1)
+		scanner.column()
+		value := bounded(pq.QuoteIdentifier(column), finiteBound)
+		for i := range h.counts {
+			condition := fmt.Sprintf("%s >= %v AND %s < %v", value, h.edges[i], value, h.edges[i+1])
+			if i == len(h.counts)-1 {
+				condition = fmt.Sprintf("%s >= %v", value, h.edges[i])
+			}
+			scanner.add(fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", condition), &h.counts[i], nil)
+		}
+		histograms = append(histograms, h)
+	}
+	if err := scanner.scan(db, table); err != nil {
+		return err
+	}
+	for _, h := range histograms {
+		kind := histogramType
+		if kind != "adaptive" {
+			kind = "equal-width"
+		}
+		histogram := &profiling.Histogram{Type: kind}
+		for i, count := range h.counts {
+			histogram.Bins = append(histogram.Bins, profiling.HistogramBin{Lower: h.edges[i], Upper: h.edges[i+1], Count: count})
+		}
+		h.d.Histogram = histogram
+	}
+	return nil
+}
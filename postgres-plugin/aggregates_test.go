@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregateBatches(t *testing.T) {
+	defer func(limit int) { maxAggregateTargets = limit }(maxAggregateTargets)
+	maxAggregateTargets = 4
+
+	tests := []struct {
+		name    string
+		columns []int
+		want    [][2]int
+	}{
+		{"one batch", []int{1, 2}, [][2]int{{0, 4}}},
+		{"cut between columns", []int{2, 2, 3}, [][2]int{{0, 3}, {3, 5}, {5, 8}}},
+		{"column wider than a batch", []int{1, 9, 1}, [][2]int{{0, 2}, {2, 6}, {6, 10}, {10, 12}}},
+		{"no columns", nil, [][2]int{{0, 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Like getTableAggregates, a row count comes before the columns.
+			scanner := &aggregateScanner{}
+			var target int
+			scanner.add("COUNT(*)", &target, nil)
+			for _, n := range test.columns {
+				scanner.column()
+				for j := 0; j < n; j++ {
+					scanner.add("COUNT(c)", &target, nil)
+				}
+			}
+			if got := scanner.batches(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("batches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"profiling/datapackage"
+)
+
+// Declared metadata. The system catalogs say what the data may hold, which
+// sampling can only guess: NOT NULL, UNIQUE, CHECK, primary and foreign
+// keys, defaults, enum labels, varchar lengths and COMMENT ON descriptions.
+// Where the catalog declares a constraint it replaces the inferred one.
+
+type declaredColumn struct {
+	notNull   bool
+	unique    bool
+	def       string
+	comment   string
+	typeName  string
+	maxLength *int
+	labels    []string
+	checks    []string
+}
+
+type tableCatalog struct {
+	comment     string
+	columns     map[string]*declaredColumn
+	primaryKey  []string
+	foreignKeys []ForeignKey
+}
+
+// keyFields is a single field name, or the list of names of a composite key.
+func keyFields(names []string) interface{} {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return names
+}
+
+// typeFormats are the Table Schema string formats implied by a column type.
+var typeFormats = map[string]string{"uuid": "uuid", "bytea": "binary"}
+
+func getCatalog(db *sql.DB, relation tableRef) (*tableCatalog, error) {
+	table := relation.quoted()
+	catalog := &tableCatalog{columns: map[string]*declaredColumn{}}
+	err := db.QueryRow("SELECT COALESCE(obj_description($1::regclass, 'pg_class'), '');", table).Scan(&catalog.comment)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT a.attname, a.attnotnull,
+		COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+		COALESCE(col_description(a.attrelid, a.attnum), ''),
+		t.typname,
+		CASE WHEN t.typname IN ('varchar', 'bpchar') AND a.atttypmod > 4 THEN a.atttypmod - 4 END,
+		ARRAY(SELECT e.enumlabel FROM pg_enum e WHERE e.enumtypid = a.atttypid ORDER BY e.enumsortorder)
+		FROM pg_attribute a
+		JOIN pg_type t ON t.oid = a.atttypid
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum;`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var maxLength sql.NullInt64
+		column := &declaredColumn{}
+		if err := rows.Scan(&name, &column.notNull, &column.def, &column.comment, &column.typeName, &maxLength, pq.Array(&column.labels)); err != nil {
+			return nil, err
+		}
+		if maxLength.Valid {
+			n := int(maxLength.Int64)
+			column.maxLength = &n
+		}
+		catalog.columns[name] = column
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT con.contype,
+		ARRAY(SELECT a.attname FROM unnest(con.conkey) WITH ORDINALITY k(attnum, n)
+			JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum ORDER BY k.n),
+		CASE WHEN con.contype = 'f' THEN (SELECT n.nspname || '.' || c.relname FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.oid = con.confrelid) ELSE '' END,
+		ARRAY(SELECT a.attname FROM unnest(con.confkey) WITH ORDINALITY k(attnum, n)
+			JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum ORDER BY k.n),
+		pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		WHERE con.conrelid = $1::regclass AND con.contype IN ('p', 'u', 'f', 'c')
+		ORDER BY con.conname;`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, referenced, definition string
+		var columns, referencedColumns []string
+		if err := rows.Scan(&kind, pq.Array(&columns), &referenced, pq.Array(&referencedColumns), &definition); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "p":
+			catalog.primaryKey = columns
+			if len(columns) == 1 {
+				catalog.column(columns[0]).notNull = true
+				catalog.column(columns[0]).unique = true
+			}
+		case "u":
+			if len(columns) == 1 {
+				catalog.column(columns[0]).unique = true
+			}
+		case "f":
+			catalog.foreignKeys = append(catalog.foreignKeys, ForeignKey{
+				Fields: keyFields(columns),
+				Reference: ForeignKeyReference{
+					Resource: datapackage.Name(referenced),
+					Fields:   keyFields(referencedColumns),
+				},
+			})
+		case "c":
+			if len(columns) == 1 {
+				column := catalog.column(columns[0])
+				column.checks = append(column.checks, definition)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, fk := range catalog.foreignKeys {
+		if fk.Reference.Resource == datapackage.Name(relation.qualified()) {
+			catalog.foreignKeys[i].Reference.Resource = ""
+		}
+	}
+	return catalog, nil
+}
+
+func (c *tableCatalog) column(name string) *declaredColumn {
+	column, ok := c.columns[name]
+	if !ok {
+		column = &declaredColumn{}
+		c.columns[name] = column
+	}
+	return column
+}
+
+var (
+	checkCastPattern   = regexp.MustCompile(`::(?:"[^"]+"|[a-z_][a-z0-9_]*)(?: varying| precision| without time zone| with time zone)?(?:\[\])?`)
+	checkParenPattern  = regexp.MustCompile(`(^|[^a-z0-9_])\((-?[0-9.]+|'(?:[^']|'')*'|"(?:[^"]|"")+"|[a-z_][a-z0-9_]*)\)`)
+	checkRangePattern  = regexp.MustCompile(`^("(?:[^"]|"")+"|[a-z_][a-z0-9_]*) (>=|>|<=|<) (-?[0-9.]+|'-[0-9.]+')$`)
+	checkLengthPattern = regexp.MustCompile(`^(?:char_length|length)\(("(?:[^"]|"")+"|[a-z_][a-z0-9_]*)\) (>=|>|<=|<) ([0-9]+)$`)
+	checkEnumPattern   = regexp.MustCompile(`^("(?:[^"]|"")+"|[a-z_][a-z0-9_]*) = ANY \(*ARRAY\[(.*)\]\)*$`)
+	checkRegexPattern  = regexp.MustCompile(`^("(?:[^"]|"")+"|[a-z_][a-z0-9_]*) ~ '((?:[^']|'')*)'$`)
+	checkLiteral       = regexp.MustCompile(`'((?:[^']|'')*)'|(-?[0-9.]+)`)
+)
+
+// applyChecks turns the single column CHECK constraints Postgres prints as
+// "CHECK ((price >= (0)::numeric))" into minimum, maximum, length, enum and
+// pattern constraints, returning the names of those set. Checks of any
+// other form are kept verbatim in the Checks constraint.
+func applyChecks(constraints *Constraints, fieldType string, checks []string) []string {
+	var applied []string
+	for _, check := range checks {
+		expression := strings.TrimSuffix(strings.TrimPrefix(check, "CHECK "), " NOT VALID")
+		expression = checkCastPattern.ReplaceAllString(expression, "")
+		for {
+			simplified := checkParenPattern.ReplaceAllString(expression, "$1$2")
+			if simplified == expression {
+				break
+			}
+			expression = simplified
+		}
+		for strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") && balanced(expression[1:len(expression)-1]) {
+			expression = expression[1 : len(expression)-1]
+		}
+		parsed := true
+		for _, term := range strings.Split(expression, " AND ") {
+			term = strings.TrimSpace(term)
+			for strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") && balanced(term[1:len(term)-1]) {
+				term = term[1 : len(term)-1]
+			}
+			name := applyCheck(constraints, fieldType, term)
+			if name == "" {
+				parsed = false
+				continue
+			}
+			applied = append(applied, name)
+		}
+		if !parsed {
+			constraints.Checks = append(constraints.Checks, check)
+		}
+	}
+	return applied
+}
+
+// applyCheck sets the constraint a term of a check stands for and returns
+// its name, or "" when the term has no Table Schema equivalent.
+func applyCheck(constraints *Constraints, fieldType, term string) string {
+	if m := checkRangePattern.FindStringSubmatch(term); m != nil {
+		// Negative constants are printed quoted, as in '-40'::integer.
+		value, err := strconv.ParseFloat(strings.Trim(m[3], "'"), 64)
+		if err != nil {
+			return ""
+		}
+		var bound interface{} = value
+		if fieldType == "integer" {
+			n := int64(value)
+			switch m[2] {
+			case ">":
+				n++
+			case "<":
+				n--
+			}
+			bound = n
+		} else if m[2] == ">" || m[2] == "<" {
+			// Table Schema has no exclusive bounds for numbers.
+			return ""
+		}
+		if m[2][0] == '>' {
+			constraints.Minimum = bound
+			return "minimum"
+		}
+		constraints.Maximum = bound
+		return "maximum"
+	}
+	if m := checkLengthPattern.FindStringSubmatch(term); m != nil {
+		n, _ := strconv.Atoi(m[3])
+		switch m[2] {
+		case ">":
+			n++
+		case "<":
+			n--
+		}
+		if m[2][0] == '>' {
+			constraints.MinLength = &n
+			return "minLength"
+		}
+		constraints.MaxLength = &n
+		return "maxLength"
+	}
+	if m := checkEnumPattern.FindStringSubmatch(term); m != nil {
+		var enum []interface{}
+		for _, literal := range checkLiteral.FindAllStringSubmatch(m[2], -1) {
+			number := literal[2]
+			if strings.HasPrefix(literal[0], "'") {
+				if fieldType != "integer" && fieldType != "number" {
+					enum = append(enum, strings.ReplaceAll(literal[1], "''", "'"))
+					continue
+				}
+				number = literal[1]
+			}
+			if value, err := strconv.ParseFloat(number, 64); err == nil && fieldType == "integer" {
+				enum = append(enum, int64(value))
+			} else if err == nil {
+				enum = append(enum, value)
+			}
+		}
+		if len(enum) == 0 {
+			return ""
+		}
+		constraints.Enum = enum
+		return "enum"
+	}
+	if m := checkRegexPattern.FindStringSubmatch(term); m != nil {
+		pattern := strings.ReplaceAll(m[2], "''", "'")
+		if _, err := regexp.Compile(pattern); err != nil {
+			return ""
+		}
+		constraints.Pattern = pattern
+		return "pattern"
+	}
+	return ""
+}
+
+// balanced tells whether the brackets of s pair up, so that brackets around
+// it can be dropped.
+func balanced(s string) bool {
+	depth := 0
+	quoted := false
+	for _, ch := range s {
+		switch {
+		case ch == '\'':
+			quoted = !quoted
+		case quoted:
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// applyDeclared overrides the inferred metadata of a field with what the
+// catalog declares for its column.
+func applyDeclared(field *Fields, column *declaredColumn) {
+	if column == nil {
+		return
+	}
+	if column.comment != "" {
+		field.Description = column.comment
+	}
+	field.Default = column.def
+	if format, ok := typeFormats[column.typeName]; ok && field.Type == "string" {
+		field.Format = format
+	}
+	constraints := field.Constraints
+	if constraints == nil {
+		constraints = &Constraints{}
+	}
+	var declared []string
+	if column.notNull {
+		constraints.Required = true
+		declared = append(declared, "required")
+	}
+	if column.unique {
+		constraints.Unique = true
+		declared = append(declared, "unique")
+	}
+	if column.maxLength != nil {
+		constraints.MaxLength = column.maxLength
+		declared = append(declared, "maxLength")
+	}
+	if len(column.labels) > 0 {
+		constraints.Enum = nil
+		for _, label := range column.labels {
+			constraints.Enum = append(constraints.Enum, label)
+		}
+		declared = append(declared, "enum")
+	}
+	declared = append(declared, applyChecks(constraints, field.Type, column.checks)...)
+	if len(declared) == 0 && len(constraints.Checks) == 0 {
+		return
+	}
+	constraints.Declared = declared
+	field.Constraints = constraints
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intPointer(n int) *int { return &n }
+
+// TestApplyChecks parses CHECK constraints as pg_get_constraintdef prints
+// them, casts, brackets and quoted negative constants included.
+func TestApplyChecks(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType string
+		check     string
+		want      Constraints
+		applied   []string
+	}{
+		{"exclusive integer bound", "integer", "CHECK ((quantity > 0))",
+			Constraints{Minimum: int64(1)}, []string{"minimum"}},
+		// BETWEEN is printed as two comparisons.
+		{"between", "integer", "CHECK (((quantity >= 1) AND (quantity <= 100)))",
+			Constraints{Minimum: int64(1), Maximum: int64(100)}, []string{"minimum", "maximum"}},
+		{"negative integer", "integer", "CHECK ((temperature >= '-40'::integer))",
+			Constraints{Minimum: int64(-40)}, []string{"minimum"}},
+		{"numeric cast", "number", "CHECK ((price >= (0)::numeric))",
+			Constraints{Minimum: 0.0}, []string{"minimum"}},
+		{"negative numeric", "number", "CHECK ((price >= '-0.5'::numeric))",
+			Constraints{Minimum: -0.5}, []string{"minimum"}},
+		{"numeric range", "number", "CHECK (((price >= 0.5) AND (price <= 99.99)))",
+			Constraints{Minimum: 0.5, Maximum: 99.99}, []string{"minimum", "maximum"}},
+		// Table Schema has no exclusive bound for numbers.
+		{"exclusive numeric bound", "number", "CHECK ((price > (0)::numeric))",
+			Constraints{Checks: []string{"CHECK ((price > (0)::numeric))"}}, nil},
+		{"quoted column", "number", `CHECK (("Unit Price" >= (0)::numeric))`,
+			Constraints{Minimum: 0.0}, []string{"minimum"}},
+		{"text enum", "string", "CHECK ((status = ANY (ARRAY['open'::text, 'closed'::text, 'won''t fix'::text])))",
+			Constraints{Enum: []interface{}{"open", "closed", "won't fix"}}, []string{"enum"}},
+		{"varchar enum", "string", "CHECK (((status)::text = ANY ((ARRAY['a'::character varying, 'b'::character varying])::text[])))",
+			Constraints{Enum: []interface{}{"a", "b"}}, []string{"enum"}},
+		{"integer enum", "integer", "CHECK ((level = ANY (ARRAY['-1'::integer, 0, 1])))",
+			Constraints{Enum: []interface{}{int64(-1), int64(0), int64(1)}}, []string{"enum"}},
+		{"length range", "string", "CHECK (((char_length(code) >= 2) AND (char_length(code) <= 5)))",
+			Constraints{MinLength: intPointer(2), MaxLength: intPointer(5)}, []string{"minLength", "maxLength"}},
+		{"varchar length", "string", "CHECK ((char_length((code)::text) < 10))",
+			Constraints{MaxLength: intPointer(9)}, []string{"maxLength"}},
+		{"pattern", "string", "CHECK (((code)::text ~ '^[A-Z]{3}$'::text))",
+			Constraints{Pattern: "^[A-Z]{3}$"}, []string{"pattern"}},
+		{"invalid pattern", "string", "CHECK ((code ~ '(['::text))",
+			Constraints{Checks: []string{"CHECK ((code ~ '(['::text))"}}, nil},
+		{"not valid", "integer", "CHECK ((quantity >= 0)) NOT VALID",
+			Constraints{Minimum: int64(0)}, []string{"minimum"}},
+		// The parts that translate are applied, and the check is kept.
+		{"partly parsed", "number", "CHECK (((price > discount) AND (price <= (100)::numeric)))",
+			Constraints{Maximum: 100.0, Checks: []string{"CHECK (((price > discount) AND (price <= (100)::numeric)))"}}, []string{"maximum"}},
+		{"date", "date", "CHECK ((placed > '2000-01-01'::date))",
+			Constraints{Checks: []string{"CHECK ((placed > '2000-01-01'::date))"}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got Constraints
+			applied := applyChecks(&got, test.fieldType, []string{test.check})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("constraints = %+v, want %+v", got, test.want)
+			}
+			if !reflect.DeepEqual(applied, test.applied) {
+				t.Errorf("applied = %v, want %v", applied, test.applied)
+			}
+		})
+	}
+}
+
+func TestApplyDeclared(t *testing.T) {
+	field := Fields{
+		Name:        "status",
+		Type:        "string",
+		Description: "status",
+		Constraints: &Constraints{Enum: []interface{}{"open"}, MinLength: intPointer(4)},
+	}
+	applyDeclared(&field, &declaredColumn{
+		notNull:   true,
+		def:       "'open'::order_status",
+		comment:   "Where the order is",
+		maxLength: intPointer(12),
+		labels:    []string{"open", "closed"},
+		checks:    []string{"CHECK ((status <> 'void'::order_status))"},
+	})
+	want := &Constraints{
+		Required:  true,
+		MinLength: intPointer(4),
+		MaxLength: intPointer(12),
+		Enum:      []interface{}{"open", "closed"},
+		Checks:    []string{"CHECK ((status <> 'void'::order_status))"},
+		Declared:  []string{"required", "maxLength", "enum"},
+	}
+	if !reflect.DeepEqual(field.Constraints, want) {
+		t.Errorf("constraints = %+v, want %+v", field.Constraints, want)
+	}
+	if field.Description != "Where the order is" || field.Default != "'open'::order_status" {
+		t.Errorf("description, default = %q, %q", field.Description, field.Default)
+	}
+
+	uuid := Fields{Name: "id", Type: "string", Format: "default"}
+	applyDeclared(&uuid, &declaredColumn{typeName: "uuid"})
+	if uuid.Format != "uuid" || uuid.Constraints != nil {
+		t.Errorf("uuid column = %+v, want the uuid format and no constraints", uuid)
+	}
+}
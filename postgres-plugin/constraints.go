@@ -0,0 +1,17 @@
+package main
+
+import (
+	"profiling"
+	"profiling/datapackage"
+)
+
+// getConstraints infers the constraints of a profiled column from its
+// statistics, its exact integer range and a sample of its values. The
+// lengths come from the length aggregates, which cover every row.
+func getConstraints(field Fields, integers *profiling.IntegerRange, sample *valueSample) *Constraints {
+	var lengths *profiling.LengthRange
+	if length := field.Stats.Length; length != nil {
+		lengths = &profiling.LengthRange{Min: length.MinLength, Max: length.MaxLength, Seen: true}
+	}
+	return datapackage.InferConstraints(field, integers, lengths, sample.shape)
+}
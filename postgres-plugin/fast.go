@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/lib/pq"
+	"profiling"
+)
+
+// Fast profiling. In "fast" mode a large table is not scanned: the row
+// count is the planner's reltuples, the null, distinct and most common
+// value counts come from the pg_stats gathered by ANALYZE, and the
+// remaining statistics are computed over a TABLESAMPLE SYSTEM sample of
+// fastSampleRows rows or samplePercent of the table. Every statistic that
+// is an estimate is named in the field's Stats.Estimated. Tables that were
+// never analyzed, cannot be sampled or are small enough to scan are
+// profiled in full.
+
+var defaultProfileMode = "full"
+
+var fastSampleRows = 100000
+
+// sampledKinds are the relations TABLESAMPLE can read.
+var sampledKinds = map[string]bool{"table": true, "materialized view": true, "partitioned table": true}
+
+// columnStatistics is a column's row of pg_stats.
+type columnStatistics struct {
+	nullFrac     float64
+	nDistinct    float64
+	commonValues []string
+	commonFreqs  []float64
+	bounds       []string
+}
+
+type tableEstimates struct {
+	rows    int
+	percent float64
+	columns map[string]*columnStatistics
+}
+
+// getTableEstimates reads the planner statistics of a relation, returning
+// nil when it is to be profiled in full.
+func getTableEstimates(db *sql.DB, relation tableRef, samplePercent float64) (*tableEstimates, error) {
+	if !sampledKinds[relation.Kind] {
+		return nil, nil
+	}
+	rows, err := estimatedRows(db, relation.quoted())
+	if err != nil {
+		return nil, err
+	}
+	if rows < 0 || rows <= fastSampleRows {
+		return nil, nil
+	}
+	estimates := &tableEstimates{rows: rows, columns: map[string]*columnStatistics{}}
+	estimates.percent = samplePercent
+	if estimates.percent <= 0 || estimates.percent > 100 {
+		estimates.percent = math.Min(100, 100*float64(fastSampleRows)/float64(rows))
+	}
+
+	// A parent's statistics including its children, if any, describe what
+	// selecting from it returns, so they are read last and win.
+	result, err := db.Query(`SELECT attname, null_frac, n_distinct,
+		most_common_vals::text, most_common_freqs, histogram_bounds::text
+		FROM pg_stats
+		WHERE schemaname = $1 AND tablename = $2
+		ORDER BY inherited;`, relation.Schema, relation.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var name string
+		column := &columnStatistics{}
+		if err := result.Scan(&name, &column.nullFrac, &column.nDistinct, pq.Array(&column.commonValues), pq.Array(&column.commonFreqs), pq.Array(&column.bounds)); err != nil {
+			return nil, err
+		}
+		estimates.columns[name] = column
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	if len(estimates.columns) == 0 {
+		return nil, nil
+	}
+	return estimates, nil
+}
+
+// source is the sampled relation to read in place of the table. The seed
+// is fixed so that every query reads the same sample.
+func (e *tableEstimates) source(table string) string {
+	return fmt.Sprintf("%s TABLESAMPLE SYSTEM (%s) REPEATABLE (0)", table, strconv.FormatFloat(e.percent, 'f', -1, 64))
+}
+
+// widen extends the sampled range of numeric columns to the most common
+// values and histogram bounds ANALYZE saw, which the sample may miss.
+func (e *tableEstimates) widen(columns, types []string, aggregates *tableAggregates) {
+	for i, column := range columns {
+		statistics, agg := e.columns[column], aggregates.columns[column]
+		if statistics == nil || agg == nil || agg.finite == 0 || (types[i] != "integer" && types[i] != "number") {
+			continue
+		}
+		for _, values := range [][]string{statistics.commonValues, statistics.bounds} {
+			for _, value := range values {
+				if n, err := strconv.ParseInt(value, 10, 64); err == nil && agg.integers != nil {
+					agg.integers.Add(n)
+				}
+				x, err := strconv.ParseFloat(value, 64)
+				if err != nil || math.IsNaN(x) || math.Abs(x) > finiteBound {
+					continue
+				}
+				agg.min, agg.max = math.Min(agg.min, x), math.Max(agg.max, x)
+			}
+		}
+	}
+}
+
+// scale brings the counts of a distribution computed over the sample to
+// the size of the table.
+func scale(d *profiling.Distribution, sampled, present int) {
+	if d == nil || sampled == 0 {
+		return
+	}
+	factor := float64(present) / float64(sampled)
+	d.ZeroCount = int(math.Round(float64(d.ZeroCount) * factor))
+	d.NegativeCount = int(math.Round(float64(d.NegativeCount) * factor))
+	if d.Histogram != nil {
+		for i := range d.Histogram.Bins {
+			d.Histogram.Bins[i].Count = int(math.Round(float64(d.Histogram.Bins[i].Count) * factor))
+		}
+	}
+}
+
+// stats fills the statistics of a column from pg_stats and the aggregates
+// of the sample, naming every estimate.
+func (e *tableEstimates) stats(column, fieldType string, agg *columnAggregates) Stats {
+	statistics := e.columns[column]
+	if statistics == nil {
+		statistics = &columnStatistics{}
+	}
+	nullCount := int(math.Round(statistics.nullFrac * float64(e.rows)))
+	presentCount := e.rows - nullCount
+	// A negative n_distinct is the share of the rows that are distinct,
+	// which ANALYZE uses when the count grows with the table.
+	uniqueCount := int(math.Round(statistics.nDistinct))
+	if statistics.nDistinct < 0 {
+		uniqueCount = int(math.Round(-statistics.nDistinct * float64(e.rows)))
+	}
+	if uniqueCount > presentCount {
+		uniqueCount = presentCount
+	}
+
+	stats := Stats{
+		NullValueCounts:    nullCount,
+		PresentValueCounts: presentCount,
+		UniqueValueCounts:  uniqueCount,
+		UniqueCountMethod:  "pg_stats",
+		NullProportion:     proportion(nullCount, e.rows),
+		UniqueProportion:   proportion(uniqueCount, presentCount),
+		Sample_value:        []string{},
+		Estimated:          []string{"nullValueCounts", "present_value_counts", "uniqueValueCounts", "nullProportion", "uniqueProportion", "topValues"},
+	}
+	if presentCount == 0 {
+		return stats
+	}
+	agg.stats(&stats)
+	switch fieldType {
+	case "integer", "number":
+		scale(agg.dist, agg.present, presentCount)
+		stats.Distribution = agg.dist
+		stats.Estimated = append(stats.Estimated, "min", "max", "mean", "std", "distribution")
+	case "date", "time", "datetime":
+		stats.Estimated = append(stats.Estimated, "minDate", "maxDate")
+	case "string":
+		stats.Estimated = append(stats.Estimated, "length")
+	}
+	return stats
+}
+
+// frequencies loads the most common values of pg_stats, given as shares
+// of the rows, into a FrequencySketch.
+func (e *tableEstimates) frequencies(column string, stats Stats) *profiling.FrequencySketch {
+	frequencies := profiling.NewFrequencySketch()
+	if statistics := e.columns[column]; statistics != nil && len(statistics.commonValues) == len(statistics.commonFreqs) {
+		for i, value := range statistics.commonValues {
+			frequencies.Counts[value] = int(math.Round(statistics.commonFreqs[i] * float64(e.rows)))
+		}
+	}
+	frequencies.Total = stats.PresentValueCounts
+	frequencies.Overflow = stats.UniqueValueCounts > len(frequencies.Counts)
+	return frequencies
+}
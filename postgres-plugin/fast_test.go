@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"profiling"
+)
+
+func TestEstimatedSource(t *testing.T) {
+	e := &tableEstimates{percent: 2.5}
+	if got, want := e.source(`"public"."orders"`), `"public"."orders" TABLESAMPLE SYSTEM (2.5) REPEATABLE (0)`; got != want {
+		t.Errorf("source() = %s, want %s", got, want)
+	}
+}
+
+func TestUnsampledKinds(t *testing.T) {
+	// Views and foreign tables cannot be sampled, so there is nothing to
+	// ask the database.
+	for _, kind := range []string{"view", "foreign table"} {
+		estimates, err := getTableEstimates(nil, tableRef{Schema: "public", Name: "v", Kind: kind}, 0)
+		if estimates != nil || err != nil {
+			t.Errorf("%s: getTableEstimates() = %v, %v, want a full profile", kind, estimates, err)
+		}
+	}
+}
+
+func TestEstimatedStats(t *testing.T) {
+	e := &tableEstimates{rows: 1000000, columns: map[string]*columnStatistics{
+		"amount": {nullFrac: 0.1, nDistinct: -0.5},
+		"status": {nullFrac: 0, nDistinct: 3},
+		// n_distinct can exceed the present rows ANALYZE estimated.
+		"code": {nullFrac: 0.5, nDistinct: -0.9},
+	}}
+
+	// The sample held 1000 of the 900000 present amounts.
+	dist := &profiling.Distribution{ZeroCount: 10, NegativeCount: 2, Histogram: &profiling.Histogram{Bins: []profiling.HistogramBin{{Count: 600}, {Count: 400}}}}
+	amount := e.stats("amount", "number", &columnAggregates{present: 1000, min: -5, max: 80, mean: 20, dist: dist})
+	if amount.NullValueCounts != 100000 || amount.PresentValueCounts != 900000 || amount.UniqueValueCounts != 500000 {
+		t.Errorf("amount counts = %d, %d, %d, want 100000, 900000, 500000", amount.NullValueCounts, amount.PresentValueCounts, amount.UniqueValueCounts)
+	}
+	if amount.NullProportion != 0.1 || amount.Min != -5 || amount.Max != 80 || amount.Mean != 20 {
+		t.Errorf("amount stats = %+v", amount)
+	}
+	if d := amount.Distribution; d.ZeroCount != 9000 || d.NegativeCount != 1800 || d.Histogram.Bins[0].Count != 540000 || d.Histogram.Bins[1].Count != 360000 {
+		t.Errorf("amount distribution = %+v, want counts scaled to the table", d)
+	}
+	want := []string{"nullValueCounts", "present_value_counts", "uniqueValueCounts", "nullProportion", "uniqueProportion", "topValues", "min", "max", "mean", "std", "distribution"}
+	if !reflect.DeepEqual(amount.Estimated, want) || amount.UniqueCountMethod != "pg_stats" {
+		t.Errorf("amount estimated = %v by %s, want %v by pg_stats", amount.Estimated, amount.UniqueCountMethod, want)
+	}
+
+	status := e.stats("status", "string", &columnAggregates{present: 1000})
+	if status.UniqueValueCounts != 3 || status.Estimated[len(status.Estimated)-1] != "length" {
+		t.Errorf("status = %d distinct, estimated %v, want 3 and a length estimate", status.UniqueValueCounts, status.Estimated)
+	}
+	if code := e.stats("code", "string", &columnAggregates{present: 1000}); code.UniqueValueCounts != 500000 || code.UniqueProportion != 1 {
+		t.Errorf("code = %d distinct (%v), want 500000 (1)", code.UniqueValueCounts, code.UniqueProportion)
+	}
+
+	// A column missing from pg_stats has no nulls and no distinct count.
+	if missing := e.stats("other", "integer", &columnAggregates{}); missing.PresentValueCounts != 1000000 || missing.UniqueValueCounts != 0 {
+		t.Errorf("unanalyzed column = %+v", missing)
+	}
+}
+
+func TestWiden(t *testing.T) {
+	e := &tableEstimates{columns: map[string]*columnStatistics{
+		"quantity": {commonValues: []string{"3", "12"}, bounds: []string{"1", "7", "20"}},
+		"price":    {commonValues: []string{"NaN", "Infinity"}, bounds: []string{"0.5", "99.5"}},
+		"status":   {commonValues: []string{"a", "z"}},
+	}}
+	quantity := &columnAggregates{finite: 10, min: 5, max: 10, integers: &profiling.IntegerRange{Min: 5, Max: 10, Seen: true}}
+	price := &columnAggregates{finite: 10, min: 2, max: 50}
+	status := &columnAggregates{finite: 0}
+	aggregates := &tableAggregates{columns: map[string]*columnAggregates{"quantity": quantity, "price": price, "status": status}}
+
+	e.widen([]string{"quantity", "price", "status"}, []string{"integer", "number", "string"}, aggregates)
+	if quantity.min != 1 || quantity.max != 20 || quantity.integers.Min != 1 || quantity.integers.Max != 20 {
+		t.Errorf("quantity = %v to %v, integers %+v, want 1 to 20", quantity.min, quantity.max, quantity.integers)
+	}
+	// NaN and infinity are not in any range.
+	if price.min != 0.5 || price.max != 99.5 {
+		t.Errorf("price = %v to %v, want 0.5 to 99.5", price.min, price.max)
+	}
+	if status.min != 0 || status.max != 0 {
+		t.Errorf("status widened to %v to %v", status.min, status.max)
+	}
+}
+
+func TestEstimatedFrequencies(t *testing.T) {
+	e := &tableEstimates{rows: 1000, columns: map[string]*columnStatistics{
+		"status": {commonValues: []string{"open", "closed"}, commonFreqs: []float64{0.6, 0.3}},
+	}}
+	frequencies := e.frequencies("status", Stats{PresentValueCounts: 950, UniqueValueCounts: 3})
+	if !reflect.DeepEqual(frequencies.Counts, map[string]int{"open": 600, "closed": 300}) {
+		t.Errorf("counts = %v, want open 600 and closed 300", frequencies.Counts)
+	}
+	// A third value is not among the most common ones.
+	if frequencies.Total != 950 || !frequencies.Overflow {
+		t.Errorf("total = %d, overflow = %v, want 950 and true", frequencies.Total, frequencies.Overflow)
+	}
+}
@@ -2,4 +2,9 @@ module server-postgres
 
 go 1.18
 
-require github.com/lib/pq v1.10.9 // indirect
+require (
+	github.com/lib/pq v1.10.9
+	profiling v0.0.0
+)
+
+replace profiling => ../profiling
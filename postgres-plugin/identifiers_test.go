@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// identifierTests are names that only work as quoted identifiers: a
+// reserved word, embedded quotes, a non-ASCII letter with a space, and
+// mixed case.
+var identifierTests = []struct {
+	name   string
+	quoted string
+}{
+	{"select", `"select"`},
+	{`a "b"`, `"a ""b"""`},
+	{"naïve col", `"naïve col"`},
+	{"Mixed Case", `"Mixed Case"`},
+}
+
+// captureDriver records the SQL it is sent and fails every query, so the
+// query a function generates can be checked without a database.
+type captureDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+var errCaptured = errors.New("query captured")
+
+var capture = &captureDriver{}
+
+func init() {
+	sql.Register("capture", capture)
+}
+
+func (d *captureDriver) Open(string) (driver.Conn, error) { return captureConn{d}, nil }
+
+func (d *captureDriver) take() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queries := d.queries
+	d.queries = nil
+	return queries
+}
+
+type captureConn struct{ d *captureDriver }
+
+func (c captureConn) Prepare(query string) (driver.Stmt, error) { return nil, c.record(query) }
+func (c captureConn) Close() error                              { return nil }
+func (c captureConn) Begin() (driver.Tx, error)                 { return nil, errCaptured }
+
+func (c captureConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return nil, c.record(query)
+}
+
+func (c captureConn) record(query string) error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	return errCaptured
+}
+
+func TestQuotedIdentifiers(t *testing.T) {
+	db, err := sql.Open("capture", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	options := newProfileOptions(DatabaseCredentials{DistinctMode: "exact"})
+
+	for _, test := range identifierTests {
+		t.Run(test.name, func(t *testing.T) {
+			relation := tableRef{Schema: test.name, Name: test.name, Kind: "table"}
+			table := test.quoted + "." + test.quoted
+			if got := relation.quoted(); got != table {
+				t.Errorf("quoted() = %s, want %s", got, table)
+			}
+
+			// Every query fails once captured, so each function sends one.
+			capture.take()
+			stats := Stats{PresentValueCounts: 1}
+			getTableAggregates(db, table, []string{test.name}, []string{"numeric"}, []string{"number"}, options)
+			getFrequencies(db, table, test.name, stats, options, true)
+			sampleValues(db, table, test.name)
+			getDistinctSketch(db, table, test.name)
+			queries := capture.take()
+			if len(queries) != 4 {
+				t.Fatalf("captured %d queries, want 4", len(queries))
+			}
+			for _, want := range []string{
+				"COUNT(" + test.quoted + ")",
+				"COUNT(DISTINCT " + test.quoted + ")",
+				"THEN " + test.quoted + "::float8 END",
+				"FROM " + table + ";",
+			} {
+				if !strings.Contains(queries[0], want) {
+					t.Errorf("aggregate query %s does not contain %s", queries[0], want)
+				}
+			}
+			for _, query := range queries[1:] {
+				if !strings.Contains(query, "FROM "+table+" WHERE "+test.quoted+" IS NOT NULL") {
+					t.Errorf("query %s does not read %s from %s", query, test.quoted, table)
+				}
+			}
+		})
+	}
+}
+
+func TestConnValue(t *testing.T) {
+	for value, want := range map[string]string{
+		"secret":     `'secret'`,
+		"with space": `'with space'`,
+		`it's`:       `'it\'s'`,
+		`back\slash`: `'back\\slash'`,
+	} {
+		if got := connValue(value); got != want {
+			t.Errorf("connValue(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	taken := map[string]bool{}
+	var got []string
+	for _, name := range []string{"orders", "orders", "", "orders", ""} {
+		got = append(got, uniqueName(name, taken))
+	}
+	want := []string{"orders", "orders-2", "table", "orders-3", "table-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueName() = %v, want %v", got, want)
+	}
+}
+
+// TestProfileIdentifiers profiles a table whose schema, name and columns
+// all need quoting, in full and in fast mode, against the database named
+// by POSTGRES_TEST_DSN.
+func TestProfileIdentifiers(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema, name := "Mixed Case", "select"
+	quoted := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+	columns := make([]string, len(identifierTests))
+	for i, test := range identifierTests {
+		columns[i] = test.quoted
+	}
+	for _, statement := range []string{
+		"DROP SCHEMA IF EXISTS " + pq.QuoteIdentifier(schema) + " CASCADE",
+		"CREATE SCHEMA " + pq.QuoteIdentifier(schema),
+		"CREATE TABLE " + quoted + " (" + columns[0] + " integer, " + columns[1] + " text, " + columns[2] + " numeric, " + columns[3] + " date)",
+		"INSERT INTO " + quoted + " SELECT i, 'v' || i, i / 7.0, date '2020-01-01' + i % 365 FROM generate_series(1, 2000) i",
+		// NaN and a number too large for float8 must not fail the table.
+		"INSERT INTO " + quoted + " (" + columns[2] + ") VALUES ('NaN'), (1e400), (NULL)",
+		"ANALYZE " + quoted,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	defer db.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE")
+
+	tables, err := getTables(db, []string{schema}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Schema != schema || tables[0].Name != name {
+		t.Fatalf("getTables() = %v, want %s.%s", tables, schema, name)
+	}
+
+	defer func(rows int) { fastSampleRows = rows }(fastSampleRows)
+	fastSampleRows = 100
+	for _, mode := range []string{"full", "fast"} {
+		t.Run(mode, func(t *testing.T) {
+			var resource Resource
+			options := newProfileOptions(DatabaseCredentials{ProfileMode: mode})
+			if _, err := generateSchema(db, tables[0], &resource, options); err != nil {
+				t.Fatal(err)
+			}
+			if resource.Title != schema+"."+name {
+				t.Errorf("title = %q, want %q", resource.Title, schema+"."+name)
+			}
+			if len(resource.Schema.Fields) != len(identifierTests) {
+				t.Fatalf("%d fields, want %d", len(resource.Schema.Fields), len(identifierTests))
+			}
+			for i, test := range identifierTests {
+				field := resource.Schema.Fields[i]
+				if field.Name != test.name {
+					t.Errorf("field %d = %q, want %q", i, field.Name, test.name)
+				}
+				if mode == "fast" && len(field.Stats.Estimated) == 0 {
+					t.Errorf("field %q: no estimated statistics in fast mode", field.Name)
+				}
+			}
+			stats := resource.Schema.Fields[2].Stats
+			if math.IsNaN(stats.Max) || math.IsInf(stats.Max, 0) || stats.Max > finiteBound {
+				t.Errorf("max of %q = %v, want a finite number", identifierTests[2].name, stats.Max)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"profiling/datapackage"
+)
+
+// Key candidates. Next to datapackage.json the plugin writes keys.json,
+// describing for every table the columns that could be primary or foreign
+// keys. Each column carries a KMV sketch, the smallest distinct value
+// hashes, from which the API estimates how far the values of one column are
+// contained in another's, across tables and plugins. The sketch is built
+// in the database with hashtextextended over the text form of the values,
+// which profiling.KeyHash reproduces for the CSV and JSON plugins.
+
+// uniquePairs returns the pairs of candidate columns whose combined values
+// never repeat, counting the distinct pairs in the database.
+func uniquePairs(db *sql.DB, table string, candidates []KeyColumn, rows int) ([][2]string, error) {
+	if len(candidates) < 2 || rows > datapackage.CompositeKeyRowLimit {
+		return nil, nil
+	}
+	var unique [][2]string
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			a, b := candidates[i].Field, candidates[j].Field
+			query := fmt.Sprintf("SELECT COUNT(DISTINCT (%s, %s)) FROM %s;", pq.QuoteIdentifier(a), pq.QuoteIdentifier(b), table)
+			var distinct int
+			if err := db.QueryRow(query).Scan(&distinct); err != nil {
+				return nil, err
+			}
+			if distinct == rows {
+				unique = append(unique, [2]string{a, b})
+			}
+		}
+	}
+	return unique, nil
+}
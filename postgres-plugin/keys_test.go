@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"profiling"
+)
+
+// TestKeyHash checks profiling.KeyHash hashes values as hashtextextended
+// does, on every tail length, against the database named by
+// POSTGRES_TEST_DSN; the other plugins' key sketches depend on it.
+func TestKeyHash(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values := []string{"naïve", "4111 1111 1111 1111", strings.Repeat("x", 100)}
+	for n := 0; n <= 25; n++ {
+		values = append(values, "abcdefghijklmnopqrstuvwxy"[:n])
+	}
+	for _, value := range values {
+		var hash int64
+		if err := db.QueryRow("SELECT hashtextextended($1, 0);", value).Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		if got := profiling.KeyHash(value); got != uint64(hash) {
+			t.Errorf("KeyHash(%q) = %x, hashtextextended = %x", value, got, uint64(hash))
+		}
+	}
+}
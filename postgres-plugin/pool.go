@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+// Concurrent profiling. Up to Concurrency tables are profiled at once, and
+// up to ColumnConcurrency columns of each, so the connection pool is sized
+// to their product. Every query is bounded by the server side
+// statement_timeout, and a table whose profile fails, by a timeout or
+// otherwise, is left out of the package without holding up the others and
+// listed with its error in the package's failed tables and the RPC reply.
+
+var defaultConcurrency = 4
+
+var defaultColumnConcurrency = 2
+
+// defaultStatementTimeout is the longest a single query may run, in seconds.
+var defaultStatementTimeout = 300
+
+// FailedTable is a table that could not be profiled.
+type FailedTable struct {
+	Table string `json:"table"`
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+}
+
+// forEach calls f for 0 to n-1, running at most limit calls at once, and
+// returns the first error.
+func forEach(n, limit int, f func(i int) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	slots := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := f(i); err != nil {
+				once.Do(func() { first = err })
+			}
+		}(i)
+	}
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	for _, limit := range []int{0, 1, 3, 10} {
+		var running, most int32
+		calls := make([]int32, 8)
+		err := forEach(len(calls), limit, func(i int) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&calls[i], 1)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("limit %d: forEach() = %v", limit, err)
+		}
+		for i, n := range calls {
+			if n != 1 {
+				t.Errorf("limit %d: f(%d) called %d times", limit, i, n)
+			}
+		}
+		// A limit below one runs the calls one at a time.
+		bound := int32(limit)
+		if bound < 1 {
+			bound = 1
+		}
+		if most > bound {
+			t.Errorf("limit %d: %d calls ran at once", limit, most)
+		}
+	}
+}
+
+func TestForEachError(t *testing.T) {
+	broken := errors.New("relation is broken")
+	var mu sync.Mutex
+	called := map[int]bool{}
+	err := forEach(6, 2, func(i int) error {
+		mu.Lock()
+		called[i] = true
+		mu.Unlock()
+		if i == 1 || i == 4 {
+			return broken
+		}
+		return nil
+	})
+	if err != broken {
+		t.Errorf("forEach() = %v, want %v", err, broken)
+	}
+	// One failure does not stop the other calls.
+	if len(called) != 6 {
+		t.Errorf("%d of 6 calls made", len(called))
+	}
+	if err := forEach(0, 2, func(int) error { return broken }); err != nil {
+		t.Errorf("forEach() over nothing = %v", err)
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"io/ioutil"
-	"math"
+	"path/filepath"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"profiling"
+	"profiling/datapackage"
 
 )
 
@@ -22,6 +25,37 @@ type DatabaseCredentials struct {
 	DBName          string `json:"dbname"`
 	PluginType      string `json:"pluginType"`
 	SourceDirectory string `json:"sourceDirectory"`
+
+	PackageName        string        `json:"packageName"`
+	PackageTitle       string        `json:"packageTitle"`
+	PackageDescription string        `json:"packageDescription"`
+	Licenses           []License     `json:"licenses"`
+	Sources            []Source      `json:"sources"`
+	Contributors       []Contributor `json:"contributors"`
+	LegacyOutput       bool          `json:"legacyOutput"`
+	Percentiles        []float64     `json:"percentiles"`
+	HistogramBins      int           `json:"histogramBins"`
+	HistogramType      string        `json:"histogramType"`
+	TopK               int           `json:"topK"`
+	EnumThreshold      int           `json:"enumThreshold"`
+	DistinctMode       string        `json:"distinctMode"`
+	SensitivePolicy    string        `json:"sensitivePolicy"`
+	// IncludeSchemas limits profiling to the listed schemas, every schema
+	// but the system ones when empty; ExcludeSchemas are skipped.
+	IncludeSchemas     []string      `json:"includeSchemas"`
+	ExcludeSchemas     []string      `json:"excludeSchemas"`
+	// ProfileMode "fast" estimates the statistics of large tables from
+	// pg_stats and a sample of SamplePercent of their rows.
+	ProfileMode        string        `json:"profileMode"`
+	SamplePercent      float64       `json:"samplePercent"`
+	// Concurrency and ColumnConcurrency bound the tables and the columns
+	// per table profiled at once; StatementTimeout is in seconds.
+	Concurrency        int           `json:"concurrency"`
+	ColumnConcurrency  int           `json:"columnConcurrency"`
+	StatementTimeout   int           `json:"statementTimeout"`
+	OutputPath         string        `json:"outputPath"`
+	// Failed is set in the reply to the tables that could not be profiled.
+	Failed             []FailedTable `json:"failed,omitempty"`
 }
 
 type MyRPCServer struct{}
@@ -43,76 +77,45 @@ func ReadCredentialsFromFile(filepath string) (DatabaseCredentials, error) {
 	return credentials, nil
 }
 
-type Stats struct {
-	Min                int      `json:"min"`
-	Max                int      `json:"max"`
-	Mean               int      `json:"mean"`
-	Std                int      `json:"std"`
-	NullValueCounts    int      `json:"nullValueCounts"`
-	PresentValueCounts int      `json:"present_value_counts"`
-	UniqueValueCounts  int      `json:"uniqueValueCounts"`
-	SampleValue        []string `json:"sample_value"`
-	NullProportion     int      `json:"nullProportion"`
-	UniqueProportion   int      `json:"uniqueProportion"`
-}
-
-type Constraints struct {
-	Required string `json:"required"`
-	Unique   string `json:"unique"`
-}
-
-type Fields struct {
-	Name        string      `json:"name"`
-	Types       string      `json:"types"`
-	Format      string      `json:"format"`
-	Description string      `json:"description"`
-	Constraints Constraints `json:"constraints"`
-	Stats       Stats       `json:"stats"`
-}
-
-type Schema struct {
-	Fields []Fields `json:"fields"`
-}
-
-type Resources []struct {
-	Profile     string `json:"profile"`
-	Name        string `json:"name"`
-	Path        string `json:"path"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Format      string `json:"format"`
-	Mediatype   string `json:"mediatype"`
-	Encoding    string `json:"encoding"`
-	Bytes       string `json:"bytes"`
-	Hash        string `json:"hash"`
-	Schema      Schema `json:"schema"`
-	Dialect     struct {
-		CaseSensitiveHeader string `json:"caseSensitiveHeader"`
-		Delimiter           string `json:"delimiter"`
-		DoubleQuote         string `json:"doubleQuote"`
-		Header              string `json:"header"`
-		LineTerminator      string `json:"lineTerminator"`
-		QuoteChar           string `json:"quoteChar"`
-		SkipInitialSpace    string `json:"skipInitialSpace"`
-		RowsCount           int    `json:"rowsCount"`
-		ColumnsCount        int    `json:"columnsCount"`
-	} `json:"dialect"`
-	Version string `json:"version"`
-}
+// The descriptor model is shared with the file plugins.
+type (
+	License             = datapackage.License
+	Source              = datapackage.Source
+	Contributor         = datapackage.Contributor
+	Stats               = datapackage.Stats
+	LengthStats         = datapackage.LengthStats
+	Constraints         = datapackage.Constraints
+	Fields              = datapackage.Fields
+	Schema              = datapackage.Schema
+	Dialect             = datapackage.Dialect
+	Resource            = datapackage.Resource
+	Resources           = datapackage.Resources
+	Sensitivity         = datapackage.Sensitivity
+	SensitiveField      = datapackage.SensitiveField
+	SensitivityReport   = datapackage.SensitivityReport
+	ForeignKey          = datapackage.ForeignKey
+	ForeignKeyReference = datapackage.ForeignKeyReference
+	KeyColumn           = datapackage.KeyColumn
+	KeyCandidates       = datapackage.KeyCandidates
+	KeyIndex            = datapackage.KeyIndex
+)
 
+// FrictionlessStruct is the data package with the tables that could not
+// be profiled.
 type FrictionlessStruct struct {
-	Profile     string    `json:"profile"`
-	Name        string    `json:"name"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Resources   Resources `json:"resources"`
+	datapackage.Package
+	// Failed lists the tables left out because profiling them failed.
+	Failed []FailedTable `json:"failed,omitempty"`
 }
 
 var (
 	jsonPath = "./json"
 )
 
-func postgres_plugin(credentials DatabaseCredentials) {
+// postgres_plugin profiles the tables of the database and returns the
+// directory the data package was written to, or "" when none was, and the
+// tables that could not be profiled.
+func postgres_plugin(credentials DatabaseCredentials) (string, []FailedTable) {
 	//credentials, err := ReadCredentialsFromFile("credentials.json")
 	//if err != nil {
 	//	log.Fatal("Failed to read database credentials:", err)
@@ -120,21 +123,20 @@ func postgres_plugin(credentials DatabaseCredentials) {
 
 	dbHost := credentials.Host
 	dbPort := credentials.Port
-	dbUser := credentials.User
-	dbPassword := credentials.Password
 	dbName := credentials.DBName
+	options := newProfileOptions(credentials)
 	// Connect to the PostgreSQL database
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", connString(credentials, options))
 	if err != nil {
 		log.Fatal("Failed to connect to the database:", err)
 	}
 	defer db.Close()
+	db.SetMaxOpenConns(options.Concurrency * options.ColumnConcurrency)
+	db.SetMaxIdleConns(options.Concurrency * options.ColumnConcurrency)
 	log.Println("Connected to the database successfully.")
 
 	// Retrieve the list of tables from the database
-	tables, err := getTables(db)
+	tables, err := getTables(db, credentials.IncludeSchemas, credentials.ExcludeSchemas)
 	if err != nil {
 		log.Fatal("Failed to retrieve tables:", err)
 	}
@@ -145,174 +147,636 @@ func postgres_plugin(credentials DatabaseCredentials) {
 		log.Fatal(err)
 	}
 
-	// Iterate over the tables and generate metadata for each table
-	for _, table := range tables {
-		err = generateSchema(db, table, &frictionlessData)
-		if err != nil {
-			log.Println(err)
+	// The template carries a single empty resource; every table gets its
+	// own copy of it in the package resources.
+	resourceTemplate := frictionlessData.Resources[0]
+	frictionlessData.Resources = Resources{}
+	setPackageMetadata(&frictionlessData, credentials)
+
+	// Generate metadata for the tables concurrently. A table that fails is
+	// listed as failed; the others are added in the order listed.
+	resources := make([]*Resource, len(tables))
+	keys := make([]*KeyCandidates, len(tables))
+	errs := make([]error, len(tables))
+	forEach(len(tables), options.Concurrency, func(i int) error {
+		resource := resourceTemplate
+		keys[i], errs[i] = generateSchema(db, tables[i], &resource, options)
+		if errs[i] == nil {
+			resources[i] = &resource
+		}
+		return nil
+	})
+
+	var failed []FailedTable
+	resourceKeys := []KeyCandidates{}
+	names := map[string]bool{}
+	for i, table := range tables {
+		if errs[i] != nil {
+			log.Printf("Failed to profile %s %s: %v\n", table.Kind, table.qualified(), errs[i])
+			failed = append(failed, FailedTable{Table: table.qualified(), Kind: table.Kind, Error: errs[i].Error()})
 			continue
 		}
+		resource := *resources[i]
+		resource.Name = uniqueName(resource.Name, names)
+		resource.Path = fmt.Sprintf("postgresql://%s:%d/%s", dbHost, dbPort, dbName)
+
+		frictionlessData.Resources = append(frictionlessData.Resources, resource)
+		keys[i].Resource = resource.Name
+		resourceKeys = append(resourceKeys, *keys[i])
+		log.Printf("Metadata generated for %s: %s\n", table.Kind, table.qualified())
+	}
 
-		// Generate the JSON file path and name
-		jsonFilePath := fmt.Sprintf("%s/%s.json", jsonPath, table)
+	if len(frictionlessData.Resources) == 0 {
+		log.Println("No tables profiled in database:", credentials.DBName)
+		return "", failed
+	}
 
-		// Marshal the frictionlessData into JSON format
-		jsonData, err := json.MarshalIndent(frictionlessData, "", "  ")
-		if err != nil {
-			log.Println(err)
-			continue
-		}
+	// Generate the JSON file path and name
+	jsonFilePath := fmt.Sprintf("%s/datapackage.json", jsonPath)
 
-		// Write the JSON data to a file
-		err = ioutil.WriteFile(jsonFilePath, jsonData, 0644)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
+	frictionlessData.Sensitivity = datapackage.NewSensitivityReport(&frictionlessData.Package, options.SensitivePolicy)
+	frictionlessData.Failed = failed
+
+	err = datapackage.ValidatePackage(&frictionlessData.Package)
+	if err != nil {
+		log.Println("Invalid data package, not written:", err)
+		return "", failed
+	}
+
+	// Marshal the frictionlessData into JSON format
+	var jsonData []byte
+	if credentials.LegacyOutput {
+		jsonData, err = json.MarshalIndent(datapackage.LegacyPackage(&frictionlessData.Package), "", "  ")
+	} else {
+		jsonData, err = json.MarshalIndent(frictionlessData, "", "  ")
+	}
+	if err != nil {
+		log.Println(err)
+		return "", failed
+	}
+
+	// Write the JSON data to a file
+	err = ioutil.WriteFile(jsonFilePath, jsonData, 0644)
+	if err != nil {
+		log.Println(err)
+		return "", failed
+	}
+
+	log.Printf("Data package written to: %s\n", jsonFilePath)
+
+	err = datapackage.WriteKeyIndex(jsonPath, KeyIndex{Package: frictionlessData.Name, Resources: resourceKeys})
+	if err != nil {
+		log.Println("Could not write key candidates:", err)
+	}
+	output, _ := filepath.Abs(jsonPath)
+	return output, failed
+}
+
+// profileOptions are the per-request profiling settings, with defaults.
+type profileOptions struct {
+	Percentiles     []float64
+	HistogramBins   int
+	HistogramType   string
+	TopK            int
+	EnumThreshold   int
+	DistinctMode    string
+	SensitivePolicy string
+	ProfileMode     string
+	SamplePercent   float64
+	// Concurrency is the number of tables profiled at once and
+	// ColumnConcurrency the number of columns of each; StatementTimeout is
+	// in seconds.
+	Concurrency       int
+	ColumnConcurrency int
+	StatementTimeout  int
+}
+
+func newProfileOptions(credentials DatabaseCredentials) profileOptions {
+	options := profileOptions{
+		Percentiles:     credentials.Percentiles,
+		HistogramBins:   credentials.HistogramBins,
+		HistogramType:   credentials.HistogramType,
+		TopK:            credentials.TopK,
+		EnumThreshold:   credentials.EnumThreshold,
+		DistinctMode:    credentials.DistinctMode,
+		SensitivePolicy: credentials.SensitivePolicy,
+		ProfileMode:     credentials.ProfileMode,
+		SamplePercent:   credentials.SamplePercent,
+
+		Concurrency:       credentials.Concurrency,
+		ColumnConcurrency: credentials.ColumnConcurrency,
+		StatementTimeout:  credentials.StatementTimeout,
+	}
+	if len(options.Percentiles) == 0 {
+		options.Percentiles = profiling.DefaultPercentiles
+	}
+	if options.HistogramBins <= 0 {
+		options.HistogramBins = profiling.DefaultHistogramBins
+	}
+	if options.TopK <= 0 {
+		options.TopK = profiling.DefaultTopK
+	}
+	if options.EnumThreshold <= 0 {
+		options.EnumThreshold = profiling.DefaultEnumThreshold
+	}
+	switch options.DistinctMode {
+	case "exact", "approximate", "auto":
+	default:
+		options.DistinctMode = profiling.DefaultDistinctMode
+	}
+	switch options.SensitivePolicy {
+	case "mask", "omit", "none":
+	default:
+		options.SensitivePolicy = datapackage.DefaultSensitivePolicy
+	}
+	switch options.ProfileMode {
+	case "full", "fast":
+	default:
+		options.ProfileMode = defaultProfileMode
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultConcurrency
+	}
+	if options.ColumnConcurrency <= 0 {
+		options.ColumnConcurrency = defaultColumnConcurrency
+	}
+	if options.StatementTimeout <= 0 {
+		options.StatementTimeout = defaultStatementTimeout
+	}
+	return options
+}
+
+// setPackageMetadata fills the package level properties from the request,
+// falling back to the database name when no package name is supplied.
+func setPackageMetadata(frictionlessData *FrictionlessStruct, credentials DatabaseCredentials) {
+	frictionlessData.Name = credentials.PackageName
+	if frictionlessData.Name == "" {
+		frictionlessData.Name = datapackage.Name(credentials.DBName)
+	}
+	frictionlessData.Title = credentials.PackageTitle
+	if frictionlessData.Title == "" {
+		frictionlessData.Title = frictionlessData.Name
+	}
+	frictionlessData.Description = credentials.PackageDescription
+	if frictionlessData.Description == "" {
+		frictionlessData.Description = fmt.Sprintf("Metadata for the database: %s", credentials.DBName)
+	}
+	frictionlessData.Licenses = credentials.Licenses
+	frictionlessData.Sources = credentials.Sources
+	frictionlessData.Contributors = credentials.Contributors
+	frictionlessData.StatsVersion = datapackage.StatsVersion
+}
+
+// connString is the connection string of the database; statement_timeout
+// is passed to the server as a run-time parameter of every connection.
+func connString(credentials DatabaseCredentials, options profileOptions) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable statement_timeout=%d",
+		connValue(credentials.Host), credentials.Port, connValue(credentials.User), connValue(credentials.Password),
+		connValue(credentials.DBName), options.StatementTimeout*1000)
+}
+
+// connValue quotes a connection string value, so passwords and names with
+// spaces or quotes are passed on as they are.
+func connValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
 
-		log.Printf("Metadata generated for table: %s\n", table)
+// uniqueName returns name, with a -2, -3... suffix when it is taken: table
+// names that differ only in characters resource names do not allow map to
+// the same name.
+func uniqueName(name string, taken map[string]bool) string {
+	if name == "" {
+		name = "table"
 	}
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// tableRef is a relation to profile: a table, a view, a materialized view,
+// a foreign table or a partitioned table.
+type tableRef struct {
+	Schema string
+	Name   string
+	Kind   string
 }
 
-func getTables(db *sql.DB) ([]string, error) {
+func (t tableRef) qualified() string {
+	return t.Schema + "." + t.Name
+}
+
+// quoted is the relation's name as an SQL identifier. Every identifier put
+// into generated SQL is quoted, so mixed case names, reserved words and
+// names holding quotes or spaces are read as they are and not as SQL.
+func (t tableRef) quoted() string {
+	return pq.QuoteIdentifier(t.Schema) + "." + pq.QuoteIdentifier(t.Name)
+}
+
+var relationKinds = map[string]string{
+	"r": "table",
+	"v": "view",
+	"m": "materialized view",
+	"f": "foreign table",
+	"p": "partitioned table",
+}
+
+// getTables lists the relations of the included schemas. Partitions are
+// left out, their rows being profiled through the partitioned table.
+func getTables(db *sql.DB, include, exclude []string) ([]tableRef, error) {
 	query := `
-		SELECT table_name 
-		FROM information_schema.tables 
-		WHERE table_schema = 'public'
-		AND table_type = 'BASE TABLE';
+		SELECT n.nspname, c.relname, c.relkind
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'v', 'm', 'f', 'p')
+		AND NOT c.relispartition
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg\_toast%'
+		AND n.nspname NOT LIKE 'pg\_temp%'
+		AND ($1::text[] IS NULL OR n.nspname = ANY($1::text[]))
+		AND NOT n.nspname = ANY(COALESCE($2::text[], '{}'))
+		ORDER BY 1, 2;
 	`
 
-	rows, err := db.Query(query)
+	var includeArg interface{}
+	if len(include) > 0 {
+		includeArg = pq.Array(include)
+	}
+	rows, err := db.Query(query, includeArg, pq.Array(exclude))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var tables []string
+	var tables []tableRef
 	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
+		var table tableRef
+		if err := rows.Scan(&table.Schema, &table.Name, &table.Kind); err != nil {
 			return nil, err
 		}
-		tables = append(tables, tableName)
+		table.Kind = relationKinds[table.Kind]
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	log.Println("Retrieved tables successfully.")
 	return tables, nil
 }
 
-func generateSchema(db *sql.DB, table string, frictionlessData *FrictionlessStruct) error {
-	// Generate schema metadata for the table
-	fields, err := getFields(db, table)
+func generateSchema(db *sql.DB, relation tableRef, resource *Resource, options profileOptions) (*KeyCandidates, error) {
+	table := relation.qualified()
+	catalog, err := getCatalog(db, relation)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Update the frictionlessData with table metadata
-	frictionlessData.Resources[0].Name = table
-	frictionlessData.Resources[0].Path = ""
-	frictionlessData.Resources[0].Title = table
-	frictionlessData.Resources[0].Description = fmt.Sprintf("Metadata for the table: %s", table)
-	frictionlessData.Resources[0].Schema.Fields = fields
+	// Generate schema metadata for the table
+	fields, keys, err := getFields(db, relation, catalog, options)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	// Update the resource with table metadata
+	resource.Name = datapackage.Name(table)
+	resource.Title = table
+	resource.Description = catalog.comment
+	if resource.Description == "" {
+		resource.Description = fmt.Sprintf("Metadata for the %s: %s", relation.Kind, table)
+	}
+	resource.Schema.Fields = fields
+	// Nulls are SQL NULLs; no text value stands for one.
+	resource.Schema.MissingValues = []string{}
+	if len(catalog.primaryKey) > 0 {
+		resource.Schema.PrimaryKey = keyFields(catalog.primaryKey)
+		keys.PrimaryKey = catalog.primaryKey
+	}
+	resource.Schema.ForeignKeys = catalog.foreignKeys
+	resource.Dialect = &Dialect{Schema: relation.Schema, Table: relation.Name}
+	resource.ColumnsCount = len(fields)
+	if len(fields) > 0 {
+		resource.RowsCount = fields[0].Stats.NullValueCounts + fields[0].Stats.PresentValueCounts
+		if len(fields[0].Stats.Estimated) > 0 {
+			resource.Estimated = []string{"rowsCount"}
+		}
+	}
+	if resource.Estimated == nil {
+		keys.UniquePairs, err = uniquePairs(db, relation.quoted(), datapackage.CompositeCandidates(keys.Columns), resource.RowsCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
 }
 
-func getFields(db *sql.DB, table string) ([]Fields, error) {
-	query := fmt.Sprintf("SELECT * FROM %s LIMIT 1;", table)
+// getFields profiles every column of a table, and returns the fields with
+// the columns that could be keys. What the catalog declares about a column
+// wins over what was inferred. Here and below, table is the quoted name of
+// the relation and column the bare name of the column; in fast mode source
+// is the sample of the table the remaining statistics are computed over.
+func getFields(db *sql.DB, relation tableRef, catalog *tableCatalog, options profileOptions) ([]Fields, *KeyCandidates, error) {
+	table := relation.quoted()
+	query := fmt.Sprintf("SELECT * FROM %s LIMIT 0;", table)
 
 	rows, err := db.Query(query)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer rows.Close()
-
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		rows.Close()
+		return nil, nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	dataTypes, err := rows.ColumnTypes()
+	dataTypes := make([]string, len(columns))
+	fieldTypes := make([]string, len(columns))
+	for i := range columns {
+		dataTypes[i] = strings.ToLower(columnTypes[i].DatabaseTypeName())
+		fieldTypes[i] = getFieldType(dataTypes[i])
+	}
+
+	var estimates *tableEstimates
+	if options.ProfileMode == "fast" {
+		estimates, err = getTableEstimates(db, relation, options.SamplePercent)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	source, aggregateOptions := table, options
+	if estimates != nil {
+		source = estimates.source(table)
+		aggregateOptions.DistinctMode = "approximate"
+	}
+	aggregates, err := getTableAggregates(db, source, columns, dataTypes, fieldTypes, aggregateOptions)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if estimates != nil {
+		estimates.widen(columns, fieldTypes, aggregates)
+	}
+	err = getHistograms(db, source, columns, aggregates, options.HistogramBins, options.HistogramType)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	var fields []Fields
-	for i, column := range columns {
-		dataType := dataTypes[i].DatabaseTypeName()
+	// Columns are profiled concurrently, each into its own slot so the
+	// fields keep the order of the table.
+	fields := make([]Fields, len(columns))
+	keyColumns := make([]*KeyColumn, len(columns))
+	err = forEach(len(columns), options.ColumnConcurrency, func(i int) error {
+		column, fieldType := columns[i], fieldTypes[i]
+		agg := aggregates.columns[column]
 
-		stats, err := getColumnStats(db, table, column)
+		sample, err := sampleValues(db, table, column)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		// The key sketch comes from the same grouping as the frequencies;
+		// a sketch of a sample could not tell whether one column's values
+		// are contained in another's, so fast mode leaves it empty.
+		keyed := datapackage.KeyTypes[fieldType]
+		sketch := profiling.NewKMVSketch(profiling.KeySketchSize)
+		var stats Stats
+		var frequencies *profiling.FrequencySketch
+		if estimates != nil {
+			stats = estimates.stats(column, fieldType, agg)
+			frequencies = estimates.frequencies(column, stats)
+		} else {
+			stats, err = getColumnStats(db, table, column, aggregates.rows, agg)
+			if err == nil {
+				frequencies, sketch, err = getFrequencies(db, table, column, stats, options, keyed)
+			}
+		}
+		if err != nil {
+			return err
 		}
+		stats.Sample_value = sample.values
+		stats.TopValues = frequencies.Top(options.TopK)
 
-		fields = append(fields, Fields{
-			Name:        column,
-			Types:       getFieldType(dataType),
-			Format:      "",
-			Description: "",
-			Constraints: Constraints{
-				Required: "",
-				Unique:   "",
-			},
+		field := Fields{
+			Name:  column,
+			Type:  fieldType,
 			Stats: stats,
-		})
+		}
+		if name, confidence, ok := sample.semantic.Result(); ok {
+			field.SemanticType = name
+			field.SemanticConfidence = confidence
+			if format, ok := profiling.SemanticFormats[name]; ok && fieldType == "string" && confidence == 1 && sample.size == stats.PresentValueCounts {
+				field.Format = format
+			}
+		}
+		field.Constraints = getConstraints(field, agg.integers, sample)
+		if categories := frequencies.Categories(options.EnumThreshold); categories != nil && fieldType != "boolean" && fieldType != "number" {
+			field.Stats.Categorical = true
+			field.Constraints.Enum = profiling.EnumValues(fieldType, categories)
+		}
+		applyDeclared(&field, catalog.columns[column])
+		field.Sensitivity = datapackage.ClassifySensitivity(column, field.SemanticType, sample.sensitive, options.SensitivePolicy)
+		datapackage.RedactField(&field, options.SensitivePolicy)
+		fields[i] = field
+
+		if keyed && field.Sensitivity == nil {
+			if key, ok := datapackage.NewKeyColumn(field, sketch, datapackage.KeyTypes); ok {
+				keyColumns[i] = &key
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return fields, nil
+	keys := &KeyCandidates{Columns: []KeyColumn{}}
+	for _, key := range keyColumns {
+		if key != nil {
+			keys.Columns = append(keys.Columns, *key)
+		}
+	}
+	return fields, keys, nil
+}
+
+// proportion is part/whole as a 0-1 fraction, zero for an empty whole.
+func proportion(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
 }
 
-func getColumnStats(db *sql.DB, table, column string) (Stats, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s IS NULL;", table, column)
+// getColumnStats completes the aggregates of a column with its distinct
+// count, estimated from a HyperLogLog sketch when the aggregate query did
+// not count them.
+func getColumnStats(db *sql.DB, table, column string, rowCount int, agg *columnAggregates) (Stats, error) {
+	nullCount := rowCount - agg.present
 
-	var nullCount int
-	err := db.QueryRow(query).Scan(&nullCount)
-	if err != nil {
-		return Stats{}, err
+	uniqueCount := agg.distinct
+	uniqueMethod, uniqueError := "exact", 0.0
+	if uniqueCount < 0 {
+		sketch, err := getDistinctSketch(db, table, column)
+		if err != nil {
+			return Stats{}, err
+		}
+		uniqueCount = sketch.Estimate()
+		if uniqueCount > agg.present {
+			uniqueCount = agg.present
+		}
+		uniqueMethod, uniqueError = "hyperloglog", sketch.RelativeError()
 	}
 
-	query = fmt.Sprintf("SELECT COUNT(DISTINCT %s) FROM %s;", column, table)
+	stats := Stats{
+		NullValueCounts:    nullCount,
+		PresentValueCounts: rowCount - nullCount,
+		UniqueValueCounts:  uniqueCount,
+		UniqueCountMethod:  uniqueMethod,
+		UniqueCountError:   uniqueError,
+		NullProportion:     proportion(nullCount, rowCount),
+		UniqueProportion:   proportion(uniqueCount, rowCount-nullCount),
+		Distribution:       agg.dist,
+	}
+	agg.stats(&stats)
+	return stats, nil
+}
+
+// getDistinctSketch builds a HyperLogLog sketch inside the database: each
+// value is hashed with hashtextextended (PostgreSQL 11+), the low bits pick
+// a register and the server keeps the highest rank per register, so only
+// the registers are sent back instead of sorting every distinct value.
+func getDistinctSketch(db *sql.DB, table, column string) (*profiling.HyperLogLog, error) {
+	quoted := pq.QuoteIdentifier(column)
+	sketch := profiling.NewHyperLogLog(profiling.HLLPrecision)
+	registers := 1 << profiling.HLLPrecision
+	restBits := 64 - int(profiling.HLLPrecision)
+	restMask := fmt.Sprintf("%d", uint64(1)<<uint(restBits)-1)
+	query := fmt.Sprintf(`SELECT h & %d, MAX(CASE WHEN (h >> %d) & %s = 0 THEN %d
+		ELSE %d - floor(log(2, ((h >> %d) & %s)::numeric))::int END)
+		FROM (SELECT hashtextextended(%s::text, 0) AS h FROM %s WHERE %s IS NOT NULL) hashed
+		GROUP BY 1;`,
+		registers-1, profiling.HLLPrecision, restMask, restBits+1,
+		restBits, profiling.HLLPrecision, restMask,
+		quoted, table, quoted)
 
-	var uniqueCount int
-	err = db.QueryRow(query).Scan(&uniqueCount)
+	rows, err := db.Query(query)
 	if err != nil {
-		return Stats{}, err
+		return nil, err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index, rank int
+		if err := rows.Scan(&index, &rank); err != nil {
+			return nil, err
+		}
+		sketch.Observe(index, uint8(rank))
+	}
+	return sketch, rows.Err()
+}
 
-	query = fmt.Sprintf("SELECT COUNT(*) FROM %s;", table)
+// getFrequencies counts the most common values in the database and loads
+// them into a FrequencySketch, which is marked inexact when the column has
+// more distinct values than were fetched. With keys, the same grouping
+// also yields the column's key sketch: the smallest hashes of its distinct
+// values, ordered as unsigned by flipping the sign bit.
+func getFrequencies(db *sql.DB, table, column string, stats Stats, options profileOptions, keys bool) (*profiling.FrequencySketch, *profiling.KMVSketch, error) {
+	limit := options.TopK
+	if options.EnumThreshold > limit {
+		limit = options.EnumThreshold
+	}
+	sketchSize := 0
+	if keys {
+		sketchSize = profiling.KeySketchSize
+	}
+	quoted := pq.QuoteIdentifier(column)
+	query := fmt.Sprintf(`WITH counts AS (SELECT %s::text AS value, COUNT(*) AS n FROM %s WHERE %s IS NOT NULL GROUP BY 1)
+		(SELECT value, n, NULL::int8 FROM counts ORDER BY n DESC, value LIMIT %d)
+		UNION ALL
+		(SELECT NULL, NULL, h FROM (SELECT hashtextextended(value, 0) AS h FROM counts) hashes
+		ORDER BY h # (-9223372036854775807 - 1) LIMIT %d);`,
+		quoted, table, quoted, limit, sketchSize)
 
-	var rowCount int
-	err = db.QueryRow(query).Scan(&rowCount)
+	rows, err := db.Query(query)
 	if err != nil {
-		return Stats{}, err
+		return nil, nil, err
 	}
+	defer rows.Close()
 
-	stats := Stats{
-		NullValueCounts:    nullCount,
-		PresentValueCounts: rowCount - nullCount,
-		UniqueValueCounts:  uniqueCount,
-		NullProportion:     int(math.Round(float64(nullCount) / float64(rowCount) * 100)),
-		UniqueProportion:   int(math.Round(float64(uniqueCount) / float64(rowCount) * 100)),
-		SampleValue:        []string{},
+	frequencies := profiling.NewFrequencySketch()
+	sketch := profiling.NewKMVSketch(profiling.KeySketchSize)
+	for rows.Next() {
+		var value sql.NullString
+		var count, hash sql.NullInt64
+		if err := rows.Scan(&value, &count, &hash); err != nil {
+			return nil, nil, err
+		}
+		if hash.Valid {
+			sketch.Add(uint64(hash.Int64))
+		} else {
+			frequencies.Counts[value.String] = int(count.Int64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
 	}
+	frequencies.Total = stats.PresentValueCounts
+	frequencies.Overflow = stats.UniqueValueCounts > len(frequencies.Counts)
+	return frequencies, sketch, nil
+}
 
-	query = fmt.Sprintf("SELECT DISTINCT %s FROM %s LIMIT 5;", column, table)
+// valueSample holds what was learnt from a sample of a column's values,
+// with the first few distinct ones as sample values.
+type valueSample struct {
+	values    []string
+	semantic  *profiling.SemanticClassifier
+	sensitive *profiling.SensitiveDetector
+	shape     *profiling.ShapeDetector
+	size      int
+}
+
+// sampleValueCount is the number of distinct sample values of a field.
+const sampleValueCount = 5
+
+// sampleValues runs the semantic, sensitive data and shape classifiers over
+// the first SemanticSampleSize non-null values of a column.
+func sampleValues(db *sql.DB, table, column string) (*valueSample, error) {
+	quoted := pq.QuoteIdentifier(column)
+	query := fmt.Sprintf("SELECT %s::text FROM %s WHERE %s IS NOT NULL LIMIT %d;", quoted, table, quoted, profiling.SemanticSampleSize)
 
 	rows, err := db.Query(query)
 	if err != nil {
-		return Stats{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
+	sample := &valueSample{
+		values:    []string{},
+		semantic:  profiling.NewSemanticClassifier(column),
+		sensitive: profiling.NewSensitiveDetector(),
+		shape:     profiling.NewShapeDetector(),
+	}
+	sampled := map[string]bool{}
 	for rows.Next() {
 		var value string
 		if err := rows.Scan(&value); err != nil {
-			return Stats{}, err
+			return nil, err
+		}
+		if len(sample.values) < sampleValueCount && !sampled[value] {
+			sampled[value] = true
+			sample.values = append(sample.values, value)
 		}
-		stats.SampleValue = append(stats.SampleValue, value)
+		sample.semantic.Add(value)
+		sample.sensitive.Add(value)
+		sample.shape.Add(value)
+		sample.size++
 	}
-
-	return stats, nil
+	return sample, rows.Err()
 }
 
 func getFieldType(dataType string) string {
@@ -321,7 +785,11 @@ func getFieldType(dataType string) string {
 		return "integer"
 	case "float4", "float8", "numeric", "decimal":
 		return "number"
-	case "date", "timestamp", "timestamptz":
+	case "date":
+		return "date"
+	case "time", "timetz":
+		return "time"
+	case "timestamp", "timestamptz":
 		return "datetime"
 	case "bool":
 		return "boolean"
@@ -335,10 +803,11 @@ func getFrictionlessSchema() (FrictionlessStruct, error) {
 	frictionlessData := FrictionlessStruct{}
 	jsonData := `
 		{
-			"profile": "tabular-data-resource",
+			"profile": "tabular-data-package",
 			"name": "",
 			"title": "",
 			"description": "",
+			"version": "1.0.0",
 			"resources": [
 				{
 					"profile": "tabular-data-resource",
@@ -346,28 +815,14 @@ func getFrictionlessSchema() (FrictionlessStruct, error) {
 					"path": "",
 					"title": "",
 					"description": "",
-					"format": "",
-					"mediatype": "",
-					"encoding": "",
-					"bytes": "",
-					"hash": "",
+					"format": "postgresql",
 					"schema": {
 						"fields": []
 					},
-					"dialect": {
-						"caseSensitiveHeader": "",
-						"delimiter": "",
-						"doubleQuote": "",
-						"header": "",
-						"lineTerminator": "",
-						"quoteChar": "",
-						"skipInitialSpace": "",
-						"rowsCount": 0,
-						"columnsCount": 0
-					}
+					"rowsCount": 0,
+					"columnsCount": 0
 				}
-			],
-			"version": ""
+			]
 		}
 	`
 
@@ -380,14 +835,18 @@ func getFrictionlessSchema() (FrictionlessStruct, error) {
 }
 
 func (s *MyRPCServer) GetData(args DatabaseCredentials, reply *DatabaseCredentials) error {
-	// Print received data on the console
-	fmt.Println("Received data:", args)
+	// Print received data on the console, without the password
+	logged := args
+	if logged.Password != "" {
+		logged.Password = "********"
+	}
+	fmt.Println("Received data:", logged)
 
 	// You can perform additional processing or save the data in the server
 	
 
 	*reply = args // Set the reply value
-	postgres_plugin(args)
+	reply.OutputPath, reply.Failed = postgres_plugin(args)
 	return nil
 }
 
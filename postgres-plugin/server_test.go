@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestGetColumnStats(t *testing.T) {
+	// With the distinct values counted by the aggregate query no sketch
+	// is needed, so there is no database to ask.
+	agg := &columnAggregates{present: 3, distinct: 2, min: 72.5, max: 73.34, mean: 72.78, std: 0.485}
+	stats, err := getColumnStats(nil, `"listings"`, `"price"`, 5, agg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Min != 72.5 || stats.Max != 73.34 || stats.Mean != 72.78 || stats.Std != 0.485 {
+		t.Errorf("min, max, mean, std = %v, %v, %v, %v, want the aggregates unrounded", stats.Min, stats.Max, stats.Mean, stats.Std)
+	}
+	// Proportions are 0-1 fractions: nulls over rows, distinct values over
+	// present ones.
+	if stats.NullValueCounts != 2 || stats.NullProportion != 0.4 {
+		t.Errorf("nulls = %d (%v), want 2 (0.4)", stats.NullValueCounts, stats.NullProportion)
+	}
+	if stats.UniqueValueCounts != 2 || math.Abs(stats.UniqueProportion-2.0/3) > 1e-9 {
+		t.Errorf("unique = %d (%v), want 2 (2/3)", stats.UniqueValueCounts, stats.UniqueProportion)
+	}
+	if stats.UniqueCountMethod != "exact" {
+		t.Errorf("method = %s, want exact", stats.UniqueCountMethod)
+	}
+
+	empty, err := getColumnStats(nil, `"listings"`, `"price"`, 0, &columnAggregates{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.NullProportion != 0 || empty.UniqueProportion != 0 {
+		t.Errorf("empty table proportions = %v, %v, want 0, 0", empty.NullProportion, empty.UniqueProportion)
+	}
+}
+
+// listDriver answers every query with the rows of pg_class it was given,
+// and records the arguments sent with it.
+type listDriver struct {
+	rows [][]driver.Value
+	args []driver.NamedValue
+}
+
+var relations = &listDriver{}
+
+func init() {
+	sql.Register("relations", relations)
+}
+
+func (d *listDriver) Open(string) (driver.Conn, error) { return listConn{d}, nil }
+
+type listConn struct{ d *listDriver }
+
+func (c listConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c listConn) Close() error                        { return nil }
+func (c listConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c listConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.args = args
+	return &listRows{rows: c.d.rows}, nil
+}
+
+type listRows struct{ rows [][]driver.Value }
+
+func (r *listRows) Columns() []string { return []string{"nspname", "relname", "relkind"} }
+func (r *listRows) Close() error      { return nil }
+
+func (r *listRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestGetTables(t *testing.T) {
+	db, err := sql.Open("relations", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	relations.rows = [][]driver.Value{
+		{"public", "orders", "r"},
+		{"public", "order_totals", "v"},
+		{"reporting", "daily", "m"},
+		{"remote", "events", "f"},
+		{"sales", "measurements", "p"},
+	}
+
+	tables, err := getTables(db, []string{"public", "reporting"}, []string{"audit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tableRef{
+		{"public", "orders", "table"},
+		{"public", "order_totals", "view"},
+		{"reporting", "daily", "materialized view"},
+		{"remote", "events", "foreign table"},
+		{"sales", "measurements", "partitioned table"},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("getTables() = %v, want %v", tables, want)
+	}
+	if include, exclude := relations.args[0].Value, relations.args[1].Value; include != "{\"public\",\"reporting\"}" || exclude != "{\"audit\"}" {
+		t.Errorf("schema arguments = %v, %v", include, exclude)
+	}
+
+	// No include list means every schema, sent as NULL.
+	relations.rows = nil
+	if _, err := getTables(db, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if include, exclude := relations.args[0].Value, relations.args[1].Value; include != nil || exclude != nil {
+		t.Errorf("schema arguments = %v, %v, want NULL, NULL", include, exclude)
+	}
+}
+
+// TestGetTablesCatalog lists the relations of schemas made for the test in
+// the database named by POSTGRES_TEST_DSN.
+func TestGetTablesCatalog(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, statement := range []string{
+		"DROP SCHEMA IF EXISTS profile_a, profile_b CASCADE",
+		"CREATE SCHEMA profile_a",
+		"CREATE SCHEMA profile_b",
+		"CREATE TABLE profile_a.orders (id integer, placed date)",
+		"CREATE VIEW profile_a.recent AS SELECT * FROM profile_a.orders WHERE placed > now() - interval '1 day'",
+		"CREATE MATERIALIZED VIEW profile_a.totals AS SELECT count(*) FROM profile_a.orders",
+		"CREATE TABLE profile_a.readings (at date, value numeric) PARTITION BY RANGE (at)",
+		"CREATE TABLE profile_a.readings_2020 PARTITION OF profile_a.readings FOR VALUES FROM ('2020-01-01') TO ('2021-01-01')",
+		"CREATE TABLE profile_b.audit (entry text)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	defer db.Exec("DROP SCHEMA profile_a, profile_b CASCADE")
+
+	tables, err := getTables(db, []string{"profile_a", "profile_b"}, []string{"profile_b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The partition is profiled through its parent, and profile_b is
+	// excluded.
+	want := []tableRef{
+		{"profile_a", "orders", "table"},
+		{"profile_a", "readings", "partitioned table"},
+		{"profile_a", "recent", "view"},
+		{"profile_a", "totals", "materialized view"},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("getTables() = %v, want %v", tables, want)
+	}
+}
+
+func TestConcurrencyOptions(t *testing.T) {
+	options := newProfileOptions(DatabaseCredentials{})
+	if options.Concurrency != defaultConcurrency || options.ColumnConcurrency != defaultColumnConcurrency || options.StatementTimeout != defaultStatementTimeout {
+		t.Errorf("defaults = %d, %d, %d", options.Concurrency, options.ColumnConcurrency, options.StatementTimeout)
+	}
+	options = newProfileOptions(DatabaseCredentials{Concurrency: 8, ColumnConcurrency: -1, StatementTimeout: 30})
+	if options.Concurrency != 8 || options.ColumnConcurrency != defaultColumnConcurrency || options.StatementTimeout != 30 {
+		t.Errorf("options = %d, %d, %d, want 8, %d, 30", options.Concurrency, options.ColumnConcurrency, options.StatementTimeout, defaultColumnConcurrency)
+	}
+}
+
+func TestConnString(t *testing.T) {
+	credentials := DatabaseCredentials{Host: "db.local", Port: 5433, User: "profiler", Password: `it's a \secret`, DBName: "sales", StatementTimeout: 30}
+	conn := connString(credentials, newProfileOptions(credentials))
+	want := `host='db.local' port=5433 user='profiler' password='it\'s a \\secret' dbname='sales' sslmode=disable statement_timeout=30000`
+	if conn != want {
+		t.Errorf("connString() = %s, want %s", conn, want)
+	}
+	if _, err := pq.NewConnector(conn); err != nil {
+		t.Errorf("pq cannot parse %s: %v", conn, err)
+	}
+}
+
+// TestStatementTimeout checks that a relation slower than the statement
+// timeout fails on its own, against the database named by
+// POSTGRES_TEST_DSN.
+func TestStatementTimeout(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// One connection, so the timeout set on it covers every query.
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range []string{
+		"DROP SCHEMA IF EXISTS profile_timeout CASCADE",
+		"CREATE SCHEMA profile_timeout",
+		"CREATE TABLE profile_timeout.quick AS SELECT i AS id FROM generate_series(1, 100) i",
+		"CREATE VIEW profile_timeout.slow AS SELECT id, pg_sleep(0.05)::text AS nap FROM profile_timeout.quick",
+		"SET statement_timeout = 1000",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	defer db.Exec("DROP SCHEMA profile_timeout CASCADE")
+
+	options := newProfileOptions(DatabaseCredentials{})
+	var resource Resource
+	if _, err := generateSchema(db, tableRef{Schema: "profile_timeout", Name: "slow", Kind: "view"}, &resource, options); err == nil || !strings.Contains(err.Error(), "statement timeout") {
+		t.Errorf("slow view: generateSchema() = %v, want a statement timeout", err)
+	}
+	if _, err := generateSchema(db, tableRef{Schema: "profile_timeout", Name: "quick", Kind: "table"}, &resource, options); err != nil {
+		t.Errorf("quick table: generateSchema() = %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package profiling
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Array and object values. Cells holding JSON arrays or objects, or the
+// Python list and dict literals that pandas and friends write out, are read
+// the same way by the profiler and the validator.
+
+// ParseCollection reads value as JSON, falling back to a Python literal
+// for values that look like one.
+func ParseCollection(value string) (interface{}, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || !(value[0] == '[' && value[len(value)-1] == ']' || value[0] == '{' && value[len(value)-1] == '}') {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err == nil {
+		return v, true
+	}
+	if converted, ok := pythonToJSON(value); ok {
+		if err := json.Unmarshal([]byte(converted), &v); err == nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// pythonToJSON rewrites single-quoted strings and the True, False and None
+// literals of a Python repr as JSON. The result still has to parse.
+func pythonToJSON(value string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			quote := ch
+			b.WriteByte('"')
+			for i++; i < len(value) && value[i] != quote; i++ {
+				switch {
+				case value[i] == '\\' && i+1 < len(value):
+					i++
+					if value[i] == '\'' {
+						b.WriteByte('\'')
+					} else {
+						b.WriteByte('\\')
+						b.WriteByte(value[i])
+					}
+				case value[i] == '"':
+					b.WriteString(`\"`)
+				default:
+					b.WriteByte(value[i])
+				}
+			}
+			if i == len(value) {
+				return "", false
+			}
+			b.WriteByte('"')
+		case strings.HasPrefix(value[i:], "True"):
+			b.WriteString("true")
+			i += 3
+		case strings.HasPrefix(value[i:], "False"):
+			b.WriteString("false")
+			i += 4
+		case strings.HasPrefix(value[i:], "None"):
+			b.WriteString("null")
+			i += 3
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,65 @@
+package datapackage
+
+import (
+	"encoding/json"
+	"path/filepath"
+)
+
+// Incremental ingestion. The API keeps the resource and key candidates a
+// plugin wrote for each file content, and on the next ingestion sends the
+// plugin only the files that changed, with the cached profiles of the
+// others, so every ingestion still gets one package covering all of its
+// files.
+
+// CachedResource is the profile of File, a path relative to the source
+// directory, as an earlier package and key index recorded it.
+type CachedResource struct {
+	File     string
+	Resource json.RawMessage
+	Keys     json.RawMessage
+}
+
+// FileSelector reports whether the file at path, under dir, is to be
+// profiled: every file unless files or cached are given, else only files.
+func FileSelector(dir string, files []string, cached []CachedResource) func(path string) bool {
+	if files == nil && cached == nil {
+		return func(string) bool { return true }
+	}
+	selected := map[string]bool{}
+	for _, file := range files {
+		selected[filepath.Clean(file)] = true
+	}
+	return func(path string) bool {
+		rel, err := filepath.Rel(dir, path)
+		return err == nil && selected[rel]
+	}
+}
+
+// AddCached appends the cached resources to the package under their
+// current paths, and their key candidates to keys.
+func AddCached(pkg *Package, keys []KeyCandidates, dir string, cached []CachedResource) ([]KeyCandidates, error) {
+	for _, c := range cached {
+		var resource Resource
+		if err := json.Unmarshal(c.Resource, &resource); err != nil {
+			return keys, err
+		}
+		path := filepath.Join(dir, c.File)
+		resource.Path = path
+		resource.Name = ResourceName(path)
+		resource.Title = filepath.Base(path)
+		// Keys are linked again across the whole package.
+		resource.Schema.PrimaryKey, resource.Schema.ForeignKeys = nil, nil
+		pkg.Resources = append(pkg.Resources, resource)
+
+		if len(c.Keys) == 0 {
+			continue
+		}
+		var candidates KeyCandidates
+		if err := json.Unmarshal(c.Keys, &candidates); err != nil {
+			return keys, err
+		}
+		candidates.Resource = resource.Name
+		keys = append(keys, candidates)
+	}
+	return keys, nil
+}
@@ -0,0 +1,82 @@
+package datapackage
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSelector(t *testing.T) {
+	dir := filepath.Join("data", "in")
+	cached := []CachedResource{{File: "old.csv"}}
+	tests := []struct {
+		name   string
+		files  []string
+		cached []CachedResource
+		want   map[string]bool
+	}{
+		{"everything", nil, nil, map[string]bool{"new.csv": true, "old.csv": true, "sub/more.csv": true}},
+		{"changed files", []string{"new.csv", "sub/more.csv"}, cached, map[string]bool{"new.csv": true, "sub/more.csv": true}},
+		// Nothing changed: the package is assembled from the cache alone.
+		{"only cached", nil, cached, map[string]bool{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := FileSelector(dir, test.files, test.cached)
+			for _, file := range []string{"new.csv", "old.csv", "sub/more.csv"} {
+				if got := selected(filepath.Join(dir, file)); got != test.want[file] {
+					t.Errorf("selected(%s) = %v, want %v", file, got, test.want[file])
+				}
+			}
+		})
+	}
+}
+
+func TestAddCached(t *testing.T) {
+	resource, _ := json.Marshal(Resource{
+		Name: "old-name",
+		Path: "/elsewhere/old-name.csv",
+		Hash: "sha256:abc",
+		Schema: Schema{
+			Fields:      []Fields{{Name: "id", Type: "integer"}},
+			PrimaryKey:  []string{"id"},
+			ForeignKeys: []ForeignKey{{Fields: []string{"id"}}},
+		},
+		RowsCount: 3,
+	})
+	keys, _ := json.Marshal(KeyCandidates{Resource: "old-name", Columns: []KeyColumn{{Field: "id", Unique: true}}})
+
+	pkg := &Package{Resources: Resources{{Name: "profiled"}}}
+	got, err := AddCached(pkg, []KeyCandidates{{Resource: "profiled"}}, "in", []CachedResource{
+		{File: "copy.csv", Resource: resource, Keys: keys},
+		{File: "nokeys.csv", Resource: resource},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Resources) != 3 {
+		t.Fatalf("%d resources, want 3", len(pkg.Resources))
+	}
+	added := pkg.Resources[1]
+	if added.Path != filepath.Join("in", "copy.csv") || added.Name != "copy" || added.Title != "copy.csv" {
+		t.Errorf("cached resource not moved to its current path: %s %s %s", added.Path, added.Name, added.Title)
+	}
+	if added.Hash != "sha256:abc" || added.RowsCount != 3 || len(added.Schema.Fields) != 1 {
+		t.Errorf("cached profile lost: %+v", added)
+	}
+	if added.Schema.PrimaryKey != nil || added.Schema.ForeignKeys != nil {
+		t.Errorf("stale keys kept: %+v %+v", added.Schema.PrimaryKey, added.Schema.ForeignKeys)
+	}
+	var names []string
+	for _, k := range got {
+		names = append(names, k.Resource)
+	}
+	if want := []string{"profiled", "copy"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("key candidates for %q, want %q", names, want)
+	}
+
+	if _, err := AddCached(pkg, nil, "in", []CachedResource{{File: "bad.csv", Resource: json.RawMessage(`[`)}}); err == nil {
+		t.Error("AddCached() accepted a broken resource")
+	}
+}
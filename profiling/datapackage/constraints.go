@@ -0,0 +1,71 @@
+package datapackage
+
+import (
+	"math"
+
+	"profiling"
+)
+
+// Constraint inference. Every constraint is one the profiled data satisfies:
+// required when there are no nulls, unique when every value is distinct,
+// the observed range and lengths, and a pattern when all the values of a
+// string field share one shape. Confidence is "exact" unless a constraint
+// rests on an estimate, as unique does when values were counted with
+// HyperLogLog and a pattern does when its shape was seen on a sample.
+
+// maxExactInteger is 2^53: from there on, float64 skips integers, so a
+// bound read from the stats may be one the data breaks.
+const maxExactInteger = 1 << 53
+
+// InferConstraints infers the constraints of a profiled field from its
+// stats, the range of its integers, the lengths of its values and their
+// shape; nil when it has no values. Arrays and objects take their lengths
+// from the element stats when there are any.
+func InferConstraints(field Fields, integers *profiling.IntegerRange, lengths *profiling.LengthRange, shape *profiling.ShapeDetector) *Constraints {
+	stats := field.Stats
+	if stats.PresentValueCounts == 0 {
+		return nil
+	}
+	constraints := &Constraints{Confidence: "exact"}
+	constraints.Required = stats.NullValueCounts == 0
+	constraints.Unique = stats.UniqueValueCounts == stats.PresentValueCounts
+	if (constraints.Unique && stats.UniqueCountMethod != "exact") || len(stats.Estimated) > 0 {
+		constraints.Confidence = "estimated"
+	}
+	defaultFormat := field.Format == "" || field.Format == "default"
+
+	switch field.Type {
+	case "integer":
+		// The float64 stats only give the bounds when they are exact.
+		switch {
+		case integers != nil && integers.Seen:
+			constraints.Minimum, constraints.Maximum = integers.Min, integers.Max
+		case math.Abs(stats.Min) < maxExactInteger && math.Abs(stats.Max) < maxExactInteger:
+			constraints.Minimum, constraints.Maximum = int64(stats.Min), int64(stats.Max)
+		}
+	case "number":
+		constraints.Minimum = stats.Min
+		constraints.Maximum = stats.Max
+	case "date", "time", "datetime":
+		// MinDate and MaxDate are ISO 8601, which is the default format.
+		if defaultFormat && stats.MinDate != "" {
+			constraints.Minimum = stats.MinDate
+			constraints.Maximum = stats.MaxDate
+		}
+	case "string", "array", "object":
+		if elements := stats.Elements; elements != nil && field.Type != "string" {
+			lengths = &profiling.LengthRange{Min: elements.MinLength, Max: elements.MaxLength, Seen: true}
+		}
+		if lengths != nil && lengths.Seen {
+			minLength, maxLength := lengths.Min, lengths.Max
+			constraints.MinLength, constraints.MaxLength = &minLength, &maxLength
+		}
+		if field.Type == "string" && defaultFormat && shape != nil && stats.PresentValueCounts > 1 {
+			constraints.Pattern = shape.Pattern()
+			if constraints.Pattern != "" && shape.Count() < stats.PresentValueCounts {
+				constraints.Confidence = "estimated"
+			}
+		}
+	}
+	return constraints
+}
@@ -0,0 +1,110 @@
+package datapackage
+
+import (
+	"reflect"
+	"testing"
+
+	"profiling"
+)
+
+func shapeOf(values ...string) *profiling.ShapeDetector {
+	shape := profiling.NewShapeDetector()
+	for _, v := range values {
+		shape.Add(v)
+	}
+	return shape
+}
+
+func TestInferConstraints(t *testing.T) {
+	exact := Stats{PresentValueCounts: 3, UniqueValueCounts: 3, UniqueCountMethod: "exact"}
+	tests := []struct {
+		name     string
+		field    Fields
+		integers *profiling.IntegerRange
+		lengths  *profiling.LengthRange
+		shape    *profiling.ShapeDetector
+		want     *Constraints
+	}{
+		{
+			name:  "no values",
+			field: Fields{Type: "string", Stats: Stats{NullValueCounts: 2}},
+			want:  nil,
+		},
+		{
+			// 2^53 + 1 is not a float64; the exact range keeps it.
+			name:     "large integers",
+			field:    Fields{Type: "integer", Stats: Stats{PresentValueCounts: 2, UniqueValueCounts: 2, UniqueCountMethod: "exact", Min: 9007199254740992, Max: 9007199254740992}},
+			integers: &profiling.IntegerRange{Min: 9007199254740992, Max: 9007199254740993, Seen: true},
+			want:     &Constraints{Confidence: "exact", Required: true, Unique: true, Minimum: int64(9007199254740992), Maximum: int64(9007199254740993)},
+		},
+		{
+			name:  "integers from stats",
+			field: Fields{Type: "integer", Stats: Stats{PresentValueCounts: 3, NullValueCounts: 1, UniqueValueCounts: 2, UniqueCountMethod: "exact", Min: -5, Max: 40}},
+			want:  &Constraints{Confidence: "exact", Minimum: int64(-5), Maximum: int64(40)},
+		},
+		{
+			// Without an exact range, float64 bounds past 2^53 are dropped
+			// rather than rounded.
+			name:  "inexact integer stats",
+			field: Fields{Type: "integer", Stats: Stats{PresentValueCounts: 2, UniqueValueCounts: 1, UniqueCountMethod: "exact", Min: 1, Max: 9007199254740992}},
+			want:  &Constraints{Confidence: "exact", Required: true},
+		},
+		{
+			name:  "numbers",
+			field: Fields{Type: "number", Stats: Stats{PresentValueCounts: 3, UniqueValueCounts: 3, UniqueCountMethod: "hyperloglog", Min: 0.5, Max: 2.5}},
+			want:  &Constraints{Confidence: "estimated", Required: true, Unique: true, Minimum: 0.5, Maximum: 2.5},
+		},
+		{
+			name:  "dates",
+			field: Fields{Type: "date", Format: "default", Stats: Stats{PresentValueCounts: 3, UniqueValueCounts: 1, UniqueCountMethod: "exact", MinDate: "2020-01-01", MaxDate: "2020-12-31"}},
+			want:  &Constraints{Confidence: "exact", Required: true, Minimum: "2020-01-01", Maximum: "2020-12-31"},
+		},
+		{
+			// Dates in another format do not compare as ISO strings.
+			name:  "formatted dates",
+			field: Fields{Type: "date", Format: "%d/%m/%Y", Stats: Stats{PresentValueCounts: 3, UniqueValueCounts: 1, UniqueCountMethod: "exact", MinDate: "2020-01-01", MaxDate: "2020-12-31"}},
+			want:  &Constraints{Confidence: "exact", Required: true},
+		},
+		{
+			name:    "string shape",
+			field:   Fields{Type: "string", Format: "default", Stats: exact},
+			lengths: &profiling.LengthRange{Min: 6, Max: 7, Seen: true},
+			shape:   shapeOf("AB-123", "CD-4567", "EF-890"),
+			want:    &Constraints{Confidence: "exact", Required: true, Unique: true, MinLength: intPtr(6), MaxLength: intPtr(7), Pattern: "[A-Z]{2}-[0-9]{3,4}"},
+		},
+		{
+			// A shape seen on a sample only is an estimate.
+			name:    "sampled shape",
+			field:   Fields{Type: "string", Stats: exact},
+			lengths: &profiling.LengthRange{Min: 6, Max: 6, Seen: true},
+			shape:   shapeOf("AB-123", "CD-456"),
+			want:    &Constraints{Confidence: "estimated", Required: true, Unique: true, MinLength: intPtr(6), MaxLength: intPtr(6), Pattern: "[A-Z]{2}-[0-9]{3}"},
+		},
+		{
+			name:    "free text",
+			field:   Fields{Type: "string", Format: "default", Stats: exact},
+			lengths: &profiling.LengthRange{Min: 1, Max: 11, Seen: true},
+			shape:   shapeOf("hello world", "a", "Yes"),
+			want:    &Constraints{Confidence: "exact", Required: true, Unique: true, MinLength: intPtr(1), MaxLength: intPtr(11)},
+		},
+		{
+			name:    "array elements",
+			field:   Fields{Type: "array", Stats: Stats{PresentValueCounts: 3, UniqueValueCounts: 3, UniqueCountMethod: "exact", Elements: &ElementStats{MinLength: 0, MaxLength: 4}}},
+			lengths: &profiling.LengthRange{Min: 2, Max: 9, Seen: true},
+			want:    &Constraints{Confidence: "exact", Required: true, Unique: true, MinLength: intPtr(0), MaxLength: intPtr(4)},
+		},
+		{
+			name:  "estimated stats",
+			field: Fields{Type: "number", Stats: Stats{PresentValueCounts: 3, UniqueValueCounts: 2, UniqueCountMethod: "exact", Min: 1, Max: 2, Estimated: []string{"min", "max"}}},
+			want:  &Constraints{Confidence: "estimated", Required: true, Minimum: 1.0, Maximum: 2.0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := InferConstraints(test.field, test.integers, test.lengths, test.shape)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("InferConstraints() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
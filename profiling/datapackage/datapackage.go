@@ -0,0 +1,379 @@
+package datapackage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Descriptor validation against the Data Package, Tabular Data Resource,
+// Table Schema and CSV Dialect specs, plus the legacy output shape that
+// consumers written against the first version of this plugin still read.
+
+var namePattern = regexp.MustCompile(`^([-a-z0-9._/])+$`)
+
+var fieldTypes = map[string][]string{
+	"string":    {"default", "email", "uri", "binary", "uuid"},
+	"number":    {"default"},
+	"integer":   {"default"},
+	"boolean":   {"default"},
+	"object":    {"default"},
+	"array":     {"default"},
+	"date":      {"default", "any"},
+	"time":      {"default", "any"},
+	"datetime":  {"default", "any"},
+	"year":      {"default"},
+	"yearmonth": {"default"},
+	"duration":  {"default"},
+	"geopoint":  {"default", "array", "object"},
+	"geojson":   {"default", "topojson"},
+	"any":       {"default"},
+}
+
+// ValidatePackage checks the package against its profile and every resource
+// against the resource profile, returning all problems found at once.
+func ValidatePackage(pkg *Package) error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch pkg.Profile {
+	case "data-package", "tabular-data-package":
+	default:
+		report("package: unknown profile %q", pkg.Profile)
+	}
+	if !namePattern.MatchString(pkg.Name) {
+		report("package: name %q must match %s", pkg.Name, namePattern)
+	}
+	if len(pkg.Resources) == 0 {
+		report("package: resources must not be empty")
+	}
+	for i, license := range pkg.Licenses {
+		if license.Name == "" && license.Path == "" {
+			report("package: licenses[%d] needs a name or a path", i)
+		}
+	}
+	for i, source := range pkg.Sources {
+		if source.Title == "" {
+			report("package: sources[%d] needs a title", i)
+		}
+	}
+	for i, contributor := range pkg.Contributors {
+		if contributor.Title == "" {
+			report("package: contributors[%d] needs a title", i)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, resource := range pkg.Resources {
+		if names[resource.Name] {
+			report("resource %q: name is not unique in the package", resource.Name)
+		}
+		names[resource.Name] = true
+		if pkg.Profile == "tabular-data-package" && resource.Profile != "tabular-data-resource" {
+			report("resource %q: tabular-data-package only holds tabular-data-resource, got %q", resource.Name, resource.Profile)
+		}
+		for _, problem := range validateResource(&resource) {
+			report("resource %q: %s", resource.Name, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s): %s", len(problems), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateResource(resource *Resource) []string {
+	var problems []string
+	if !namePattern.MatchString(resource.Name) {
+		problems = append(problems, fmt.Sprintf("name must match %s", namePattern))
+	}
+	if resource.Path == "" {
+		problems = append(problems, "path is required")
+	}
+	if resource.Bytes < 0 {
+		problems = append(problems, "bytes must not be negative")
+	}
+	if resource.Hash != "" && !validHash(resource.Hash) {
+		problems = append(problems, fmt.Sprintf("hash %q is not an md5 digest or an <algorithm>:<hex digest>", resource.Hash))
+	}
+
+	switch resource.Profile {
+	case "data-resource":
+	case "tabular-data-resource":
+		if len(resource.Schema.Fields) == 0 {
+			problems = append(problems, "schema must have at least one field")
+		}
+		if resource.Dialect != nil {
+			problems = append(problems, validateDialect(resource.Dialect)...)
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown profile %q", resource.Profile))
+	}
+
+	fieldNames := map[string]bool{}
+	for _, field := range resource.Schema.Fields {
+		if field.Name == "" {
+			problems = append(problems, "field without a name")
+			continue
+		}
+		if fieldNames[field.Name] {
+			problems = append(problems, fmt.Sprintf("field %q: name is not unique", field.Name))
+		}
+		fieldNames[field.Name] = true
+
+		formats, ok := fieldTypes[field.Type]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("field %q: unknown type %q", field.Name, field.Type))
+			continue
+		}
+		if field.Format != "" && !validFormat(field.Format, formats) {
+			problems = append(problems, fmt.Sprintf("field %q: format %q is not valid for type %q", field.Name, field.Format, field.Type))
+		}
+	}
+
+	for _, name := range keyFieldNames(resource.Schema.PrimaryKey) {
+		if !fieldNames[name] {
+			problems = append(problems, fmt.Sprintf("primaryKey: no field %q", name))
+		}
+	}
+	for _, fk := range resource.Schema.ForeignKeys {
+		names := keyFieldNames(fk.Fields)
+		if len(names) == 0 || len(names) != len(keyFieldNames(fk.Reference.Fields)) {
+			problems = append(problems, fmt.Sprintf("foreignKeys: fields %v do not match reference fields %v", fk.Fields, fk.Reference.Fields))
+		}
+		for _, name := range names {
+			if !fieldNames[name] {
+				problems = append(problems, fmt.Sprintf("foreignKeys: no field %q", name))
+			}
+		}
+	}
+	return problems
+}
+
+// keyFieldNames lists the names of a primaryKey or foreignKeys fields
+// property, which is a name or a list of names.
+func keyFieldNames(fields interface{}) []string {
+	switch fields := fields.(type) {
+	case string:
+		return []string{fields}
+	case []string:
+		return fields
+	case []interface{}:
+		var names []string
+		for _, name := range fields {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+var hashLengths = map[string]int{"md5": 32, "sha1": 40, "sha256": 64, "sha512": 128}
+
+// validHash accepts a bare md5 digest or one prefixed with its algorithm.
+func validHash(h string) bool {
+	algorithm, digest := "md5", h
+	if i := strings.Index(h, ":"); i >= 0 {
+		algorithm, digest = h[:i], h[i+1:]
+	}
+	if len(digest) != hashLengths[algorithm] {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// validFormat accepts the formats listed for the type; date and time types
+// also accept any strptime style pattern.
+func validFormat(format string, formats []string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+		if f == "any" && strings.Contains(format, "%") {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDialect(dialect *Dialect) []string {
+	if dialect.Table != "" {
+		return nil
+	}
+	var problems []string
+	if len([]rune(dialect.Delimiter)) != 1 {
+		problems = append(problems, fmt.Sprintf("dialect: delimiter %q must be a single character", dialect.Delimiter))
+	}
+	if len([]rune(dialect.QuoteChar)) > 1 {
+		problems = append(problems, fmt.Sprintf("dialect: quoteChar %q must be a single character", dialect.QuoteChar))
+	}
+	if len([]rune(dialect.EscapeChar)) > 1 {
+		problems = append(problems, fmt.Sprintf("dialect: escapeChar %q must be a single character", dialect.EscapeChar))
+	}
+	switch dialect.LineTerminator {
+	case "\r\n", "\n", "\r":
+	default:
+		problems = append(problems, fmt.Sprintf("dialect: unsupported lineTerminator %q", dialect.LineTerminator))
+	}
+	return problems
+}
+
+// StatsVersion marks the package stats shape: version 2 stats are float
+// valued with 0-1 proportions, the legacy output keeps version 1.
+const StatsVersion = 2
+
+// legacyStats is the version 1 stats shape: rounded integers with the
+// proportions as percentages.
+type legacyStats struct {
+	Min                int      `json:"min"`
+	Max                int      `json:"max"`
+	Mean               int      `json:"mean"`
+	Std                int      `json:"std"`
+	NullValueCounts    int      `json:"nullValueCounts"`
+	PresentValueCounts int      `json:"present_value_counts"`
+	UniqueValueCounts  int      `json:"uniqueValueCounts"`
+	Sample_value       []string `json:"sample_value"`
+	NullProportion     int      `json:"nullProportion"`
+	UniqueProportion   int      `json:"uniqueProportion"`
+}
+
+func legacyStatsFrom(stats Stats) legacyStats {
+	return legacyStats{
+		Min:                int(math.Round(stats.Min)),
+		Max:                int(math.Round(stats.Max)),
+		Mean:               int(math.Round(stats.Mean)),
+		Std:                int(math.Round(stats.Std)),
+		NullValueCounts:    stats.NullValueCounts,
+		PresentValueCounts: stats.PresentValueCounts,
+		UniqueValueCounts:  stats.UniqueValueCounts,
+		Sample_value:       stats.Sample_value,
+		NullProportion:     int(math.Round(stats.NullProportion * 100)),
+		UniqueProportion:   int(math.Round(stats.UniqueProportion * 100)),
+	}
+}
+
+type legacyConstraints struct {
+	Required string `json:"required"`
+	Unique   string `json:"unique"`
+}
+
+type legacyFields struct {
+	Name        string            `json:"name"`
+	Types       string            `json:"types"`
+	Format      string            `json:"format"`
+	Description string            `json:"description"`
+	Constraints legacyConstraints `json:"constraints"`
+	Stats       legacyStats       `json:"stats"`
+}
+
+type legacyDialect struct {
+	CaseSensitiveHeader string `json:"caseSensitiveHeader"`
+	Delimiter           string `json:"delimiter"`
+	DoubleQuote         string `json:"doubleQuote"`
+	Header              string `json:"header"`
+	LineTerminator      string `json:"lineTerminator"`
+	QuoteChar           string `json:"quoteChar"`
+	SkipInitialSpace    string `json:"skipInitialSpace"`
+	RowsCount           int    `json:"rowsCount"`
+	ColumnsCount        int    `json:"columnsCount"`
+}
+
+type legacyResource struct {
+	Profile     string `json:"profile"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Format      string `json:"format"`
+	Mediatype   string `json:"mediatype"`
+	Encoding    string `json:"encoding"`
+	Bytes       string `json:"bytes"`
+	Hash        string `json:"hash"`
+	Schema      struct {
+		Fields []legacyFields `json:"fields"`
+	} `json:"schema"`
+	Dialect legacyDialect `json:"dialect"`
+	Version string        `json:"version"`
+}
+
+type LegacyDataPackage struct {
+	Profile     string           `json:"profile"`
+	Name        string           `json:"name"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Resources   []legacyResource `json:"resources"`
+}
+
+// LegacyPackage converts a validated package into the pre-spec output shape:
+// "types" instead of "type", string booleans, row and column counts inside
+// the dialect and the version repeated on each resource.
+func LegacyPackage(pkg *Package) LegacyDataPackage {
+	legacy := LegacyDataPackage{
+		Profile:     pkg.Profile,
+		Name:        pkg.Name,
+		Title:       pkg.Title,
+		Description: pkg.Description,
+	}
+	for _, resource := range pkg.Resources {
+		lr := legacyResource{
+			Profile:     resource.Profile,
+			Name:        resource.Name,
+			Path:        resource.Path,
+			Title:       resource.Title,
+			Description: resource.Description,
+			Format:      resource.Format,
+			Mediatype:   resource.Mediatype,
+			Encoding:    resource.Encoding,
+			Hash:        resource.Hash,
+			Version:     pkg.Version,
+		}
+		if resource.Bytes > 0 {
+			lr.Bytes = strconv.FormatInt(resource.Bytes, 10)
+		}
+		for _, field := range resource.Schema.Fields {
+			lf := legacyFields{
+				Name:        field.Name,
+				Types:       field.Type,
+				Format:      field.Format,
+				Description: field.Description,
+				Stats:       legacyStatsFrom(field.Stats),
+			}
+			if field.Constraints != nil {
+				lf.Constraints.Required = legacyBool(field.Constraints.Required)
+				lf.Constraints.Unique = legacyBool(field.Constraints.Unique)
+			}
+			lr.Schema.Fields = append(lr.Schema.Fields, lf)
+		}
+		if resource.Dialect != nil && resource.Dialect.Table == "" {
+			lr.Dialect = legacyDialect{
+				CaseSensitiveHeader: strconv.FormatBool(resource.Dialect.CaseSensitiveHeader),
+				Delimiter:           resource.Dialect.Delimiter,
+				DoubleQuote:         strconv.FormatBool(resource.Dialect.DoubleQuote),
+				Header:              strconv.FormatBool(resource.Dialect.Header),
+				LineTerminator:      resource.Dialect.LineTerminator,
+				QuoteChar:           resource.Dialect.QuoteChar,
+				SkipInitialSpace:    strconv.FormatBool(resource.Dialect.SkipInitialSpace),
+			}
+		}
+		lr.Dialect.RowsCount = resource.RowsCount
+		lr.Dialect.ColumnsCount = resource.ColumnsCount
+		legacy.Resources = append(legacy.Resources, lr)
+	}
+	return legacy
+}
+
+func legacyBool(b bool) string {
+	if b {
+		return "True"
+	}
+	return ""
+}
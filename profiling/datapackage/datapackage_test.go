@@ -0,0 +1,173 @@
+package datapackage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func validPackage() *Package {
+	return &Package{
+		Profile: "tabular-data-package",
+		Name:    "sales-2020",
+		Resources: Resources{{
+			Profile: "tabular-data-resource",
+			Name:    "orders",
+			Path:    "data/orders.csv",
+			Hash:    "sha256:" + strings.Repeat("ab", 32),
+			Bytes:   120,
+			Schema: Schema{
+				Fields: []Fields{
+					{Name: "id", Type: "integer"},
+					{Name: "placed", Type: "date", Format: "%d/%m/%Y"},
+					{Name: "email", Type: "string", Format: "email"},
+				},
+				PrimaryKey:  "id",
+				ForeignKeys: []ForeignKey{{Fields: "id", Reference: ForeignKeyReference{Resource: "", Fields: "id"}}},
+			},
+			Dialect: &Dialect{Delimiter: ",", LineTerminator: "\r\n", QuoteChar: "\"", Header: true},
+		}},
+	}
+}
+
+func TestValidatePackage(t *testing.T) {
+	if err := ValidatePackage(validPackage()); err != nil {
+		t.Fatalf("ValidatePackage() = %v for a valid package", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Package)
+		want   string
+	}{
+		{"profile", func(p *Package) { p.Profile = "package" }, `unknown profile "package"`},
+		{"package name", func(p *Package) { p.Name = "Sales 2020" }, "package: name"},
+		{"no resources", func(p *Package) { p.Resources = nil }, "resources must not be empty"},
+		{"license", func(p *Package) { p.Licenses = []License{{Title: "Open"}} }, "licenses[0] needs a name or a path"},
+		{"source", func(p *Package) { p.Sources = []Source{{Path: "http://example.com"}} }, "sources[0] needs a title"},
+		{"duplicate resource", func(p *Package) { p.Resources = append(p.Resources, p.Resources[0]) }, "name is not unique in the package"},
+		{"resource profile", func(p *Package) { p.Resources[0].Profile = "data-resource" }, "only holds tabular-data-resource"},
+		{"path", func(p *Package) { p.Resources[0].Path = "" }, "path is required"},
+		{"hash", func(p *Package) { p.Resources[0].Hash = "sha256:abc" }, "is not an md5 digest"},
+		{"no fields", func(p *Package) { p.Resources[0].Schema.Fields = nil }, "at least one field"},
+		{"duplicate field", func(p *Package) {
+			p.Resources[0].Schema.Fields = append(p.Resources[0].Schema.Fields, Fields{Name: "id", Type: "integer"})
+		}, `field "id": name is not unique`},
+		{"type", func(p *Package) { p.Resources[0].Schema.Fields[0].Type = "int" }, `unknown type "int"`},
+		{"format", func(p *Package) { p.Resources[0].Schema.Fields[2].Format = "%Y" }, `format "%Y" is not valid`},
+		{"primary key", func(p *Package) { p.Resources[0].Schema.PrimaryKey = []string{"id", "code"} }, `primaryKey: no field "code"`},
+		{"foreign key", func(p *Package) {
+			p.Resources[0].Schema.ForeignKeys[0].Reference.Fields = []string{"a", "b"}
+		}, "do not match reference fields"},
+		{"delimiter", func(p *Package) { p.Resources[0].Dialect.Delimiter = "||" }, "must be a single character"},
+		{"line terminator", func(p *Package) { p.Resources[0].Dialect.LineTerminator = ";" }, "unsupported lineTerminator"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkg := validPackage()
+			test.change(pkg)
+			err := ValidatePackage(pkg)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("ValidatePackage() = %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	// A database resource names its table instead of a dialect.
+	pkg := validPackage()
+	pkg.Resources[0].Dialect = &Dialect{Schema: "public", Table: "orders"}
+	if err := ValidatePackage(pkg); err != nil {
+		t.Errorf("ValidatePackage() = %v for a table resource", err)
+	}
+}
+
+func TestValidHash(t *testing.T) {
+	for hash, want := range map[string]bool{
+		strings.Repeat("0f", 16):             true,
+		"md5:" + strings.Repeat("0f", 16):    true,
+		"sha1:" + strings.Repeat("0f", 20):   true,
+		"sha256:" + strings.Repeat("0f", 32): true,
+		"sha512:" + strings.Repeat("0f", 64): true,
+		"sha256:" + strings.Repeat("0f", 16): false,
+		"crc32:0f0f0f0f":                     false,
+		"sha256:" + strings.Repeat("zz", 32): false,
+		"":                                   false,
+	} {
+		if got := validHash(hash); got != want {
+			t.Errorf("validHash(%q) = %v, want %v", hash, got, want)
+		}
+	}
+}
+
+func TestDialectJSON(t *testing.T) {
+	data, err := json.Marshal(Dialect{Schema: "public", Table: "orders", Delimiter: ","})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"schema":"public","table":"orders"}`; string(data) != want {
+		t.Errorf("table dialect = %s, want %s", data, want)
+	}
+	data, err = json.Marshal(Dialect{Delimiter: "\t", LineTerminator: "\n", Header: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"delimiter":"\t","lineTerminator":"\n","doubleQuote":false,"skipInitialSpace":false,"header":true,"caseSensitiveHeader":false}`; string(data) != want {
+		t.Errorf("csv dialect = %s, want %s", data, want)
+	}
+}
+
+func TestLegacyPackage(t *testing.T) {
+	pkg := validPackage()
+	pkg.Version = "1.0.0"
+	pkg.Resources[0].RowsCount, pkg.Resources[0].ColumnsCount = 4, 3
+	pkg.Resources[0].Schema.Fields[0].Constraints = &Constraints{Required: true, Unique: true}
+	pkg.Resources[0].Schema.Fields[0].Stats = Stats{
+		Min: 1, Max: 4.6, Mean: 2.5, Std: 1.29,
+		PresentValueCounts: 4, UniqueValueCounts: 4,
+		NullProportion: 0.2, UniqueProportion: 1,
+	}
+
+	data, err := json.Marshal(LegacyPackage(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy struct {
+		Resources []struct {
+			Bytes   string `json:"bytes"`
+			Version string `json:"version"`
+			Schema  struct {
+				Fields []struct {
+					Types       string            `json:"types"`
+					Constraints map[string]string `json:"constraints"`
+					Stats       map[string]interface{}
+				} `json:"fields"`
+			} `json:"schema"`
+			Dialect map[string]interface{} `json:"dialect"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	r := legacy.Resources[0]
+	if r.Bytes != "120" || r.Version != "1.0.0" {
+		t.Errorf("bytes = %q, version = %q, want 120 and 1.0.0", r.Bytes, r.Version)
+	}
+	id := r.Schema.Fields[0]
+	if id.Types != "integer" || id.Constraints["required"] != "True" || id.Constraints["unique"] != "True" {
+		t.Errorf("id = %+v, want integer types with True constraints", id)
+	}
+	if r.Schema.Fields[1].Constraints["required"] != "" {
+		t.Errorf("unconstrained field = %+v, want empty strings", r.Schema.Fields[1].Constraints)
+	}
+	// Version 1 stats are rounded, with percentages.
+	for key, want := range map[string]float64{"max": 5, "mean": 3, "std": 1, "nullProportion": 20, "uniqueProportion": 100} {
+		if got := id.Stats[key]; got != want {
+			t.Errorf("stats %s = %v, want %v", key, got, want)
+		}
+	}
+	for key, want := range map[string]interface{}{"header": "true", "doubleQuote": "false", "rowsCount": 4.0, "columnsCount": 3.0} {
+		if got := r.Dialect[key]; got != want {
+			t.Errorf("dialect %s = %#v, want %#v", key, got, want)
+		}
+	}
+}
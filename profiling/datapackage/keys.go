@@ -0,0 +1,97 @@
+package datapackage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"profiling"
+)
+
+// Key candidates. Next to datapackage.json the plugins write keys.json,
+// describing for every resource the columns that could be primary or
+// foreign keys. Each column carries a KMV sketch, the smallest distinct
+// value hashes, from which the API estimates how far the values of one
+// column are contained in another's, across resources and plugins.
+
+// CompositeKeyColumns and CompositeKeyRowLimit bound the search for
+// composite keys in resources without a single-column key.
+var (
+	CompositeKeyColumns  = 4
+	CompositeKeyRowLimit = 1000000
+)
+
+type KeyColumn struct {
+	Field    string   `json:"field"`
+	Type     string   `json:"type"`
+	Distinct int      `json:"distinct"`
+	Unique   bool     `json:"unique"`
+	Required bool     `json:"required"`
+	Exact    bool     `json:"exact"`
+	Hashes   []uint64 `json:"hashes"`
+}
+
+type KeyCandidates struct {
+	Resource    string      `json:"resource"`
+	Columns     []KeyColumn `json:"columns"`
+	UniquePairs [][2]string `json:"uniquePairs,omitempty"`
+	// PrimaryKey is the primary key declared in a database catalog.
+	PrimaryKey []string `json:"primaryKey,omitempty"`
+}
+
+type KeyIndex struct {
+	Package   string          `json:"package"`
+	Resources []KeyCandidates `json:"resources"`
+}
+
+// KeyTypes are the field types whose values can identify a row.
+var KeyTypes = map[string]bool{"integer": true, "string": true, "date": true, "datetime": true}
+
+// NewKeyColumn describes a profiled field as a key candidate; ok is false
+// for fields whose type is not in types, or that cannot be one.
+func NewKeyColumn(field Fields, sketch *profiling.KMVSketch, types map[string]bool) (KeyColumn, bool) {
+	if !types[field.Type] || field.Stats.PresentValueCounts == 0 || field.Sensitivity != nil {
+		return KeyColumn{}, false
+	}
+	column := KeyColumn{
+		Field:    field.Name,
+		Type:     field.Type,
+		Distinct: field.Stats.UniqueValueCounts,
+		Exact:    field.Stats.UniqueCountMethod == "exact",
+		Hashes:   sketch.Sorted(),
+	}
+	if field.Constraints != nil {
+		column.Unique = field.Constraints.Unique
+		column.Required = field.Constraints.Required
+	}
+	return column, true
+}
+
+// CompositeCandidates picks the columns worth pairing when no single
+// column is a key: required, repeated, and with the most distinct values.
+func CompositeCandidates(columns []KeyColumn) []KeyColumn {
+	var candidates []KeyColumn
+	for _, column := range columns {
+		if column.Unique && column.Required {
+			return nil
+		}
+		if column.Required && column.Distinct > 1 {
+			candidates = append(candidates, column)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Distinct > candidates[j].Distinct })
+	if len(candidates) > CompositeKeyColumns {
+		candidates = candidates[:CompositeKeyColumns]
+	}
+	return candidates
+}
+
+// WriteKeyIndex writes keys.json next to the data package.
+func WriteKeyIndex(dir string, index KeyIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "keys.json"), data, 0644)
+}
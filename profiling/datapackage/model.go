@@ -0,0 +1,232 @@
+// Package datapackage is the descriptor model the file plugins write: a
+// Data Package of Tabular Data Resources with Table Schema fields and their
+// profile stats, plus its validation and legacy output shape.
+package datapackage
+
+import (
+	"encoding/json"
+
+	"profiling"
+)
+
+type License struct {
+	Name  string `json:"name,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type Source struct {
+	Title string `json:"title"`
+	Path  string `json:"path,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type Contributor struct {
+	Title        string `json:"title"`
+	Path         string `json:"path,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Role         string `json:"role,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// Stats are float valued since statsVersion 2; nullProportion is the share
+// of rows that are null and uniqueProportion the share of present values
+// that are distinct, both as a 0-1 fraction.
+type Stats struct {
+	Min                float64                   `json:"min"`
+	Max                float64                   `json:"max"`
+	Mean               float64                   `json:"mean"`
+	Std                float64                   `json:"std"`
+	NullValueCounts    int                       `json:"nullValueCounts"`
+	PresentValueCounts int                       `json:"present_value_counts"`
+	UniqueValueCounts  int                       `json:"uniqueValueCounts"`
+	Sample_value       []string                  `json:"sample_value"`
+	NullProportion     float64                   `json:"nullProportion"`
+	UniqueProportion   float64                   `json:"uniqueProportion"`
+	UniqueCountMethod  string                    `json:"uniqueCountMethod"`
+	UniqueCountError   float64                   `json:"uniqueCountError"`
+	Distribution       *profiling.Distribution   `json:"distribution,omitempty"`
+	TopValues          []profiling.FrequentValue `json:"topValues,omitempty"`
+	Categorical        bool                      `json:"categorical,omitempty"`
+	MinDate            string                    `json:"minDate,omitempty"`
+	MaxDate            string                    `json:"maxDate,omitempty"`
+	Length             *LengthStats              `json:"length,omitempty"`
+	// Estimated names the stats a database plugin estimated from its
+	// planner statistics or a sample rather than computed over every row.
+	Estimated []string      `json:"estimated,omitempty"`
+	Boolean   *BooleanStats `json:"boolean,omitempty"`
+	Elements  *ElementStats `json:"elements,omitempty"`
+}
+
+type Constraints struct {
+	Required  bool          `json:"required,omitempty"`
+	Unique    bool          `json:"unique,omitempty"`
+	MinLength *int          `json:"minLength,omitempty"`
+	MaxLength *int          `json:"maxLength,omitempty"`
+	Minimum   interface{}   `json:"minimum,omitempty"`
+	Maximum   interface{}   `json:"maximum,omitempty"`
+	Pattern   string        `json:"pattern,omitempty"`
+	Enum      []interface{} `json:"enum,omitempty"`
+	// Confidence is "exact" for constraints inferred from every value,
+	// "estimated" when one rests on an approximate count or a sample.
+	Confidence string `json:"confidence,omitempty"`
+	// Declared names the constraints read from a database catalog rather
+	// than inferred; Checks are the CHECK constraints with no equivalent
+	// above.
+	Declared []string `json:"declared,omitempty"`
+	Checks   []string `json:"checks,omitempty"`
+}
+
+type Fields struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+	// SemanticType refines Type with what the values represent, such as
+	// email or latitude; SemanticConfidence is the share of values matching.
+	SemanticType       string  `json:"semanticType,omitempty"`
+	SemanticConfidence float64 `json:"semanticConfidence,omitempty"`
+	Description        string  `json:"description,omitempty"`
+	// Default is the column default declared in a database, an SQL
+	// expression.
+	Default     string       `json:"default,omitempty"`
+	TrueValues  []string     `json:"trueValues,omitempty"`
+	FalseValues []string     `json:"falseValues,omitempty"`
+	Constraints *Constraints `json:"constraints,omitempty"`
+	Sensitivity *Sensitivity `json:"sensitivity,omitempty"`
+	Stats       Stats        `json:"stats"`
+}
+
+type Schema struct {
+	Fields []Fields `json:"fields"`
+	// MissingValues are the cell values read as null; the spec default
+	// of [""] applies when a schema leaves them out.
+	MissingValues []string `json:"missingValues"`
+	// PrimaryKey and ForeignKeys are left to the API, which links the
+	// keys of every package profiled together.
+	PrimaryKey  interface{}  `json:"primaryKey,omitempty"`
+	ForeignKeys []ForeignKey `json:"foreignKeys,omitempty"`
+}
+
+// Dialect follows the CSV Dialect spec; booleans are real JSON booleans.
+// JSON resources leave it out. Database resources name their table
+// instead, and are written with only Schema and Table.
+type Dialect struct {
+	Delimiter           string `json:"delimiter"`
+	LineTerminator      string `json:"lineTerminator"`
+	QuoteChar           string `json:"quoteChar,omitempty"`
+	DoubleQuote         bool   `json:"doubleQuote"`
+	EscapeChar          string `json:"escapeChar,omitempty"`
+	SkipInitialSpace    bool   `json:"skipInitialSpace"`
+	Header              bool   `json:"header"`
+	CaseSensitiveHeader bool   `json:"caseSensitiveHeader"`
+	// SkipLines is not part of the spec: the number of preamble records
+	// before the header (or the first data row when there is no header).
+	SkipLines int `json:"skipLines,omitempty"`
+
+	Schema string `json:"schema,omitempty"`
+	Table  string `json:"table,omitempty"`
+}
+
+func (d Dialect) MarshalJSON() ([]byte, error) {
+	if d.Table != "" {
+		return json.Marshal(struct {
+			Schema string `json:"schema,omitempty"`
+			Table  string `json:"table"`
+		}{d.Schema, d.Table})
+	}
+	type csvDialect Dialect
+	return json.Marshal(csvDialect(d))
+}
+
+type Resource struct {
+	Profile     string `json:"profile"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Mediatype   string `json:"mediatype,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Bytes       int64  `json:"bytes,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+
+	InvalidByteCount int                         `json:"invalidByteCount,omitempty"`
+	InvalidSequences []profiling.InvalidSequence `json:"invalidSequences,omitempty"`
+	Schema           Schema                      `json:"schema"`
+	Dialect          *Dialect                    `json:"dialect,omitempty"`
+	RowsCount        int                         `json:"rowsCount"`
+	ColumnsCount     int                         `json:"columnsCount"`
+	Estimated        []string                    `json:"estimated,omitempty"`
+}
+
+type Resources []Resource
+
+// Package is a Data Package descriptor.
+type Package struct {
+	Profile      string        `json:"profile"`
+	Name         string        `json:"name"`
+	Title        string        `json:"title,omitempty"`
+	Description  string        `json:"description,omitempty"`
+	Version      string        `json:"version,omitempty"`
+	Licenses     []License     `json:"licenses,omitempty"`
+	Sources      []Source      `json:"sources,omitempty"`
+	Contributors []Contributor `json:"contributors,omitempty"`
+	StatsVersion int           `json:"statsVersion,omitempty"`
+	Resources    Resources     `json:"resources"`
+
+	Sensitivity *SensitivityReport `json:"sensitivity,omitempty"`
+}
+
+type BooleanStats struct {
+	TrueCount       int     `json:"trueCount"`
+	FalseCount      int     `json:"falseCount"`
+	TrueProportion  float64 `json:"trueProportion"`
+	FalseProportion float64 `json:"falseProportion"`
+}
+
+type LengthStats struct {
+	MinLength     int     `json:"minLength"`
+	MaxLength     int     `json:"maxLength"`
+	AverageLength float64 `json:"averageLength"`
+}
+
+type ElementStats struct {
+	DistinctElements int                       `json:"distinctElements"`
+	AverageLength    float64                   `json:"averageLength"`
+	MinLength        int                       `json:"minLength"`
+	MaxLength        int                       `json:"maxLength"`
+	TopElements      []profiling.FrequentValue `json:"topElements,omitempty"`
+}
+
+type Sensitivity struct {
+	Category string `json:"category"`
+	Kind     string `json:"kind"`
+	Reason   string `json:"reason"`
+	Policy   string `json:"policy"`
+}
+
+type SensitiveField struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Sensitivity
+}
+
+// SensitivityReport lists the sensitive fields of the whole package.
+type SensitivityReport struct {
+	Policy      string           `json:"policy"`
+	PIICount    int              `json:"piiCount"`
+	SecretCount int              `json:"secretCount"`
+	Sensitive   []SensitiveField `json:"fields"`
+}
+
+type ForeignKeyReference struct {
+	Package  string      `json:"package,omitempty"`
+	Resource string      `json:"resource"`
+	Fields   interface{} `json:"fields"`
+}
+
+type ForeignKey struct {
+	Fields    interface{}         `json:"fields"`
+	Reference ForeignKeyReference `json:"reference"`
+}
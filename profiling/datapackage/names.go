@@ -0,0 +1,28 @@
+package datapackage
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Name lower-cases s and replaces every character not allowed in package
+// and resource names by the data package spec with a dash.
+func Name(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '-'
+	}, strings.ToLower(s))
+	return strings.Trim(name, "-.")
+}
+
+// ResourceName names a resource after its file, without the extension.
+func ResourceName(path string) string {
+	name := Name(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if name == "" {
+		return "resource"
+	}
+	return name
+}
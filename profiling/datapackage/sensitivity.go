@@ -0,0 +1,164 @@
+package datapackage
+
+import (
+	"regexp"
+	"strings"
+
+	"profiling"
+)
+
+// Sensitive data detection. Fields are flagged as PII (person names,
+// emails, phone numbers, card numbers) or secrets (passwords, API keys)
+// from their name, their semantic type or the shape of their values. The
+// sensitive policy then decides what happens to the values the profile
+// would otherwise publish: "mask" (the default) masks sample and top
+// values, "omit" drops them and "none" only flags the field. Enum, range,
+// length and pattern constraints and the numeric and length stats are
+// dropped unless the policy is "none", since they reveal the values too.
+
+var DefaultSensitivePolicy = "mask"
+
+var SensitiveMask = "********"
+
+var sensitiveNames = []struct {
+	category string
+	kind     string
+	pattern  *regexp.Regexp
+}{
+	{"secret", "password", regexp.MustCompile(`(?i)(password|passwd|^pwd$|_pwd$|passphrase)`)},
+	{"secret", "api_key", regexp.MustCompile(`(?i)(secret|token|api_?key|access_?key|private_?key|credential|client_?secret)`)},
+	{"pii", "card_number", regexp.MustCompile(`(?i)(card_?num|credit_?card|cc_?num|^pan$)`)},
+	{"pii", "email", regexp.MustCompile(`(?i)e_?mail`)},
+	{"pii", "phone", regexp.MustCompile(`(?i)(phone|mobile|^tel$|telephone|^fax$)`)},
+	// A bare "name" column is as often a product or a book title as a
+	// person, so only headers that say whose name it is count.
+	{"pii", "name", regexp.MustCompile(`(?i)(full_?name|first_?name|last_?name|middle_?name|surname|given_?name|family_?name|^(customer|person|contact|employee|patient|student)_?name$)`)},
+}
+
+// ClassifySensitivity flags a field from its name first, then from its
+// semantic type and the values seen; nil means nothing sensitive was found.
+func ClassifySensitivity(name, semanticType string, values *profiling.SensitiveDetector, policy string) *Sensitivity {
+	for _, n := range sensitiveNames {
+		if n.pattern.MatchString(name) {
+			return &Sensitivity{Category: n.category, Kind: n.kind, Reason: "name", Policy: policy}
+		}
+	}
+	switch semanticType {
+	case "email", "phone":
+		return &Sensitivity{Category: "pii", Kind: semanticType, Reason: "values", Policy: policy}
+	}
+	if values == nil {
+		return nil
+	}
+	if values.CardShare() >= profiling.SemanticMinConfidence {
+		return &Sensitivity{Category: "pii", Kind: "card_number", Reason: "values", Policy: policy}
+	}
+	if semanticType != "uuid" && semanticType != "url" && values.TokenShare() >= profiling.SemanticMinConfidence {
+		return &Sensitivity{Category: "secret", Kind: "api_key", Reason: "values", Policy: policy}
+	}
+	return nil
+}
+
+// maskValue hides a value while keeping enough of its shape to recognise
+// it: secrets are replaced outright, emails keep their first letter and
+// domain, card numbers their last four digits and other values their last
+// two letters or digits.
+func maskValue(s *Sensitivity, value string) string {
+	if s.Category == "secret" {
+		return SensitiveMask
+	}
+	if s.Kind == "email" {
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			return string([]rune(value)[:1]) + "***" + value[at:]
+		}
+	}
+	keep := 2
+	if s.Kind == "card_number" {
+		keep = 4
+	}
+	runes := []rune(value)
+	if len(runes) <= 4 {
+		return SensitiveMask
+	}
+	kept := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		ch := runes[i]
+		if !(ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch > 127) {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+func maskValues(s *Sensitivity, values []string) []string {
+	masked := make([]string, len(values))
+	for i, v := range values {
+		masked[i] = maskValue(s, v)
+	}
+	return masked
+}
+
+func maskFrequentValues(s *Sensitivity, values []profiling.FrequentValue, policy string) []profiling.FrequentValue {
+	if policy == "omit" {
+		return nil
+	}
+	masked := make([]profiling.FrequentValue, len(values))
+	for i, v := range values {
+		masked[i] = v
+		masked[i].Value = maskValue(s, v.Value)
+	}
+	return masked
+}
+
+// RedactField applies the policy to a field flagged as sensitive.
+func RedactField(field *Fields, policy string) {
+	s := field.Sensitivity
+	if s == nil || policy == "none" {
+		return
+	}
+	stats := &field.Stats
+	if policy == "omit" {
+		stats.Sample_value = []string{}
+	} else {
+		stats.Sample_value = maskValues(s, stats.Sample_value)
+	}
+	stats.TopValues = maskFrequentValues(s, stats.TopValues, policy)
+	if stats.Elements != nil {
+		stats.Elements.TopElements = maskFrequentValues(s, stats.Elements.TopElements, policy)
+	}
+	stats.Min, stats.Max, stats.Mean, stats.Std = 0, 0, 0, 0
+	stats.Distribution = nil
+	stats.MinDate, stats.MaxDate = "", ""
+	stats.Length = nil
+	stats.Categorical = false
+	if field.Constraints != nil {
+		field.Constraints.Enum = nil
+		field.Constraints.Minimum, field.Constraints.Maximum = nil, nil
+		field.Constraints.MinLength, field.Constraints.MaxLength = nil, nil
+		field.Constraints.Pattern = ""
+	}
+}
+
+// NewSensitivityReport collects the flagged fields of every resource.
+func NewSensitivityReport(pkg *Package, policy string) *SensitivityReport {
+	report := &SensitivityReport{Policy: policy, Sensitive: []SensitiveField{}}
+	for _, resource := range pkg.Resources {
+		for _, field := range resource.Schema.Fields {
+			if field.Sensitivity == nil {
+				continue
+			}
+			report.Sensitive = append(report.Sensitive, SensitiveField{Resource: resource.Name, Field: field.Name, Sensitivity: *field.Sensitivity})
+			if field.Sensitivity.Category == "secret" {
+				report.SecretCount++
+			} else {
+				report.PIICount++
+			}
+		}
+	}
+	return report
+}
@@ -0,0 +1,588 @@
+package datapackage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"profiling"
+)
+
+// Validation of data against a Table Schema. The plugins read their files
+// and hand each value to the FieldChecker of its field, which casts it to
+// the field type and applies the field constraints.
+
+// ValidationRequest asks for a data file to be checked against a Table
+// Schema. The schema comes from Schema (inline JSON), SchemaPath (a Table
+// Schema, resource or data package descriptor) or, when both are empty, the
+// data package previously written to the catalog.
+type ValidationRequest struct {
+	DataPath     string `json:"dataPath"`
+	Schema       string `json:"schema"`
+	SchemaPath   string `json:"schemaPath"`
+	ResourceName string `json:"resourceName"`
+	MaxErrors    int    `json:"maxErrors"`
+}
+
+type ValidationError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Type    string `json:"type"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+type ValidationReport struct {
+	Path        string            `json:"path"`
+	Valid       bool              `json:"valid"`
+	RowsChecked int               `json:"rowsChecked"`
+	ErrorCount  int               `json:"errorCount"`
+	ErrorCounts map[string]int    `json:"errorCounts"`
+	FieldErrors map[string]int    `json:"fieldErrors"`
+	Errors      []ValidationError `json:"errors"`
+}
+
+var DefaultMaxErrors = 100
+
+var (
+	defaultTrueValues  = []string{"true", "True", "TRUE", "1"}
+	defaultFalseValues = []string{"false", "False", "FALSE", "0"}
+)
+
+func NewValidationReport(path string) *ValidationReport {
+	return &ValidationReport{
+		Path:        path,
+		Valid:       true,
+		ErrorCounts: map[string]int{},
+		FieldErrors: map[string]int{},
+		Errors:      []ValidationError{},
+	}
+}
+
+// Add counts every error but keeps only the first maxErrors as examples.
+func (r *ValidationReport) Add(e ValidationError, maxErrors int) {
+	r.Valid = false
+	r.ErrorCount++
+	r.ErrorCounts[e.Type]++
+	if e.Field != "" {
+		r.FieldErrors[e.Field]++
+	}
+	if len(r.Errors) < maxErrors {
+		r.Errors = append(r.Errors, e)
+	}
+}
+
+// LoadSchema resolves the Table Schema for the request, together with the
+// dialect when it comes from a resource descriptor. Without a schema in the
+// request, the data package in catalogDir is read.
+func LoadSchema(req ValidationRequest, catalogDir string) (Schema, *Dialect, error) {
+	text := []byte(req.Schema)
+	if req.Schema == "" {
+		schemaPath := req.SchemaPath
+		if schemaPath == "" {
+			schemaPath = filepath.Join(catalogDir, "datapackage.json")
+		}
+		var err error
+		text, err = ioutil.ReadFile(schemaPath)
+		if err != nil {
+			return Schema{}, nil, err
+		}
+	}
+
+	var descriptor struct {
+		Fields        []Fields  `json:"fields"`
+		MissingValues []string  `json:"missingValues"`
+		Schema        *Schema   `json:"schema"`
+		Dialect       *Dialect  `json:"dialect"`
+		Resources     Resources `json:"resources"`
+	}
+	// Constraint values are kept as json.Number, so integer bounds and enum
+	// values beyond float64 precision are read exactly.
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+	err := decoder.Decode(&descriptor)
+	if err != nil {
+		return Schema{}, nil, fmt.Errorf("invalid schema descriptor: %v", err)
+	}
+
+	switch {
+	case descriptor.Fields != nil:
+		return Schema{Fields: descriptor.Fields, MissingValues: descriptor.MissingValues}, nil, nil
+	case descriptor.Schema != nil:
+		return *descriptor.Schema, descriptor.Dialect, nil
+	case descriptor.Resources != nil:
+		name := req.ResourceName
+		if name == "" {
+			name = ResourceName(req.DataPath)
+		}
+		for _, resource := range descriptor.Resources {
+			if resource.Name == name || resource.Path == req.DataPath {
+				return resource.Schema, resource.Dialect, nil
+			}
+		}
+		return Schema{}, nil, fmt.Errorf("resource %q not found in data package", name)
+	}
+	return Schema{}, nil, fmt.Errorf("descriptor has no table schema")
+}
+
+// MissingValueSet is the set of string values a schema reads as null, [""]
+// unless it declares its own; JSON null is always null.
+func MissingValueSet(values []string) map[string]bool {
+	if values == nil {
+		values = []string{""}
+	}
+	missing := map[string]bool{}
+	for _, v := range values {
+		missing[v] = true
+	}
+	return missing
+}
+
+// FieldChecker casts cell values to the field type and applies the field
+// constraints, remembering seen values for the unique constraint.
+type FieldChecker struct {
+	field   Fields
+	pattern *regexp.Regexp
+	enum    map[string]bool
+	seen    map[string]int
+	minimum interface{}
+	maximum interface{}
+	// missing are the values read as null.
+	missing map[string]bool
+}
+
+func NewFieldChecker(field Fields, missing map[string]bool) *FieldChecker {
+	c := &FieldChecker{field: field, missing: missing}
+	constraints := field.Constraints
+	if constraints == nil {
+		return c
+	}
+	if constraints.Pattern != "" {
+		c.pattern, _ = regexp.Compile("^(?:" + constraints.Pattern + ")$")
+	}
+	if constraints.Enum != nil {
+		c.enum = map[string]bool{}
+		for _, v := range constraints.Enum {
+			if cast, err := castConstraint(field, v); err == nil {
+				c.enum[valueKey(cast)] = true
+			}
+		}
+	}
+	if constraints.Unique {
+		c.seen = map[string]int{}
+	}
+	if constraints.Minimum != nil {
+		c.minimum, _ = castConstraint(field, constraints.Minimum)
+	}
+	if constraints.Maximum != nil {
+		c.maximum, _ = castConstraint(field, constraints.Maximum)
+	}
+	return c
+}
+
+// Check checks a CSV cell.
+func (c *FieldChecker) Check(row int, raw string) []ValidationError {
+	name := c.field.Name
+	constraints := c.field.Constraints
+	if c.missing[raw] {
+		if constraints != nil && constraints.Required {
+			return []ValidationError{{Row: row, Field: name, Type: "required",
+				Message: "value is required"}}
+		}
+		return nil
+	}
+
+	value, err := castValue(c.field, raw)
+	if err != nil {
+		return []ValidationError{{Row: row, Field: name, Type: "type", Value: raw,
+			Message: fmt.Sprintf("cannot cast to %s: %v", c.field.Type, err)}}
+	}
+	return c.checkConstraints(row, raw, value)
+}
+
+// CheckJSON checks a decoded JSON value.
+func (c *FieldChecker) CheckJSON(row int, v interface{}) []ValidationError {
+	name := c.field.Name
+	constraints := c.field.Constraints
+	if s, ok := v.(string); v == nil || ok && c.missing[s] {
+		if constraints != nil && constraints.Required {
+			return []ValidationError{{Row: row, Field: name, Type: "required",
+				Message: "value is required"}}
+		}
+		return nil
+	}
+
+	raw, ok := v.(string)
+	if !ok {
+		b, _ := json.Marshal(v)
+		raw = string(b)
+	}
+	value, err := castJSONValue(c.field, v)
+	if err != nil {
+		return []ValidationError{{Row: row, Field: name, Type: "type", Value: raw,
+			Message: fmt.Sprintf("cannot cast to %s: %v", c.field.Type, err)}}
+	}
+	return c.checkConstraints(row, raw, value)
+}
+
+// castJSONValue checks a decoded JSON value against the field type. Strings
+// are parsed for the types JSON has no literal for, such as dates. Numbers
+// may be float64 or, when the data was decoded with UseNumber, json.Number.
+func castJSONValue(field Fields, v interface{}) (interface{}, error) {
+	switch field.Type {
+	case "integer", "year":
+		switch n := v.(type) {
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+			if f, err := n.Float64(); err == nil && f == math.Trunc(f) {
+				return int64(f), nil
+			}
+		case float64:
+			if n == math.Trunc(n) {
+				return int64(n), nil
+			}
+		}
+		return nil, fmt.Errorf("not an integer")
+	case "number":
+		switch n := v.(type) {
+		case json.Number:
+			return n.Float64()
+		case float64:
+			return n, nil
+		}
+		return nil, fmt.Errorf("not a number")
+	case "boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("not a boolean")
+	case "array":
+		if a, ok := v.([]interface{}); ok {
+			return a, nil
+		}
+		return nil, fmt.Errorf("not an array")
+	case "object", "geojson":
+		if m, ok := v.(map[string]interface{}); ok {
+			return m, nil
+		}
+		return nil, fmt.Errorf("not an object")
+	case "any":
+		return v, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("not a string")
+	}
+	return castValue(field, s)
+}
+
+func (c *FieldChecker) checkConstraints(row int, raw string, value interface{}) []ValidationError {
+	constraints := c.field.Constraints
+	if constraints == nil {
+		return nil
+	}
+	name := c.field.Name
+	var errs []ValidationError
+	fail := func(kind, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Row: row, Field: name, Type: kind, Value: raw,
+			Message: fmt.Sprintf(format, args...)})
+	}
+
+	key := valueKey(value)
+	if c.seen != nil {
+		if first, ok := c.seen[key]; ok {
+			fail("unique", "value already seen in row %d", first)
+		} else {
+			c.seen[key] = row
+		}
+	}
+	if c.enum != nil && !c.enum[key] {
+		fail("enum", "value is not one of the allowed values")
+	}
+	if c.pattern != nil && !c.pattern.MatchString(raw) {
+		fail("pattern", "value does not match %q", constraints.Pattern)
+	}
+	if length, ok := valueLength(value); ok {
+		if constraints.MinLength != nil && length < *constraints.MinLength {
+			fail("minLength", "length %d is below %d", length, *constraints.MinLength)
+		}
+		if constraints.MaxLength != nil && length > *constraints.MaxLength {
+			fail("maxLength", "length %d is above %d", length, *constraints.MaxLength)
+		}
+	}
+	if c.minimum != nil {
+		if cmp, ok := compareValues(value, c.minimum); ok && cmp < 0 {
+			fail("minimum", "value is below %v", constraints.Minimum)
+		}
+	}
+	if c.maximum != nil {
+		if cmp, ok := compareValues(value, c.maximum); ok && cmp > 0 {
+			fail("maximum", "value is above %v", constraints.Maximum)
+		}
+	}
+	return errs
+}
+
+// castValue converts a cell to the Go value of the field type.
+func castValue(field Fields, raw string) (interface{}, error) {
+	switch field.Type {
+	case "string", "":
+		return raw, checkStringFormat(field.Format, raw)
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	case "number":
+		return strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	case "boolean":
+		trueValues, falseValues := field.TrueValues, field.FalseValues
+		if trueValues == nil {
+			trueValues = defaultTrueValues
+		}
+		if falseValues == nil {
+			falseValues = defaultFalseValues
+		}
+		for _, v := range trueValues {
+			if raw == v {
+				return true, nil
+			}
+		}
+		for _, v := range falseValues {
+			if raw == v {
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("not a boolean literal")
+	case "date", "time", "datetime":
+		return parseTemporal(field.Type, field.Format, raw)
+	case "year":
+		year, err := strconv.Atoi(raw)
+		if err == nil && (year < 0 || year > 9999) {
+			err = fmt.Errorf("year out of range")
+		}
+		return int64(year), err
+	case "yearmonth":
+		return time.Parse("2006-01", raw)
+	case "duration":
+		if !profiling.IsDuration(raw) {
+			return nil, fmt.Errorf("not an ISO 8601 duration")
+		}
+		return raw, nil
+	case "array":
+		if v, ok := profiling.ParseCollection(raw); ok {
+			if array, ok := v.([]interface{}); ok {
+				return array, nil
+			}
+		}
+		return nil, fmt.Errorf("not an array")
+	case "object":
+		if v, ok := profiling.ParseCollection(raw); ok {
+			if object, ok := v.(map[string]interface{}); ok {
+				return object, nil
+			}
+		}
+		return nil, fmt.Errorf("not an object")
+	case "geojson":
+		var v map[string]interface{}
+		return v, json.Unmarshal([]byte(raw), &v)
+	}
+	return raw, nil
+}
+
+// castConstraint converts a constraint value from the descriptor to the Go
+// value of the field type so it compares with cast cells.
+func castConstraint(field Fields, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return castValue(field, v)
+	case json.Number:
+		return castValue(field, v.String())
+	case float64:
+		if field.Type == "integer" || field.Type == "year" {
+			return int64(v), nil
+		}
+		return v, nil
+	}
+	return v, nil
+}
+
+func checkStringFormat(format, raw string) error {
+	switch format {
+	case "email":
+		if !profiling.IsEmail(raw) {
+			return fmt.Errorf("not an email address")
+		}
+	case "uri":
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" {
+			return fmt.Errorf("not a uri")
+		}
+	case "uuid":
+		if !profiling.IsUUID(raw) {
+			return fmt.Errorf("not a uuid")
+		}
+	case "binary":
+		_, err := base64.StdEncoding.DecodeString(raw)
+		return err
+	}
+	return nil
+}
+
+var temporalLayouts = map[string][]string{
+	"date":     {"2006-01-02", "02/01/2006", "01/02/2006", "2006/01/02", "02-01-2006", "02.01.2006", "Jan 2, 2006", "2 Jan 2006"},
+	"time":     {"15:04:05", "15:04", "15:04:05.999999999", "3:04 PM", "3:04:05 PM"},
+	"datetime": {time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04:05Z07:00", "02/01/2006 15:04:05", time.RFC1123, time.RFC1123Z},
+}
+
+// parseTemporal parses date, time and datetime values. The default format is
+// the ISO one, "any" tries the common layouts, "%s" and "%Q" are Unix
+// timestamps in seconds and milliseconds, and a strptime pattern such as
+// "%d/%m/%Y" is translated to a Go layout.
+func parseTemporal(kind, format, raw string) (time.Time, error) {
+	switch {
+	case format == "" || format == "default":
+		layout := map[string]string{"date": "2006-01-02", "time": "15:04:05", "datetime": time.RFC3339}[kind]
+		t, err := time.Parse(layout, raw)
+		if err != nil && kind == "datetime" {
+			t, err = time.Parse("2006-01-02T15:04:05", raw)
+		}
+		return t, err
+	case format == "%s" || format == "%Q":
+		// Unix timestamps in seconds or milliseconds.
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if format == "%Q" {
+			return time.Unix(0, n*int64(time.Millisecond)).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	case format == "any":
+		for _, layout := range temporalLayouts[kind] {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("no known %s layout matches", kind)
+	}
+	return time.Parse(strptimeLayout(format), raw)
+}
+
+var strptimeDirectives = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03",
+	'M': "04", 'S': "05", 'p': "PM", 'b': "Jan", 'B': "January", 'a': "Mon",
+	'A': "Monday", 'z': "-0700", 'Z': "MST", 'f': "000000", 'j': "002", '%': "%",
+}
+
+// strptimeLayout translates a strptime pattern into a Go time layout.
+func strptimeLayout(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] == '%' && i+1 < len(format) {
+			if layout, ok := strptimeDirectives[format[i+1]]; ok {
+				b.WriteString(layout)
+				i++
+				continue
+			}
+		}
+		b.WriteByte(format[i])
+	}
+	return b.String()
+}
+
+// valueKey gives equal cast values the same key for unique and enum checks.
+func valueKey(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case string:
+		return v
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func valueLength(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case string:
+		return len([]rune(v)), true
+	case []interface{}:
+		return len(v), true
+	case map[string]interface{}:
+		return len(v), true
+	}
+	return 0, false
+}
+
+// compareValues orders two cast values of the same kind.
+func compareValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+		return compareFloats(float64(a), toFloat(b))
+	case float64:
+		return compareFloats(a, toFloat(b))
+	case time.Time:
+		bt, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a.Before(bt):
+			return -1, true
+		case a.After(bt):
+			return 1, true
+		}
+		return 0, true
+	case string:
+		bs, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, bs), true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+func compareFloats(a, b float64) (int, bool) {
+	switch {
+	case math.IsNaN(b):
+		return 0, false
+	case a < b:
+		return -1, true
+	case a > b:
+		return 1, true
+	}
+	return 0, true
+}
@@ -0,0 +1,214 @@
+package datapackage
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func intPtr(n int) *int { return &n }
+
+// errorTypes checks each value in turn and returns the type of every error
+// reported, "" for a value that passes.
+func errorTypes(checker *FieldChecker, values []string) []string {
+	var types []string
+	for i, v := range values {
+		errs := checker.Check(i+2, v)
+		if len(errs) == 0 {
+			types = append(types, "")
+		}
+		for _, e := range errs {
+			types = append(types, e.Type)
+		}
+	}
+	return types
+}
+
+func TestFieldChecker(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  Fields
+		values []string
+		want   []string
+	}{
+		{
+			name:   "required",
+			field:  Fields{Name: "f", Type: "string", Constraints: &Constraints{Required: true}},
+			values: []string{"a", ""},
+			want:   []string{"", "required"},
+		},
+		{
+			name:   "type",
+			field:  Fields{Name: "f", Type: "integer"},
+			values: []string{"1", "1.5", "x", ""},
+			want:   []string{"", "type", "type", ""},
+		},
+		{
+			name:   "unique",
+			field:  Fields{Name: "f", Type: "integer", Constraints: &Constraints{Unique: true}},
+			values: []string{"1", "2", "1"},
+			want:   []string{"", "", "unique"},
+		},
+		{
+			// Integers beyond float64 precision are still distinct.
+			name:   "unique large integers",
+			field:  Fields{Name: "f", Type: "integer", Constraints: &Constraints{Unique: true}},
+			values: []string{"9007199254740992", "9007199254740993", "9007199254740992"},
+			want:   []string{"", "", "unique"},
+		},
+		{
+			name:   "enum",
+			field:  Fields{Name: "f", Type: "string", Constraints: &Constraints{Enum: []interface{}{"a", "b"}}},
+			values: []string{"a", "c"},
+			want:   []string{"", "enum"},
+		},
+		{
+			name:   "pattern",
+			field:  Fields{Name: "f", Type: "string", Constraints: &Constraints{Pattern: "[A-Z]{2}[0-9]+"}},
+			values: []string{"AB12", "ab12", "AB12x"},
+			want:   []string{"", "pattern", "pattern"},
+		},
+		{
+			name:   "length",
+			field:  Fields{Name: "f", Type: "string", Constraints: &Constraints{MinLength: intPtr(2), MaxLength: intPtr(3)}},
+			values: []string{"ab", "a", "abcd", "äöü"},
+			want:   []string{"", "minLength", "maxLength", ""},
+		},
+		{
+			name:   "range",
+			field:  Fields{Name: "f", Type: "number", Constraints: &Constraints{Minimum: 0.5, Maximum: 2.5}},
+			values: []string{"1", "0.1", "3"},
+			want:   []string{"", "minimum", "maximum"},
+		},
+		{
+			name:   "integer range",
+			field:  Fields{Name: "f", Type: "integer", Constraints: &Constraints{Minimum: json.Number("9007199254740992"), Maximum: json.Number("9007199254740993")}},
+			values: []string{"9007199254740993", "9007199254740994", "9007199254740991"},
+			want:   []string{"", "maximum", "minimum"},
+		},
+		{
+			name:   "date range",
+			field:  Fields{Name: "f", Type: "date", Format: "%d/%m/%Y", Constraints: &Constraints{Minimum: "01/01/2020"}},
+			values: []string{"02/01/2020", "31/12/2019", "2020-01-02"},
+			want:   []string{"", "minimum", "type"},
+		},
+		{
+			name:   "boolean values",
+			field:  Fields{Name: "f", Type: "boolean", TrueValues: []string{"yes"}, FalseValues: []string{"no"}},
+			values: []string{"yes", "no", "true"},
+			want:   []string{"", "", "type"},
+		},
+		{
+			name:   "string format",
+			field:  Fields{Name: "f", Type: "string", Format: "email"},
+			values: []string{"a@example.com", "a.example.com"},
+			want:   []string{"", "type"},
+		},
+		{
+			name:   "array",
+			field:  Fields{Name: "f", Type: "array", Constraints: &Constraints{MaxLength: intPtr(2)}},
+			values: []string{"[1, 2]", "['a', 'b', 'c']", "a,b"},
+			want:   []string{"", "maxLength", "type"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := NewFieldChecker(test.field, MissingValueSet(nil))
+			if got := errorTypes(checker, test.values); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("errors = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFieldCheckerMissingValues(t *testing.T) {
+	field := Fields{Name: "f", Type: "integer", Constraints: &Constraints{Required: true}}
+	checker := NewFieldChecker(field, MissingValueSet([]string{"NA", "-"}))
+	got := errorTypes(checker, []string{"NA", "-", "", "1"})
+	// "" is not a missing value once the schema lists its own.
+	want := []string{"required", "required", "type", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	var record map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(`{"big": 9007199254740993, "float": 1.5, "whole": 2.0, "text": "x", "list": [1]}`))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field Fields
+		value interface{}
+		want  string
+	}{
+		{Fields{Name: "big", Type: "integer", Constraints: &Constraints{Maximum: json.Number("9007199254740992")}}, record["big"], "maximum"},
+		{Fields{Name: "float", Type: "integer"}, record["float"], "type"},
+		{Fields{Name: "whole", Type: "integer"}, record["whole"], ""},
+		{Fields{Name: "float", Type: "number", Constraints: &Constraints{Minimum: 2.0}}, record["float"], "minimum"},
+		{Fields{Name: "text", Type: "number"}, record["text"], "type"},
+		{Fields{Name: "list", Type: "array"}, record["list"], ""},
+		{Fields{Name: "list", Type: "object"}, record["list"], "type"},
+		{Fields{Name: "none", Type: "string", Constraints: &Constraints{Required: true}}, record["none"], "required"},
+	}
+	for _, test := range tests {
+		checker := NewFieldChecker(test.field, MissingValueSet(nil))
+		got := ""
+		if errs := checker.CheckJSON(1, test.value); len(errs) > 0 {
+			got = errs[0].Type
+		}
+		if got != test.want {
+			t.Errorf("%s as %s: error %q, want %q", test.field.Name, test.field.Type, got, test.want)
+		}
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	descriptor := `{"resources": [
+		{"name": "orders", "path": "data/orders.csv", "dialect": {"delimiter": ";"},
+		 "schema": {"fields": [{"name": "id", "type": "integer", "constraints": {"maximum": 9007199254740993}}]}},
+		{"name": "other", "path": "data/other.csv", "schema": {"fields": []}}
+	]}`
+	schema, dialect, err := LoadSchema(ValidationRequest{DataPath: "data/orders.csv", Schema: descriptor}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Fields) != 1 || schema.Fields[0].Name != "id" {
+		t.Fatalf("fields = %+v, want id", schema.Fields)
+	}
+	if dialect == nil || dialect.Delimiter != ";" {
+		t.Errorf("dialect = %+v, want delimiter ;", dialect)
+	}
+	if max := schema.Fields[0].Constraints.Maximum; max != json.Number("9007199254740993") {
+		t.Errorf("maximum = %#v, want the exact json.Number", max)
+	}
+
+	_, _, err = LoadSchema(ValidationRequest{DataPath: "data/missing.csv", Schema: descriptor}, "")
+	if err == nil {
+		t.Error("LoadSchema() found a resource for an unknown file")
+	}
+
+	schema, dialect, err = LoadSchema(ValidationRequest{Schema: `{"fields": [{"name": "a"}], "missingValues": ["NA"]}`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialect != nil || len(schema.Fields) != 1 || !reflect.DeepEqual(schema.MissingValues, []string{"NA"}) {
+		t.Errorf("inline schema = %+v, dialect %+v", schema, dialect)
+	}
+}
+
+func TestStrptimeLayout(t *testing.T) {
+	for format, want := range map[string]string{
+		"%d/%m/%Y":           "02/01/2006",
+		"%Y-%m-%dT%H:%M:%S":  "2006-01-02T15:04:05",
+		"%b %e, %Y %I:%M %p": "Jan _2, 2006 03:04 PM",
+		"100%%":              "100%",
+	} {
+		if got := strptimeLayout(format); got != want {
+			t.Errorf("strptimeLayout(%q) = %q, want %q", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package profiling holds the streaming statistics the profiler plugins
+// share: distinct counts, numeric distributions, frequent values, temporal
+// formats, encodings and content hashes.
+package profiling
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Distinct value counting. "exact" keeps a set of 64-bit value hashes,
+// "approximate" a HyperLogLog sketch of fixed size, and "auto" starts exact
+// and switches to the sketch once AutoExactLimit distinct values are seen.
+// The method and its relative standard error are reported with the count.
+
+var DefaultDistinctMode = "exact"
+
+var AutoExactLimit = 100000
+
+// HLLPrecision gives 2^14 registers: 16 KB per column and a relative
+// standard error of about 0.8%.
+var HLLPrecision uint8 = 14
+
+type DistinctCounter struct {
+	mode   string
+	exact  map[uint64]struct{}
+	sketch *HyperLogLog
+}
+
+func NewDistinctCounter(mode string) *DistinctCounter {
+	d := &DistinctCounter{mode: mode}
+	if mode == "approximate" {
+		d.sketch = NewHyperLogLog(HLLPrecision)
+	} else {
+		d.exact = map[uint64]struct{}{}
+	}
+	return d
+}
+
+func (d *DistinctCounter) Add(value string) {
+	h := HashValue(value)
+	if d.sketch != nil {
+		d.sketch.Add(h)
+		return
+	}
+	d.exact[h] = struct{}{}
+	if d.mode == "auto" && len(d.exact) > AutoExactLimit {
+		d.sketch = NewHyperLogLog(HLLPrecision)
+		for seen := range d.exact {
+			d.sketch.Add(seen)
+		}
+		d.exact = nil
+	}
+}
+
+func (d *DistinctCounter) Count() int {
+	if d.sketch != nil {
+		return d.sketch.Estimate()
+	}
+	return len(d.exact)
+}
+
+// Method names how the count was made and its relative standard error.
+func (d *DistinctCounter) Method() (string, float64) {
+	if d.sketch != nil {
+		return "hyperloglog", d.sketch.RelativeError()
+	}
+	return "exact", 0
+}
+
+// HashValue is FNV-1a followed by a 64-bit finalizer, so the high bits the
+// sketch relies on are well mixed even for short values.
+func HashValue(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	return &HyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+// Add uses the low bits of the hash as the register index and the position
+// of the first set bit in the rest as the observed rank.
+func (h *HyperLogLog) Add(hash uint64) {
+	index := hash & (1<<h.precision - 1)
+	rank := uint8(bits.LeadingZeros64(hash>>h.precision)) - h.precision + 1
+	h.Observe(int(index), rank)
+}
+
+func (h *HyperLogLog) Observe(index int, rank uint8) {
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *HyperLogLog) Estimate() int {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate while many registers are empty.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+func (h *HyperLogLog) RelativeError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
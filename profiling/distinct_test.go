@@ -0,0 +1,63 @@
+package profiling
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// TestHyperLogLogError checks the sketch stays within three standard errors
+// of the true count, in the linear counting range and well beyond it.
+func TestHyperLogLogError(t *testing.T) {
+	for _, n := range []int{1000, 50000, 500000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			h := NewHyperLogLog(HLLPrecision)
+			for i := 0; i < n; i++ {
+				h.Add(HashValue("value-" + strconv.Itoa(i)))
+				// Repeats must not change the estimate.
+				h.Add(HashValue("value-" + strconv.Itoa(i/2)))
+			}
+			bound := 3 * h.RelativeError()
+			if got := math.Abs(float64(h.Estimate())-float64(n)) / float64(n); got > bound {
+				t.Errorf("Estimate() = %d, relative error %.4f above %.4f", h.Estimate(), got, bound)
+			}
+		})
+	}
+}
+
+func TestDistinctCounterModes(t *testing.T) {
+	defer func(limit int) { AutoExactLimit = limit }(AutoExactLimit)
+	AutoExactLimit = 1000
+
+	tests := []struct {
+		mode   string
+		n      int
+		method string
+	}{
+		{"exact", 5000, "exact"},
+		{"approximate", 500, "hyperloglog"},
+		{"auto", 1000, "exact"},
+		{"auto", 5000, "hyperloglog"},
+	}
+	for _, test := range tests {
+		t.Run(test.mode+"/"+strconv.Itoa(test.n), func(t *testing.T) {
+			d := NewDistinctCounter(test.mode)
+			for i := 0; i < test.n; i++ {
+				d.Add(strconv.Itoa(i))
+			}
+			method, relativeError := d.Method()
+			if method != test.method {
+				t.Errorf("Method() = %s, want %s", method, test.method)
+			}
+			if method == "exact" {
+				if d.Count() != test.n || relativeError != 0 {
+					t.Errorf("Count() = %d with error %v, want %d exactly", d.Count(), relativeError, test.n)
+				}
+				return
+			}
+			if got := math.Abs(float64(d.Count())-float64(test.n)) / float64(test.n); got > 3*relativeError {
+				t.Errorf("Count() = %d, relative error %.4f above %.4f", d.Count(), got, 3*relativeError)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package profiling
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Distribution statistics for numeric fields. Values are streamed through
+// a NumericProfile: moments are updated in place and quantiles come from a
+// t-digest, so memory stays bounded however many rows a field has.
+
+var DefaultPercentiles = []float64{1, 5, 25, 75, 95, 99}
+
+var DefaultHistogramBins = 10
+
+var DigestCompression = 100.0
+
+type HistogramBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+type Histogram struct {
+	Type string         `json:"type"`
+	Bins []HistogramBin `json:"bins"`
+}
+
+// Distribution is the shape of a numeric field. Quantiles and histogram
+// counts are estimates; the moments and counts are exact.
+type Distribution struct {
+	Median        float64            `json:"median"`
+	Percentiles   map[string]float64 `json:"percentiles,omitempty"`
+	IQR           float64            `json:"iqr"`
+	Skewness      float64            `json:"skewness"`
+	Kurtosis      float64            `json:"kurtosis"`
+	ZeroCount     int                `json:"zeroCount"`
+	NegativeCount int                `json:"negativeCount"`
+	Histogram     *Histogram         `json:"histogram,omitempty"`
+}
+
+// NumericProfile accumulates a numeric field one value at a time.
+type NumericProfile struct {
+	count     int
+	zeros     int
+	negatives int
+	min, max  float64
+	mean      float64
+	m2, m3    float64
+	m4        float64
+	digest    *TDigest
+}
+
+func NewNumericProfile() *NumericProfile {
+	return &NumericProfile{digest: NewTDigest(DigestCompression)}
+}
+
+// Add updates the central moments incrementally (Terriberry's extension of
+// Welford's method) and feeds the digest.
+func (p *NumericProfile) Add(x float64) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return
+	}
+	if p.count == 0 || x < p.min {
+		p.min = x
+	}
+	if p.count == 0 || x > p.max {
+		p.max = x
+	}
+	switch {
+	case x == 0:
+		p.zeros++
+	case x < 0:
+		p.negatives++
+	}
+
+	n1 := float64(p.count)
+	p.count++
+	n := float64(p.count)
+	delta := x - p.mean
+	deltaN := delta / n
+	deltaN2 := deltaN * deltaN
+	term1 := delta * deltaN * n1
+	p.mean += deltaN
+	p.m4 += term1*deltaN2*(n*n-3*n+3) + 6*deltaN2*p.m2 - 4*deltaN*p.m3
+	p.m3 += term1*deltaN*(n-2) - 3*deltaN*p.m2
+	p.m2 += term1
+	p.digest.Add(x)
+}
+
+// Count is the number of finite values added.
+func (p *NumericProfile) Count() int {
+	return p.count
+}
+
+// Summary returns the summary statistics, all zero when no value was
+// added; std is the sample standard deviation.
+func (p *NumericProfile) Summary() (min, max, mean, std float64) {
+	if p.count > 1 {
+		std = math.Sqrt(p.m2 / float64(p.count-1))
+	}
+	return p.min, p.max, p.mean, std
+}
+
+// Distribution summarises the values seen. percentiles are in 0-100;
+// histogramType is "equal-width" or "adaptive" (equal frequency bins).
+func (p *NumericProfile) Distribution(percentiles []float64, bins int, histogramType string) *Distribution {
+	if p.count == 0 {
+		return nil
+	}
+	d := &Distribution{
+		Median:        p.Quantile(0.5),
+		IQR:           p.Quantile(0.75) - p.Quantile(0.25),
+		ZeroCount:     p.zeros,
+		NegativeCount: p.negatives,
+	}
+	if p.m2 > 0 {
+		n := float64(p.count)
+		d.Skewness = math.Sqrt(n) * p.m3 / math.Pow(p.m2, 1.5)
+		d.Kurtosis = n*p.m4/(p.m2*p.m2) - 3
+	}
+	for _, percentile := range percentiles {
+		if percentile < 0 || percentile > 100 {
+			continue
+		}
+		if d.Percentiles == nil {
+			d.Percentiles = map[string]float64{}
+		}
+		d.Percentiles["p"+strconv.FormatFloat(percentile, 'f', -1, 64)] = p.Quantile(percentile / 100)
+	}
+	if bins > 0 {
+		d.Histogram = p.histogram(bins, histogramType)
+	}
+	return d
+}
+
+func (p *NumericProfile) Quantile(q float64) float64 {
+	return p.digest.Quantile(q, p.min, p.max)
+}
+
+func (p *NumericProfile) histogram(bins int, histogramType string) *Histogram {
+	if p.min == p.max {
+		return &Histogram{Type: "equal-width", Bins: []HistogramBin{{Lower: p.min, Upper: p.max, Count: p.count}}}
+	}
+
+	edges := []float64{p.min}
+	if histogramType == "adaptive" {
+		for i := 1; i < bins; i++ {
+			edge := p.Quantile(float64(i) / float64(bins))
+			if edge > edges[len(edges)-1] && edge < p.max {
+				edges = append(edges, edge)
+			}
+		}
+	} else {
+		histogramType = "equal-width"
+		width := (p.max - p.min) / float64(bins)
+		for i := 1; i < bins; i++ {
+			edges = append(edges, p.min+float64(i)*width)
+		}
+	}
+	edges = append(edges, p.max)
+
+	// Counts come from the rounded cumulative counts at each edge, so they
+	// always add up to the number of values.
+	h := &Histogram{Type: histogramType}
+	n := float64(p.count)
+	below := 0
+	for i := 1; i < len(edges); i++ {
+		upTo := p.count
+		if i < len(edges)-1 {
+			upTo = int(math.Round(n * p.digest.CDF(edges[i], p.min, p.max)))
+		}
+		h.Bins = append(h.Bins, HistogramBin{Lower: edges[i-1], Upper: edges[i], Count: upTo - below})
+		below = upTo
+	}
+	return h
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest is a merging t-digest: values are buffered and periodically
+// merged into centroids that are small near the tails and larger around
+// the median, bounding memory by the compression.
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []float64
+	total       float64
+}
+
+func NewTDigest(compression float64) *TDigest {
+	return &TDigest{compression: compression}
+}
+
+func (t *TDigest) Add(x float64) {
+	t.buffer = append(t.buffer, x)
+	if len(t.buffer) >= int(t.compression)*5 {
+		t.compress()
+	}
+}
+
+func (t *TDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	points := make([]centroid, 0, len(t.centroids)+len(t.buffer))
+	points = append(points, t.centroids...)
+	for _, x := range t.buffer {
+		points = append(points, centroid{mean: x, weight: 1})
+	}
+	t.buffer = t.buffer[:0]
+	sort.Slice(points, func(i, j int) bool { return points[i].mean < points[j].mean })
+
+	total := 0.0
+	for _, point := range points {
+		total += point.weight
+	}
+	t.total = total
+
+	merged := []centroid{points[0]}
+	before := 0.0
+	for _, point := range points[1:] {
+		last := &merged[len(merged)-1]
+		weight := last.weight + point.weight
+		q := (before + weight/2) / total
+		if weight <= 4*total*q*(1-q)/t.compression {
+			last.mean += (point.mean - last.mean) * point.weight / weight
+			last.weight = weight
+			continue
+		}
+		before += last.weight
+		merged = append(merged, point)
+	}
+	t.centroids = merged
+}
+
+// knots are the points of the piecewise linear CDF the digest describes:
+// each centroid holds half its weight on either side of its mean.
+func (t *TDigest) knots(min, max float64) ([]float64, []float64) {
+	t.compress()
+	xs := []float64{min}
+	ys := []float64{0}
+	before := 0.0
+	for _, c := range t.centroids {
+		xs = append(xs, c.mean)
+		ys = append(ys, (before+c.weight/2)/t.total)
+		before += c.weight
+	}
+	return append(xs, max), append(ys, 1)
+}
+
+func (t *TDigest) Quantile(q, min, max float64) float64 {
+	xs, ys := t.knots(min, max)
+	if len(xs) == 2 {
+		return min
+	}
+	for i := 1; i < len(ys); i++ {
+		if q <= ys[i] {
+			if ys[i] == ys[i-1] {
+				return xs[i]
+			}
+			return xs[i-1] + (xs[i]-xs[i-1])*(q-ys[i-1])/(ys[i]-ys[i-1])
+		}
+	}
+	return max
+}
+
+func (t *TDigest) CDF(x, min, max float64) float64 {
+	xs, ys := t.knots(min, max)
+	if x < min {
+		return 0
+	}
+	for i := 1; i < len(xs); i++ {
+		if x < xs[i] {
+			return ys[i-1] + (ys[i]-ys[i-1])*(x-xs[i-1])/(xs[i]-xs[i-1])
+		}
+	}
+	return 1
+}
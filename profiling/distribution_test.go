@@ -0,0 +1,78 @@
+package profiling
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// TestTDigestQuantiles compares the digest quantiles with the exact ones,
+// measured as the rank error of the estimate.
+func TestTDigestQuantiles(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		draw func() float64
+	}{
+		{"uniform", func() float64 { return r.Float64() * 1000 }},
+		{"normal", func() float64 { return r.NormFloat64()*10 + 50 }},
+		{"exponential", r.ExpFloat64},
+		{"integers", func() float64 { return float64(r.Intn(100)) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewNumericProfile()
+			values := make([]float64, 100000)
+			for i := range values {
+				values[i] = test.draw()
+				p.Add(values[i])
+			}
+			sort.Float64s(values)
+			n := float64(len(values))
+
+			for _, q := range []float64{0.01, 0.05, 0.25, 0.5, 0.75, 0.95, 0.99} {
+				got := p.Quantile(q)
+				// The share of values below and up to the estimate must
+				// bracket q within the tolerance.
+				below := float64(sort.SearchFloat64s(values, got)) / n
+				upTo := float64(sort.Search(len(values), func(i int) bool { return values[i] > got })) / n
+				if q < below-0.01 || q > upTo+0.01 {
+					t.Errorf("Quantile(%v) = %v, which has ranks %.4f-%.4f", q, got, below, upTo)
+				}
+			}
+		})
+	}
+}
+
+func TestNumericProfileMoments(t *testing.T) {
+	p := NewNumericProfile()
+	for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9, math.NaN(), math.Inf(1), 0, -1} {
+		p.Add(x)
+	}
+	if p.Count() != 10 {
+		t.Fatalf("Count() = %d, want 10 finite values", p.Count())
+	}
+	min, max, mean, std := p.Summary()
+	if min != -1 || max != 9 || math.Abs(mean-3.9) > 1e-9 {
+		t.Errorf("Summary() = %v, %v, %v, want -1, 9, 3.9", min, max, mean)
+	}
+	if want := math.Sqrt(80.9 / 9); math.Abs(std-want) > 1e-9 {
+		t.Errorf("std = %v, want %v", std, want)
+	}
+
+	d := p.Distribution([]float64{50, 150}, 4, "equal-width")
+	if d.ZeroCount != 1 || d.NegativeCount != 1 {
+		t.Errorf("zero and negative counts = %d, %d, want 1, 1", d.ZeroCount, d.NegativeCount)
+	}
+	if _, ok := d.Percentiles["p150"]; ok || len(d.Percentiles) != 1 {
+		t.Errorf("percentiles = %v, want only p50", d.Percentiles)
+	}
+	total := 0
+	for _, bin := range d.Histogram.Bins {
+		total += bin.Count
+	}
+	if len(d.Histogram.Bins) != 4 || total != 10 {
+		t.Errorf("histogram = %+v, want 4 bins holding 10 values", d.Histogram)
+	}
+}
@@ -0,0 +1,269 @@
+package profiling
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encoding detection and transcoding. Files are sniffed for a
+// byte order mark and otherwise classified from a sample, then decoded to
+// UTF-8 while streaming so the parsers only ever see UTF-8. Bytes that are
+// invalid in the detected encoding are replaced with U+FFFD and reported
+// with their offset in the original file.
+
+var encodingSampleSize = 64 * 1024
+
+var maxReportedSequences = 20
+
+// decodeChunkSize is how much of the source is decoded at a time.
+var decodeChunkSize = 32 * 1024
+
+type InvalidSequence struct {
+	Offset int64  `json:"offset"`
+	Bytes  string `json:"bytes"`
+}
+
+// EncodingReport is what the transcoder found while decoding a file.
+type EncodingReport struct {
+	Encoding         string            `json:"encoding"`
+	BOM              bool              `json:"bom,omitempty"`
+	InvalidCount     int               `json:"invalidCount,omitempty"`
+	InvalidSequences []InvalidSequence `json:"invalidSequences,omitempty"`
+}
+
+func (r *EncodingReport) invalid(offset int64, b []byte) {
+	r.InvalidCount++
+	if len(r.InvalidSequences) < maxReportedSequences {
+		r.InvalidSequences = append(r.InvalidSequences, InvalidSequence{Offset: offset, Bytes: fmt.Sprintf("% x", b)})
+	}
+}
+
+// windows1252 maps the bytes 0x80-0x9F; zero marks the five undefined ones.
+// Every other byte has the same code point as in Latin-1.
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+// detectEncoding names the encoding of sample and the length of its byte
+// order mark. Without a BOM, UTF-16 is recognised by its zero bytes, valid
+// UTF-8 wins next, and anything else is Windows-1252 when it uses the
+// C1 range as printable characters or Latin-1 otherwise.
+func detectEncoding(sample []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8", 3
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return "utf-16le", 2
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return "utf-16be", 2
+	}
+
+	if len(sample) >= 4 {
+		evenZeros, oddZeros := 0, 0
+		for i, b := range sample {
+			if b == 0 {
+				if i%2 == 0 {
+					evenZeros++
+				} else {
+					oddZeros++
+				}
+			}
+		}
+		half := len(sample) / 2
+		switch {
+		case oddZeros > half*3/10 && evenZeros < oddZeros/10:
+			return "utf-16le", 0
+		case evenZeros > half*3/10 && oddZeros < evenZeros/10:
+			return "utf-16be", 0
+		}
+	}
+
+	if validUTF8Prefix(sample) {
+		return "utf-8", 0
+	}
+	// Mostly well-formed multi-byte text with a few stray bytes is damaged
+	// UTF-8 rather than a single-byte encoding.
+	multiByte, invalid := utf8Counts(sample)
+	if multiByte > 0 && multiByte >= 4*invalid {
+		return "utf-8", 0
+	}
+	for _, b := range sample {
+		if b >= 0x80 && b <= 0x9F && windows1252[b-0x80] != 0 {
+			return "windows-1252", 0
+		}
+	}
+	return "iso-8859-1", 0
+}
+
+// validUTF8Prefix is utf8.Valid allowing a rune cut off by the sample end.
+func validUTF8Prefix(sample []byte) bool {
+	if utf8.Valid(sample) {
+		return true
+	}
+	for i := 1; i <= 3 && i <= len(sample); i++ {
+		if utf8.RuneStart(sample[len(sample)-i]) {
+			return !utf8.FullRune(sample[len(sample)-i:]) && utf8.Valid(sample[:len(sample)-i])
+		}
+	}
+	return false
+}
+
+// utf8Counts counts the well-formed multi-byte characters and the invalid
+// bytes in sample.
+func utf8Counts(sample []byte) (int, int) {
+	multiByte, invalid := 0, 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			invalid++
+		case size > 1:
+			multiByte++
+		}
+		i += size
+	}
+	return multiByte, invalid
+}
+
+// utf8Reader decodes a stream in a single-byte, UTF-8 or UTF-16 encoding
+// to UTF-8.
+type utf8Reader struct {
+	src     *bufio.Reader
+	report  *EncodingReport
+	offset  int64
+	chunk   []byte
+	pending []byte
+	out     bytes.Buffer
+	eof     bool
+}
+
+// NewUTF8Reader detects the encoding of r from its first bytes and returns
+// a reader of its UTF-8 content, without the BOM, plus the report that is
+// filled in as the content is read.
+func NewUTF8Reader(r io.Reader) (io.Reader, *EncodingReport) {
+	src := bufio.NewReaderSize(r, encodingSampleSize)
+	sample, _ := src.Peek(encodingSampleSize)
+	encoding, bom := detectEncoding(sample)
+	src.Discard(bom)
+
+	report := &EncodingReport{Encoding: encoding, BOM: bom > 0}
+	return &utf8Reader{src: src, report: report, offset: int64(bom), chunk: make([]byte, decodeChunkSize)}, report
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	for u.out.Len() == 0 && !u.eof {
+		n, err := u.src.Read(u.chunk)
+		u.pending = append(u.pending, u.chunk[:n]...)
+		if err == io.EOF {
+			u.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		u.decode()
+	}
+	if u.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return u.out.Read(p)
+}
+
+// decode moves every complete character of pending to out, keeping a split
+// trailing character for the next read unless the input has ended.
+func (u *utf8Reader) decode() {
+	buf := u.pending
+	i := 0
+	switch u.report.Encoding {
+	case "utf-8":
+		if utf8.Valid(buf) {
+			u.out.Write(buf)
+			i = len(buf)
+			break
+		}
+		for i < len(buf) {
+			if !u.eof && !utf8.FullRune(buf[i:]) {
+				break
+			}
+			r, size := utf8.DecodeRune(buf[i:])
+			if r == utf8.RuneError && size <= 1 {
+				u.report.invalid(u.offset+int64(i), buf[i:i+1])
+				u.out.WriteRune(utf8.RuneError)
+				i++
+				continue
+			}
+			u.out.Write(buf[i : i+size])
+			i += size
+		}
+	case "utf-16le", "utf-16be":
+		unit := func(j int) uint16 {
+			if u.report.Encoding == "utf-16le" {
+				return uint16(buf[j]) | uint16(buf[j+1])<<8
+			}
+			return uint16(buf[j])<<8 | uint16(buf[j+1])
+		}
+		for i+1 < len(buf) {
+			c := unit(i)
+			switch {
+			case utf16.IsSurrogate(rune(c)) && c < 0xDC00:
+				if i+3 >= len(buf) {
+					if !u.eof {
+						u.pending = buf[i:]
+						u.offset += int64(i)
+						return
+					}
+					u.report.invalid(u.offset+int64(i), buf[i:i+2])
+					u.out.WriteRune(utf8.RuneError)
+					i += 2
+					continue
+				}
+				r := utf16.DecodeRune(rune(c), rune(unit(i+2)))
+				if r == utf8.RuneError {
+					u.report.invalid(u.offset+int64(i), buf[i:i+2])
+					u.out.WriteRune(utf8.RuneError)
+					i += 2
+					continue
+				}
+				u.out.WriteRune(r)
+				i += 4
+			case utf16.IsSurrogate(rune(c)):
+				u.report.invalid(u.offset+int64(i), buf[i:i+2])
+				u.out.WriteRune(utf8.RuneError)
+				i += 2
+			default:
+				u.out.WriteRune(rune(c))
+				i += 2
+			}
+		}
+		if u.eof && i < len(buf) {
+			u.report.invalid(u.offset+int64(i), buf[i:])
+			u.out.WriteRune(utf8.RuneError)
+			i = len(buf)
+		}
+	case "windows-1252":
+		for ; i < len(buf); i++ {
+			b := buf[i]
+			if b >= 0x80 && b <= 0x9F {
+				if r := windows1252[b-0x80]; r != 0 {
+					u.out.WriteRune(r)
+				} else {
+					u.report.invalid(u.offset+int64(i), buf[i:i+1])
+					u.out.WriteRune(utf8.RuneError)
+				}
+				continue
+			}
+			u.out.WriteRune(rune(b))
+		}
+	default:
+		for ; i < len(buf); i++ {
+			u.out.WriteRune(rune(buf[i]))
+		}
+	}
+	u.offset += int64(i)
+	u.pending = append(u.pending[:0], buf[i:]...)
+}
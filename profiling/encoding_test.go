@@ -0,0 +1,118 @@
+package profiling
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes encodes s as UTF-16 in the given byte order.
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			b = append(b, byte(c>>8), byte(c))
+		} else {
+			b = append(b, byte(c), byte(c>>8))
+		}
+	}
+	return b
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   []byte
+		encoding string
+		bom      int
+	}{
+		{"utf-8 bom", []byte("\xEF\xBB\xBFid,name"), "utf-8", 3},
+		{"utf-16le bom", append([]byte{0xFF, 0xFE}, utf16Bytes("id", false)...), "utf-16le", 2},
+		{"utf-16be bom", append([]byte{0xFE, 0xFF}, utf16Bytes("id", true)...), "utf-16be", 2},
+		{"utf-16le", utf16Bytes("id,name\n1,a\n", false), "utf-16le", 0},
+		{"utf-16be", utf16Bytes("id,name\n1,a\n", true), "utf-16be", 0},
+		{"ascii", []byte("id,name\n1,a\n"), "utf-8", 0},
+		{"utf-8", []byte("café,naïve"), "utf-8", 0},
+		// The sample may end inside a character.
+		{"utf-8 cut", []byte("café,\xC3"), "utf-8", 0},
+		{"damaged utf-8", []byte("ééééé\xFF"), "utf-8", 0},
+		{"windows-1252", []byte("\x93quoted\x94 caf\xE9"), "windows-1252", 0},
+		{"latin-1", []byte("caf\xE9 na\xEFve"), "iso-8859-1", 0},
+		{"empty", nil, "utf-8", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoding, bom := detectEncoding(test.sample)
+			if encoding != test.encoding || bom != test.bom {
+				t.Errorf("detectEncoding() = %s, %d, want %s, %d", encoding, bom, test.encoding, test.bom)
+			}
+		})
+	}
+}
+
+func TestUTF8Reader(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		encoding string
+		want     string
+		// offsets are the positions of the invalid sequences in the input.
+		offsets []int64
+	}{
+		{"utf-8 bom", []byte("\xEF\xBB\xBFa,b\n"), "utf-8", "a,b\n", nil},
+		{"utf-8 invalid", []byte("ééééé\xFFé"), "utf-8", "ééééé�é", []int64{10}},
+		{"utf-16le pair", append([]byte{0xFF, 0xFE}, utf16Bytes("a😀b\n", false)...), "utf-16le", "a😀b\n", nil},
+		{"utf-16be pair", append([]byte{0xFE, 0xFF}, utf16Bytes("a😀b\n", true)...), "utf-16be", "a😀b\n", nil},
+		{"utf-16 without bom", utf16Bytes("id,name\n1,名前 😃\n", false), "utf-16le", "id,name\n1,名前 😃\n", nil},
+		{"lone high surrogate", []byte{0xFF, 0xFE, 0x3D, 0xD8, 'x', 0, 'y', 0}, "utf-16le", "�xy", []int64{2}},
+		{"lone low surrogate", []byte{0xFF, 0xFE, 'a', 0, 0x00, 0xDE, 'b', 0}, "utf-16le", "a�b", []int64{4}},
+		{"high surrogate at end", []byte{0xFF, 0xFE, 'a', 0, 0x3D, 0xD8}, "utf-16le", "a�", []int64{4}},
+		{"odd trailing byte", []byte{0xFF, 0xFE, 'a', 0, 'b'}, "utf-16le", "a�", []int64{4}},
+		{"windows-1252", []byte("\x93hi\x94 caf\xE9 \x81"), "windows-1252", "“hi” café �", []int64{10}},
+		{"latin-1", []byte("caf\xE9 na\xEFve \x81"), "iso-8859-1", "café naïve \u0081", nil},
+	}
+	defer func(size int) { decodeChunkSize = size }(decodeChunkSize)
+	// Small chunks split characters, surrogate pairs included, across reads.
+	for _, size := range []int{1, 3, 5, 32 * 1024} {
+		decodeChunkSize = size
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				r, report := NewUTF8Reader(bytes.NewReader(test.input))
+				got, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != test.want {
+					t.Errorf("chunk %d: read %q, want %q", size, got, test.want)
+				}
+				if report.Encoding != test.encoding {
+					t.Errorf("chunk %d: encoding = %s, want %s", size, report.Encoding, test.encoding)
+				}
+				var offsets []int64
+				for _, s := range report.InvalidSequences {
+					offsets = append(offsets, s.Offset)
+				}
+				if report.InvalidCount != len(test.offsets) || !reflect.DeepEqual(offsets, test.offsets) {
+					t.Errorf("chunk %d: invalid at %v (%d), want %v", size, offsets, report.InvalidCount, test.offsets)
+				}
+			})
+		}
+	}
+}
+
+func TestUTF8ReaderReportLimit(t *testing.T) {
+	input := "é" + strings.Repeat("\xFFéééé", maxReportedSequences+5)
+	r, report := NewUTF8Reader(strings.NewReader(input))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if report.InvalidCount != maxReportedSequences+5 || len(report.InvalidSequences) != maxReportedSequences {
+		t.Errorf("%d invalid with %d reported, want %d with %d", report.InvalidCount, len(report.InvalidSequences), maxReportedSequences+5, maxReportedSequences)
+	}
+	if s := report.InvalidSequences[1]; s.Offset != 11 || s.Bytes != "ff" {
+		t.Errorf("second invalid sequence = %+v, want ff at 11", s)
+	}
+}
@@ -0,0 +1,153 @@
+package profiling
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Frequent values and categorical detection. Values are counted with a
+// Misra-Gries summary: counts are exact until more than FrequencyCapacity
+// distinct values have been seen, after which they are lower bounds and the
+// most frequent values are still found. Every value then loses at most one
+// count per time the full sketch had to make room, which is reported as the
+// error bound of the top values.
+
+var DefaultTopK = 10
+
+// DefaultEnumThreshold is the largest number of distinct values for which a
+// field is treated as categorical and given an enum constraint.
+var DefaultEnumThreshold = 20
+
+// CategoricalMaxRatio keeps small tables, where every value is distinct,
+// from looking categorical.
+var CategoricalMaxRatio = 0.5
+
+var FrequencyCapacity = 1000
+
+type FrequentValue struct {
+	Value     string  `json:"value"`
+	Count     int     `json:"count"`
+	Frequency float64 `json:"frequency"`
+	// Estimated marks a Count (and Frequency) that is a lower bound, at
+	// most CountError below the true count.
+	Estimated  bool `json:"estimated,omitempty"`
+	CountError int  `json:"countError,omitempty"`
+}
+
+// FrequencySketch is exported field by field so that counts read from a
+// database can be loaded into it directly.
+type FrequencySketch struct {
+	Counts   map[string]int
+	Total    int
+	Overflow bool
+	// evictions is the number of times the full sketch made room, the
+	// most any count can be short by.
+	evictions int
+}
+
+func NewFrequencySketch() *FrequencySketch {
+	return &FrequencySketch{Counts: map[string]int{}}
+}
+
+func (f *FrequencySketch) Add(value string) {
+	f.Total++
+	if _, ok := f.Counts[value]; ok || len(f.Counts) < FrequencyCapacity {
+		f.Counts[value]++
+		return
+	}
+	// Full: the new value and every counted one lose one occurrence.
+	f.Overflow = true
+	f.evictions++
+	for v := range f.Counts {
+		f.Counts[v]--
+		if f.Counts[v] == 0 {
+			delete(f.Counts, v)
+		}
+	}
+}
+
+// Exact reports whether the counts are exact, so the distinct values seen
+// are all the values of the field.
+func (f *FrequencySketch) Exact() bool {
+	return !f.Overflow
+}
+
+// Top returns the k most frequent values, ties broken by value; counts are
+// marked estimated with their error bound once values have been evicted.
+func (f *FrequencySketch) Top(k int) []FrequentValue {
+	values := make([]FrequentValue, 0, len(f.Counts))
+	for v, count := range f.Counts {
+		values = append(values, FrequentValue{
+			Value:      v,
+			Count:      count,
+			Frequency:  proportion(count, f.Total),
+			Estimated:  f.evictions > 0,
+			CountError: f.evictions,
+		})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	if len(values) > k {
+		values = values[:k]
+	}
+	return values
+}
+
+// Categories returns the sorted distinct values when the field looks
+// categorical: few distinct values, each repeated on average.
+func (f *FrequencySketch) Categories(threshold int) []string {
+	if !f.Exact() || len(f.Counts) == 0 || len(f.Counts) > threshold {
+		return nil
+	}
+	if float64(len(f.Counts)) > CategoricalMaxRatio*float64(f.Total) {
+		return nil
+	}
+	values := make([]string, 0, len(f.Counts))
+	for v := range f.Counts {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// EnumValues converts categories to the field type for the enum constraint,
+// ordering integers numerically.
+func EnumValues(fieldType string, categories []string) []interface{} {
+	enum := make([]interface{}, 0, len(categories))
+	if fieldType == "integer" {
+		var ints []int64
+		for _, c := range categories {
+			i, err := strconv.ParseInt(c, 10, 64)
+			if err != nil {
+				return stringEnum(categories)
+			}
+			ints = append(ints, i)
+		}
+		sort.Slice(ints, func(i, j int) bool { return ints[i] < ints[j] })
+		for _, i := range ints {
+			enum = append(enum, i)
+		}
+		return enum
+	}
+	return stringEnum(categories)
+}
+
+func stringEnum(categories []string) []interface{} {
+	enum := make([]interface{}, 0, len(categories))
+	for _, c := range categories {
+		enum = append(enum, c)
+	}
+	return enum
+}
+
+// proportion is part/whole as a 0-1 fraction, zero for an empty whole.
+func proportion(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
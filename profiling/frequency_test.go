@@ -0,0 +1,78 @@
+package profiling
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestFrequencySketchExact(t *testing.T) {
+	f := NewFrequencySketch()
+	for _, v := range []string{"b", "a", "c", "a", "b", "a", "d", "d"} {
+		f.Add(v)
+	}
+	if !f.Exact() {
+		t.Fatal("Exact() = false below capacity")
+	}
+	want := []FrequentValue{{Value: "a", Count: 3, Frequency: 0.375}, {Value: "b", Count: 2, Frequency: 0.25}, {Value: "d", Count: 2, Frequency: 0.25}}
+	if got := f.Top(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("Top(3) = %v, want %v", got, want)
+	}
+	if got := f.Categories(4); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Categories(4) = %v, want [a b c d]", got)
+	}
+	if got := f.Categories(3); got != nil {
+		t.Errorf("Categories(3) = %v, want nil above the threshold", got)
+	}
+}
+
+// TestFrequencySketchOverflow checks the Misra-Gries guarantee once the
+// sketch is full: every value seen more than n/(capacity+1) times is kept,
+// and no count is low by more than that.
+func TestFrequencySketchOverflow(t *testing.T) {
+	defer func(capacity int) { FrequencyCapacity = capacity }(FrequencyCapacity)
+	FrequencyCapacity = 10
+
+	f := NewFrequencySketch()
+	counts := map[string]int{}
+	add := func(v string) {
+		f.Add(v)
+		counts[v]++
+	}
+	for i := 0; i < 1000; i++ {
+		add("heavy")
+		if i%2 == 0 {
+			add("medium")
+		}
+		add("rare-" + strconv.Itoa(i))
+	}
+	if f.Exact() {
+		t.Fatal("Exact() = true after more distinct values than the capacity")
+	}
+	if got := f.Categories(100); got != nil {
+		t.Errorf("Categories() = %v, want nil for inexact counts", got)
+	}
+
+	slack := f.Total / (FrequencyCapacity + 1)
+	top := f.Top(2)
+	if len(top) != 2 || top[0].Value != "heavy" || top[1].Value != "medium" {
+		t.Fatalf("Top(2) = %v, want heavy and medium", top)
+	}
+	for _, v := range f.Top(FrequencyCapacity) {
+		if !v.Estimated || v.CountError > slack {
+			t.Errorf("%s: estimated = %v with error %d, want estimated within %d", v.Value, v.Estimated, v.CountError, slack)
+		}
+		if v.Count > counts[v.Value] || v.Count < counts[v.Value]-v.CountError {
+			t.Errorf("count of %s = %d, want %d-%d", v.Value, v.Count, counts[v.Value]-v.CountError, counts[v.Value])
+		}
+	}
+}
+
+func TestEnumValues(t *testing.T) {
+	if got := EnumValues("integer", []string{"10", "9", "-1"}); !reflect.DeepEqual(got, []interface{}{int64(-1), int64(9), int64(10)}) {
+		t.Errorf("EnumValues(integer) = %v, want [-1 9 10]", got)
+	}
+	if got := EnumValues("integer", []string{"1", "x"}); !reflect.DeepEqual(got, []interface{}{"1", "x"}) {
+		t.Errorf("EnumValues(integer) with a non-integer = %v, want strings", got)
+	}
+}
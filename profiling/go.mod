@@ -0,0 +1,3 @@
+module profiling
+
+go 1.18
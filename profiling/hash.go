@@ -0,0 +1,46 @@
+package profiling
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+)
+
+// ContentHash digests a file while it is streamed to the profiler, so the
+// content is read only once. MD5 is optional and only kept for comparing
+// with S3 ETags.
+type ContentHash struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func NewContentHash(withMD5 bool) *ContentHash {
+	h := &ContentHash{sha256: sha256.New()}
+	if withMD5 {
+		h.md5 = md5.New()
+	}
+	return h
+}
+
+func (h *ContentHash) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	if h.md5 != nil {
+		h.md5.Write(p)
+	}
+	return len(p), nil
+}
+
+// SHA256 returns the digest in the frictionless "sha256:<hex>" form.
+func (h *ContentHash) SHA256() string {
+	return "sha256:" + hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+// MD5 returns the bare hex digest, as S3 reports it in ETags, or "" when
+// MD5 was not requested.
+func (h *ContentHash) MD5() string {
+	if h.md5 == nil {
+		return ""
+	}
+	return hex.EncodeToString(h.md5.Sum(nil))
+}
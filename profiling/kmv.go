@@ -0,0 +1,158 @@
+package profiling
+
+import (
+	"container/heap"
+	"math/bits"
+	"sort"
+)
+
+// Key sketches. The smallest distinct hashes of a column's values estimate
+// how far its values are contained in another column's, which is how
+// foreign keys are found across files, tables and plugins. Values are
+// hashed with KeyHash, which a database can compute as well.
+
+// KeySketchSize is the number of hashes kept per key candidate.
+var KeySketchSize = 256
+
+// KMVSketch keeps the size smallest distinct hashes seen.
+type KMVSketch struct {
+	hashes uint64Heap
+	seen   map[uint64]bool
+	size   int
+}
+
+func NewKMVSketch(size int) *KMVSketch {
+	return &KMVSketch{seen: map[uint64]bool{}, size: size}
+}
+
+func (k *KMVSketch) Add(hash uint64) {
+	if k.seen[hash] {
+		return
+	}
+	if len(k.hashes) < k.size {
+		heap.Push(&k.hashes, hash)
+		k.seen[hash] = true
+		return
+	}
+	if hash >= k.hashes[0] {
+		return
+	}
+	delete(k.seen, k.hashes[0])
+	k.hashes[0] = hash
+	heap.Fix(&k.hashes, 0)
+	k.seen[hash] = true
+}
+
+// Sorted returns the hashes in increasing order.
+func (k *KMVSketch) Sorted() []uint64 {
+	hashes := append([]uint64(nil), k.hashes...)
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	return hashes
+}
+
+// uint64Heap is a max-heap, so the largest of the kept hashes is evicted.
+type uint64Heap []uint64
+
+func (h uint64Heap) Len() int            { return len(h) }
+func (h uint64Heap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h uint64Heap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *uint64Heap) Push(x interface{}) { *h = append(*h, x.(uint64)) }
+func (h *uint64Heap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// KeyHash is PostgreSQL's hashtextextended(value, 0), as a little-endian
+// server computes it, read as unsigned: Bob Jenkins' lookup3 over the
+// bytes of the value. The Postgres plugin builds its key sketches in SQL,
+// and the other plugins' sketches must hash values the same way.
+func KeyHash(value string) uint64 {
+	k := []byte(value)
+	a := 0x9e3779b9 + uint32(len(k)) + 3923095
+	b, c := a, a
+	for ; len(k) >= 12; k = k[12:] {
+		a += uint32(k[0]) | uint32(k[1])<<8 | uint32(k[2])<<16 | uint32(k[3])<<24
+		b += uint32(k[4]) | uint32(k[5])<<8 | uint32(k[6])<<16 | uint32(k[7])<<24
+		c += uint32(k[8]) | uint32(k[9])<<8 | uint32(k[10])<<16 | uint32(k[11])<<24
+		a, b, c = lookup3Mix(a, b, c)
+	}
+	// The lowest byte of c is left to the length.
+	switch len(k) {
+	case 11:
+		c += uint32(k[10]) << 24
+		fallthrough
+	case 10:
+		c += uint32(k[9]) << 16
+		fallthrough
+	case 9:
+		c += uint32(k[8]) << 8
+		fallthrough
+	case 8:
+		b += uint32(k[7]) << 24
+		fallthrough
+	case 7:
+		b += uint32(k[6]) << 16
+		fallthrough
+	case 6:
+		b += uint32(k[5]) << 8
+		fallthrough
+	case 5:
+		b += uint32(k[4])
+		fallthrough
+	case 4:
+		a += uint32(k[3]) << 24
+		fallthrough
+	case 3:
+		a += uint32(k[2]) << 16
+		fallthrough
+	case 2:
+		a += uint32(k[1]) << 8
+		fallthrough
+	case 1:
+		a += uint32(k[0])
+	}
+	b, c = lookup3Final(a, b, c)
+	return uint64(b)<<32 | uint64(c)
+}
+
+func lookup3Mix(a, b, c uint32) (uint32, uint32, uint32) {
+	a -= c
+	a ^= bits.RotateLeft32(c, 4)
+	c += b
+	b -= a
+	b ^= bits.RotateLeft32(a, 6)
+	a += c
+	c -= b
+	c ^= bits.RotateLeft32(b, 8)
+	b += a
+	a -= c
+	a ^= bits.RotateLeft32(c, 16)
+	c += b
+	b -= a
+	b ^= bits.RotateLeft32(a, 19)
+	a += c
+	c -= b
+	c ^= bits.RotateLeft32(b, 4)
+	b += a
+	return a, b, c
+}
+
+func lookup3Final(a, b, c uint32) (uint32, uint32) {
+	c ^= b
+	c -= bits.RotateLeft32(b, 14)
+	a ^= c
+	a -= bits.RotateLeft32(c, 11)
+	b ^= a
+	b -= bits.RotateLeft32(a, 25)
+	c ^= b
+	c -= bits.RotateLeft32(b, 16)
+	a ^= c
+	a -= bits.RotateLeft32(c, 4)
+	b ^= a
+	b -= bits.RotateLeft32(a, 14)
+	c ^= b
+	c -= bits.RotateLeft32(b, 24)
+	return b, c
+}
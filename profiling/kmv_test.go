@@ -0,0 +1,47 @@
+package profiling
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// TestKMVSketch checks the sketch keeps exactly the smallest distinct
+// hashes, and that they estimate the number of distinct values as the API
+// reads them.
+func TestKMVSketch(t *testing.T) {
+	const n = 20000
+	sketch := NewKMVSketch(KeySketchSize)
+	var all []uint64
+	for i := 0; i < n; i++ {
+		h := KeyHash(strconv.Itoa(i))
+		all = append(all, h)
+		sketch.Add(h)
+		sketch.Add(KeyHash(strconv.Itoa(i / 3)))
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	got := sketch.Sorted()
+	if !reflect.DeepEqual(got, all[:KeySketchSize]) {
+		t.Fatalf("Sorted() kept %d hashes, not the %d smallest", len(got), KeySketchSize)
+	}
+
+	// The k-th smallest of n uniform hashes sits near k/n of the range;
+	// the estimate's relative standard error is about 1/sqrt(k-2).
+	estimate := float64(KeySketchSize-1) / (float64(got[len(got)-1]) / math.MaxUint64)
+	if bound := 3 / math.Sqrt(float64(KeySketchSize-2)); math.Abs(estimate-n)/n > bound {
+		t.Errorf("distinct estimate = %.0f, want %d within %.2f", estimate, n, bound)
+	}
+}
+
+func TestKMVSketchSmall(t *testing.T) {
+	sketch := NewKMVSketch(4)
+	for _, h := range []uint64{9, 3, 7, 3, 1, 8, 2, 9} {
+		sketch.Add(h)
+	}
+	if got := sketch.Sorted(); !reflect.DeepEqual(got, []uint64{1, 2, 3, 7}) {
+		t.Errorf("Sorted() = %v, want [1 2 3 7]", got)
+	}
+}
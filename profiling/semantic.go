@@ -0,0 +1,168 @@
+package profiling
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Semantic type detection. Up to SemanticSampleSize values of a field are
+// matched against each semantic type; the type matching the largest share
+// of them, at least SemanticMinConfidence, is reported with that share as
+// its confidence. Types whose values are easily confused with plain numbers
+// or codes (coordinates, country and postal codes) also need a field name
+// that suggests them.
+
+var SemanticSampleSize = 10000
+
+var SemanticMinConfidence = 0.8
+
+type semanticType struct {
+	name     string
+	nameHint *regexp.Regexp
+	match    func(string) bool
+}
+
+var (
+	emailPattern      = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	uuidPattern       = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	phonePattern      = regexp.MustCompile(`^\+?[0-9 ().-]{7,20}$`)
+	countryPattern    = regexp.MustCompile(`^[A-Z]{2,3}$`)
+	postalPattern     = regexp.MustCompile(`^(?i)[0-9a-z][0-9a-z -]{1,8}[0-9a-z]$`)
+	currencyPattern   = regexp.MustCompile(`^-?[$€£¥]\s?-?[0-9]{1,3}(,?[0-9]{3})*(\.[0-9]+)?$|^-?[0-9]+(\.[0-9]+)?\s?(USD|EUR|GBP|JPY|CHF|CAD|AUD|INR|CNY)$`)
+	phoneNameHint     = regexp.MustCompile(`(?i)(phone|tel|mobile|fax|cell)`)
+	latitudeNameHint  = regexp.MustCompile(`(?i)(^lat$|latitude|^lat_|_lat$)`)
+	longitudeNameHint = regexp.MustCompile(`(?i)(^lon$|^lng$|^long$|longitude|^lon_|^lng_|_lon$|_lng$)`)
+	countryNameHint   = regexp.MustCompile(`(?i)country`)
+	postalNameHint    = regexp.MustCompile(`(?i)(zip|postal|postcode)`)
+)
+
+var semanticTypes = []semanticType{
+	{name: "email", match: func(v string) bool { return strings.Contains(v, "@") && emailPattern.MatchString(v) }},
+	{name: "url", match: isURL},
+	{name: "uuid", match: func(v string) bool { return len(v) == 36 && uuidPattern.MatchString(v) }},
+	{name: "ipv4", match: func(v string) bool {
+		if strings.Count(v, ".") != 3 {
+			return false
+		}
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil
+	}},
+	{name: "ipv6", match: func(v string) bool { return strings.Contains(v, ":") && net.ParseIP(v) != nil }},
+	{name: "phone", match: isPhone},
+	{name: "latitude", nameHint: latitudeNameHint, match: func(v string) bool { return inRange(v, 90) }},
+	{name: "longitude", nameHint: longitudeNameHint, match: func(v string) bool { return inRange(v, 180) }},
+	{name: "country_code", nameHint: countryNameHint, match: countryPattern.MatchString},
+	{name: "postal_code", nameHint: postalNameHint, match: postalPattern.MatchString},
+	{name: "currency", match: isCurrency},
+}
+
+// IsEmail and IsUUID check the email and uuid string formats.
+func IsEmail(v string) bool { return emailPattern.MatchString(v) }
+
+func IsUUID(v string) bool { return uuidPattern.MatchString(v) }
+
+// isCurrency checks for a currency symbol or code before the regular
+// expression, which most values would otherwise be run through.
+func isCurrency(v string) bool {
+	if !strings.ContainsAny(v, "$€£¥DRPYF") {
+		return false
+	}
+	return currencyPattern.MatchString(v)
+}
+
+func isURL(v string) bool {
+	if !strings.Contains(v, "://") {
+		return false
+	}
+	u, err := url.Parse(v)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "ftp") && u.Host != ""
+}
+
+// isPhone accepts seven to fifteen digits with the usual separators.
+func isPhone(v string) bool {
+	if !phonePattern.MatchString(v) {
+		return false
+	}
+	digits := 0
+	for _, ch := range v {
+		if ch >= '0' && ch <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+func inRange(v string, limit float64) bool {
+	f, err := strconv.ParseFloat(v, 64)
+	return err == nil && f >= -limit && f <= limit
+}
+
+type SemanticClassifier struct {
+	types   []semanticType
+	phone   bool
+	matches []int
+	checked int
+}
+
+func NewSemanticClassifier(name string) *SemanticClassifier {
+	s := &SemanticClassifier{phone: phoneNameHint.MatchString(name)}
+	for _, t := range semanticTypes {
+		if t.nameHint == nil || t.nameHint.MatchString(name) {
+			s.types = append(s.types, t)
+		}
+	}
+	s.matches = make([]int, len(s.types))
+	return s
+}
+
+func (s *SemanticClassifier) Add(value string) {
+	if s.checked >= SemanticSampleSize {
+		return
+	}
+	s.checked++
+	for i, t := range s.types {
+		// Unless the name says so, a phone number needs a leading + or an
+		// area code in brackets, so dates and ids are not taken for one.
+		if t.name == "phone" && !s.phone && !strings.HasPrefix(value, "+") && !strings.Contains(value, "(") {
+			continue
+		}
+		if t.match(value) {
+			s.matches[i]++
+		}
+	}
+}
+
+// Result returns the best matching semantic type and its confidence, the
+// share of the checked values it matched; ok is false when none reaches
+// SemanticMinConfidence.
+func (s *SemanticClassifier) Result() (name string, confidence float64, ok bool) {
+	if s.checked == 0 {
+		return "", 0, false
+	}
+	best := -1
+	for i := range s.types {
+		if best < 0 || s.matches[i] > s.matches[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", 0, false
+	}
+	confidence = proportion(s.matches[best], s.checked)
+	if confidence < SemanticMinConfidence {
+		return "", 0, false
+	}
+	return s.types[best].name, confidence, true
+}
+
+// Checked is the number of values matched against the semantic types.
+func (s *SemanticClassifier) Checked() int {
+	return s.checked
+}
+
+// SemanticFormats are the Table Schema string formats implied by a semantic
+// type, used when every checked value matched.
+var SemanticFormats = map[string]string{"email": "email", "url": "uri", "uuid": "uuid"}
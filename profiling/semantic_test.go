@@ -0,0 +1,82 @@
+package profiling
+
+import "testing"
+
+func TestSemanticClassifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		field      string
+		values     []string
+		want       string
+		confidence float64
+	}{
+		{"email", "contact", []string{"a@example.com", "b.c@mail.example.org"}, "email", 1},
+		{"url", "endpoint", []string{"https://example.com/api", "http://localhost:8080", "ftp://files.example.com"}, "url", 1},
+		{"uuid", "id", []string{"123e4567-e89b-12d3-a456-426614174000", "A987FBC9-4BED-3078-CF07-9141BA07C9F3"}, "uuid", 1},
+		{"ipv4", "host", []string{"10.0.0.1", "192.168.1.20"}, "ipv4", 1},
+		{"ipv6", "host", []string{"::1", "2001:db8::ff00:42:8329"}, "ipv6", 1},
+		{"phone by name", "phone_numbers", []string{"555 123 4567", "555-987-6543"}, "phone", 1},
+		{"phone by prefix", "contact", []string{"+44 20 7946 0958", "(555) 987-6543"}, "phone", 1},
+		// Without a phone name, dates and plain numbers are not phones.
+		{"not a phone", "code", []string{"2020-01-15", "1234567"}, "", 0},
+		{"latitude", "lat", []string{"51.5", "-33.87"}, "latitude", 1},
+		{"longitude", "lng", []string{"-0.12", "151.21"}, "longitude", 1},
+		{"coordinates need a name", "score", []string{"51.5", "-33.87"}, "", 0},
+		{"country code", "country", []string{"US", "GBR"}, "country_code", 1},
+		{"postal code", "zip", []string{"90210", "SW1A 1AA"}, "postal_code", 1},
+		{"currency", "price", []string{"$1,200.50", "€5", "30 EUR"}, "currency", 1},
+		{"mostly email", "contact", []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "n/a"}, "email", 0.8},
+		{"too few emails", "contact", []string{"a@example.com", "b@example.com", "c@example.com", "none", "n/a"}, "", 0},
+		{"plain text", "name", []string{"Alice", "Bob"}, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSemanticClassifier(test.field)
+			for _, v := range test.values {
+				s.Add(v)
+			}
+			name, confidence, ok := s.Result()
+			if name != test.want || confidence != test.confidence || ok != (test.want != "") {
+				t.Errorf("Result() = %q, %v, %v, want %q, %v", name, confidence, ok, test.want, test.confidence)
+			}
+		})
+	}
+}
+
+func TestSemanticSampleSize(t *testing.T) {
+	defer func(size int) { SemanticSampleSize = size }(SemanticSampleSize)
+	SemanticSampleSize = 2
+
+	s := NewSemanticClassifier("contact")
+	for _, v := range []string{"a@example.com", "b@example.com", "x", "y", "z"} {
+		s.Add(v)
+	}
+	if name, confidence, _ := s.Result(); name != "email" || confidence != 1 || s.Checked() != 2 {
+		t.Errorf("Result() = %q, %v after %d values, want email, 1 after 2", name, confidence, s.Checked())
+	}
+}
+
+func TestStringFormats(t *testing.T) {
+	for v, want := range map[string]bool{
+		"a@example.com":    true,
+		"a@b":              false,
+		"a b@example.com":  false,
+		"a@@example.com":   false,
+		"@example.com":     false,
+		"first.last@x.org": true,
+	} {
+		if got := IsEmail(v); got != want {
+			t.Errorf("IsEmail(%q) = %v, want %v", v, got, want)
+		}
+	}
+	for v, want := range map[string]bool{
+		"123e4567-e89b-12d3-a456-426614174000":   true,
+		"123e4567e89b12d3a456426614174000":       false,
+		"123e4567-e89b-12d3-a456-42661417400g":   false,
+		"{123e4567-e89b-12d3-a456-426614174000}": false,
+	} {
+		if got := IsUUID(v); got != want {
+			t.Errorf("IsUUID(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package profiling
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	tokenPattern       = regexp.MustCompile(`^[A-Za-z0-9_+/=.-]{20,}$`)
+	tokenPrefixPattern = regexp.MustCompile(`^(AKIA[0-9A-Z]{16}|sk_(live|test)_|ghp_|gho_|xox[abp]-|AIza|-----BEGIN)`)
+)
+
+// SensitiveDetector looks at the shape of up to SemanticSampleSize values
+// for card numbers and key-like tokens.
+type SensitiveDetector struct {
+	checked int
+	cards   int
+	tokens  int
+}
+
+func NewSensitiveDetector() *SensitiveDetector {
+	return &SensitiveDetector{}
+}
+
+func (s *SensitiveDetector) Add(value string) {
+	if s.checked >= SemanticSampleSize {
+		return
+	}
+	s.checked++
+	if isCardNumber(value) {
+		s.cards++
+	}
+	if isToken(value) {
+		s.tokens++
+	}
+}
+
+// CardShare and TokenShare are the shares of the checked values that are
+// card numbers and key-like tokens, 0 when none were checked.
+func (s *SensitiveDetector) CardShare() float64 {
+	return proportion(s.cards, s.checked)
+}
+
+func (s *SensitiveDetector) TokenShare() float64 {
+	return proportion(s.tokens, s.checked)
+}
+
+// isCardNumber accepts 13 to 19 digits, optionally grouped by spaces or
+// dashes, that pass the Luhn check.
+func isCardNumber(value string) bool {
+	var digits []int
+	for _, ch := range value {
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits = append(digits, int(ch-'0'))
+		case ch == ' ' || ch == '-':
+		default:
+			return false
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// isToken matches well-known key prefixes, and long strings mixing letters
+// and digits with the entropy of random keys.
+func isToken(value string) bool {
+	if tokenPrefixPattern.MatchString(value) {
+		return true
+	}
+	if !tokenPattern.MatchString(value) || !strings.ContainsAny(value, "0123456789") || strings.ToLower(value) == value || strings.ToUpper(value) == value {
+		return false
+	}
+	return entropy(value) >= 3.5
+}
+
+// entropy is the Shannon entropy of value in bits per character.
+func entropy(value string) float64 {
+	counts := map[rune]int{}
+	for _, ch := range value {
+		counts[ch]++
+	}
+	n := float64(len(value))
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,172 @@
+package profiling
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Value shapes and lengths, from which the string constraints of a field
+// are inferred: a field whose values all share one shape, such as
+// "AB-1234", gets that shape as its pattern.
+
+// ShapeMaxSegments keeps free text, which has no useful shape, from being
+// described by a long pattern.
+var ShapeMaxSegments = 12
+
+type shapeSegment struct {
+	class    rune
+	min, max int
+}
+
+// Character classes of a shape; any other rune is its own literal class.
+const (
+	shapeDigit rune = -1 - iota
+	shapeUpper
+	shapeLower
+)
+
+// ShapeDetector reduces each value to runs of digits, upper and lower case
+// letters and literal characters. Values with the same runs in the same
+// order share a shape, whose run lengths become ranges.
+type ShapeDetector struct {
+	segments []shapeSegment
+	failed   bool
+	count    int
+}
+
+func NewShapeDetector() *ShapeDetector {
+	return &ShapeDetector{}
+}
+
+func shapeClass(ch rune) rune {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return shapeDigit
+	case ch >= 'A' && ch <= 'Z':
+		return shapeUpper
+	case ch >= 'a' && ch <= 'z':
+		return shapeLower
+	}
+	return ch
+}
+
+// Add matches value against the shape so far, run by run, widening the run
+// lengths; the first value sets the shape.
+func (s *ShapeDetector) Add(value string) {
+	s.count++
+	if s.failed {
+		return
+	}
+	first := s.segments == nil
+	n, run := -1, 0
+	var class rune
+	end := func() {
+		switch {
+		case n < 0:
+		case first:
+			s.segments[n].min, s.segments[n].max = run, run
+		case run < s.segments[n].min:
+			s.segments[n].min = run
+		case run > s.segments[n].max:
+			s.segments[n].max = run
+		}
+	}
+	for _, ch := range value {
+		c := shapeClass(ch)
+		if n >= 0 && c == class {
+			run++
+			continue
+		}
+		end()
+		n, run, class = n+1, 1, c
+		switch {
+		case n >= ShapeMaxSegments:
+			s.failed = true
+			return
+		case first:
+			s.segments = append(s.segments, shapeSegment{class: c})
+		case n >= len(s.segments) || s.segments[n].class != c:
+			s.failed = true
+			return
+		}
+	}
+	end()
+	if n < 0 || n+1 != len(s.segments) {
+		s.failed = true
+	}
+}
+
+// Count is the number of values added.
+func (s *ShapeDetector) Count() int {
+	return s.count
+}
+
+// Pattern returns the shape as a regular expression, or "" when the values
+// do not share one or it says nothing beyond "some text".
+func (s *ShapeDetector) Pattern() string {
+	if s.failed || s.segments == nil {
+		return ""
+	}
+	classes := 0
+	var b strings.Builder
+	for _, seg := range s.segments {
+		switch seg.class {
+		case shapeDigit:
+			b.WriteString("[0-9]")
+			classes++
+		case shapeUpper:
+			b.WriteString("[A-Z]")
+			classes++
+		case shapeLower:
+			b.WriteString("[a-z]")
+			classes++
+		default:
+			b.WriteString(regexp.QuoteMeta(string(seg.class)))
+		}
+		switch {
+		case seg.min == seg.max && seg.min == 1:
+		case seg.min == seg.max:
+			b.WriteString("{" + strconv.Itoa(seg.min) + "}")
+		default:
+			b.WriteString("{" + strconv.Itoa(seg.min) + "," + strconv.Itoa(seg.max) + "}")
+		}
+	}
+	if classes == 0 || len(s.segments) == 1 {
+		return ""
+	}
+	return b.String()
+}
+
+// LengthRange tracks the shortest and longest string, array or object.
+type LengthRange struct {
+	Min, Max int
+	Seen     bool
+}
+
+func (l *LengthRange) Add(n int) {
+	if !l.Seen || n < l.Min {
+		l.Min = n
+	}
+	if !l.Seen || n > l.Max {
+		l.Max = n
+	}
+	l.Seen = true
+}
+
+// IntegerRange tracks the smallest and largest integer exactly, which the
+// float64 stats cannot do beyond 2^53.
+type IntegerRange struct {
+	Min, Max int64
+	Seen     bool
+}
+
+func (r *IntegerRange) Add(n int64) {
+	if !r.Seen || n < r.Min {
+		r.Min = n
+	}
+	if !r.Seen || n > r.Max {
+		r.Max = n
+	}
+	r.Seen = true
+}
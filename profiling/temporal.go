@@ -0,0 +1,151 @@
+package profiling
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Date, time, datetime and duration inference. Every non-null value of a
+// column is tried against the candidate formats still standing; a column is
+// temporal when at least one format parses all of its values, and the first
+// such format in the list below is recorded as the field format.
+
+type temporalFormat struct {
+	kind    string
+	format  string
+	layouts []string
+	// epoch is the unit of a Unix timestamp format, zero for the others.
+	epoch time.Duration
+}
+
+// Day-first layouts come before month-first ones, so values that fit both
+// (every day below 13) are read as dd/mm.
+var temporalFormats = []temporalFormat{
+	{kind: "datetime", format: "default", layouts: []string{time.RFC3339, "2006-01-02T15:04:05"}},
+	{kind: "datetime", format: "%Y-%m-%d %H:%M:%S", layouts: []string{"2006-01-02 15:04:05"}},
+	{kind: "datetime", format: "%Y-%m-%d %H:%M", layouts: []string{"2006-01-02 15:04"}},
+	{kind: "datetime", format: "%d/%m/%Y %H:%M:%S", layouts: []string{"02/01/2006 15:04:05"}},
+	{kind: "datetime", format: "%m/%d/%Y %H:%M:%S", layouts: []string{"01/02/2006 15:04:05"}},
+	{kind: "datetime", format: "%d/%m/%Y %H:%M", layouts: []string{"02/01/2006 15:04"}},
+	{kind: "datetime", format: "%m/%d/%Y %H:%M", layouts: []string{"01/02/2006 15:04"}},
+	{kind: "datetime", format: "%a, %d %b %Y %H:%M:%S %z", layouts: []string{time.RFC1123Z}},
+	{kind: "date", format: "default", layouts: []string{"2006-01-02"}},
+	{kind: "date", format: "%d/%m/%Y", layouts: []string{"02/01/2006"}},
+	{kind: "date", format: "%m/%d/%Y", layouts: []string{"01/02/2006"}},
+	{kind: "date", format: "%Y/%m/%d", layouts: []string{"2006/01/02"}},
+	{kind: "date", format: "%d-%m-%Y", layouts: []string{"02-01-2006"}},
+	{kind: "date", format: "%d.%m.%Y", layouts: []string{"02.01.2006"}},
+	{kind: "date", format: "%d %b %Y", layouts: []string{"02 Jan 2006"}},
+	{kind: "date", format: "%b %d, %Y", layouts: []string{"Jan 02, 2006"}},
+	{kind: "time", format: "default", layouts: []string{"15:04:05"}},
+	{kind: "time", format: "%H:%M", layouts: []string{"15:04"}},
+	{kind: "time", format: "%I:%M %p", layouts: []string{"03:04 PM"}},
+}
+
+// Unix timestamps are only considered for integer columns whose name hints
+// at a time, since ids and counts often fall in the same numeric range.
+var epochFormats = []temporalFormat{
+	{kind: "datetime", format: "%s", epoch: time.Second},
+	{kind: "datetime", format: "%Q", epoch: time.Millisecond},
+}
+
+var epochNameHint = regexp.MustCompile(`(?i)(time|date|epoch|stamp|^ts$|_ts$|_at$|_on$)`)
+
+// epochRange bounds plausible timestamps: 2000-01-01 to 2100-01-01.
+var epochRange = [2]int64{946684800, 4102444800}
+
+var isoDuration = regexp.MustCompile(`^P(\d+Y)?(\d+M)?(\d+W)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+
+type temporalCandidate struct {
+	temporalFormat
+	min, max time.Time
+}
+
+type TemporalDetector struct {
+	candidates []temporalCandidate
+	durations  bool
+	seen       int
+}
+
+func NewTemporalDetector(name string) *TemporalDetector {
+	t := &TemporalDetector{durations: true}
+	for _, f := range temporalFormats {
+		t.candidates = append(t.candidates, temporalCandidate{temporalFormat: f})
+	}
+	if epochNameHint.MatchString(name) {
+		for _, f := range epochFormats {
+			t.candidates = append(t.candidates, temporalCandidate{temporalFormat: f})
+		}
+	}
+	return t
+}
+
+// Add drops the candidates that cannot parse value.
+func (t *TemporalDetector) Add(value string) {
+	if len(t.candidates) == 0 && !t.durations {
+		return
+	}
+	t.seen++
+	if t.durations && !IsDuration(value) {
+		t.durations = false
+	}
+	kept := t.candidates[:0]
+	for _, c := range t.candidates {
+		parsed, ok := c.parse(value)
+		if !ok {
+			continue
+		}
+		if c.min.IsZero() || parsed.Before(c.min) {
+			c.min = parsed
+		}
+		if c.max.IsZero() || parsed.After(c.max) {
+			c.max = parsed
+		}
+		kept = append(kept, c)
+	}
+	t.candidates = kept
+}
+
+// IsDuration reports whether value is an ISO 8601 duration with at least
+// one component.
+func IsDuration(value string) bool {
+	return len(value) >= 3 && value[len(value)-1] != 'T' && isoDuration.MatchString(value)
+}
+
+func (f temporalFormat) parse(value string) (time.Time, bool) {
+	if f.epoch != 0 {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds := n / (int64(time.Second) / int64(f.epoch))
+		if seconds < epochRange[0] || seconds >= epochRange[1] {
+			return time.Time{}, false
+		}
+		return time.Unix(0, n*int64(f.epoch)).UTC(), true
+	}
+	for _, layout := range f.layouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Result returns the detected type and format with the earliest and latest
+// values, formatted in ISO 8601; ok is false for non-temporal columns.
+func (t *TemporalDetector) Result() (kind, format, min, max string, ok bool) {
+	if t.seen == 0 {
+		return "", "", "", "", false
+	}
+	if len(t.candidates) > 0 {
+		c := t.candidates[0]
+		layout := map[string]string{"date": "2006-01-02", "time": "15:04:05", "datetime": time.RFC3339}[c.kind]
+		return c.kind, c.format, c.min.Format(layout), c.max.Format(layout), true
+	}
+	if t.durations {
+		return "duration", "default", "", "", true
+	}
+	return "", "", "", "", false
+}
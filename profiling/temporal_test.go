@@ -0,0 +1,50 @@
+package profiling
+
+import "testing"
+
+func TestTemporalDetector(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+		values []string
+		kind   string
+		format string
+		min    string
+		max    string
+	}{
+		{"iso date", "day", []string{"2021-03-04", "2020-12-31"}, "date", "default", "2020-12-31", "2021-03-04"},
+		{"day first", "day", []string{"04/03/2021", "12/01/2020"}, "date", "%d/%m/%Y", "2020-01-12", "2021-03-04"},
+		{"month first", "day", []string{"04/03/2021", "12/31/2020"}, "date", "%m/%d/%Y", "2020-12-31", "2021-04-03"},
+		{"iso datetime", "at", []string{"2021-03-04T05:06:07Z", "2021-03-04T05:06:07+01:00"}, "datetime", "default", "2021-03-04T05:06:07+01:00", "2021-03-04T05:06:07Z"},
+		{"time", "start", []string{"09:30", "17:05"}, "time", "%H:%M", "09:30:00", "17:05:00"},
+		{"epoch seconds", "created_at", []string{"1600000000", "1500000000"}, "datetime", "%s", "2017-07-14T02:40:00Z", "2020-09-13T12:26:40Z"},
+		{"epoch milliseconds", "updated_ts", []string{"1600000000000"}, "datetime", "%Q", "2020-09-13T12:26:40Z", "2020-09-13T12:26:40Z"},
+		{"duration", "length", []string{"P1D", "PT1H30M", "P2Y3M"}, "duration", "default", "", ""},
+		{"integers without a name hint", "id", []string{"1600000000", "1500000000"}, "", "", "", ""},
+		{"mixed", "day", []string{"2021-03-04", "soon"}, "", "", "", ""},
+		{"no values", "day", nil, "", "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := NewTemporalDetector(test.column)
+			for _, v := range test.values {
+				d.Add(v)
+			}
+			kind, format, min, max, ok := d.Result()
+			if ok != (test.kind != "") || kind != test.kind || format != test.format || min != test.min || max != test.max {
+				t.Errorf("Result() = %q, %q, %q, %q, %v, want %q, %q, %q, %q", kind, format, min, max, ok, test.kind, test.format, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestIsDuration(t *testing.T) {
+	for value, want := range map[string]bool{
+		"P1D": true, "PT1H30M": true, "P1Y2M3W4DT5H6M7.5S": true,
+		"P": false, "PT": false, "P1DT": false, "1D": false, "P1H": false,
+	} {
+		if got := IsDuration(value); got != want {
+			t.Errorf("IsDuration(%q) = %v, want %v", value, got, want)
+		}
+	}
+}